@@ -2,7 +2,7 @@ package main
 
 import (
 	"flag"
-	"time"
+	"os"
 
 	"extrnode-be/internal/pkg/config_types"
 	"extrnode-be/internal/pkg/log"
@@ -12,18 +12,23 @@ import (
 )
 
 const (
-	waitTimeout = time.Second * 10
+	// drain and stats final flush are limited by their own timeouts, stop waits for them without cap
+	waitTimeout = 0
 )
 
 type flags struct {
-	logLevel string
-	envFile  string
+	logLevel    string
+	envFile     string
+	configFile  string
+	printConfig bool
 }
 
 // Setup flags
 func getFlags() (f flags) {
 	flag.StringVar(&f.logLevel, "log", "info", "log level [debug|info|warn|error|crit]")
 	flag.StringVar(&f.envFile, "envFile", "", "path to .env file")
+	flag.StringVar(&f.configFile, "config", "", "path to config file [yaml|toml|json], env variables override its values")
+	flag.BoolVar(&f.printConfig, "print-config", false, "print effective config with masked secrets and exit")
 	flag.Parse()
 
 	return
@@ -36,10 +41,17 @@ func main() {
 		log.Logger.Proxy.Fatalf("Log setup: %s", err)
 	}
 
-	cfg, err := config_types.LoadFile[config.Config](f.envFile)
+	cfg, err := config_types.LoadFile[config.Config](f.configFile, f.envFile)
 	if err != nil {
 		log.Logger.Proxy.Fatalf("Config: %s", err)
 	}
+	if f.printConfig {
+		err = config_types.PrintConfig(os.Stdout, cfg)
+		if err != nil {
+			log.Logger.Proxy.Fatalf("PrintConfig: %s", err)
+		}
+		return
+	}
 
 	log.Logger.Proxy.Info("Start service")
 
@@ -61,6 +73,11 @@ func main() {
 		}
 	}()
 
+	// Config reload on SIGHUP and files change
+	app.WatchConfig([]string{f.configFile, f.envFile}, func() (config.Config, error) {
+		return config_types.LoadFile[config.Config](f.configFile, f.envFile)
+	})
+
 	// Termination handler.
 	util.GracefulStop(app.WaitGroup(), waitTimeout, func() {
 		err = app.Stop()
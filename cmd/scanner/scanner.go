@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"os"
 	"time"
 
 	"extrnode-be/internal/pkg/config_types"
@@ -16,14 +17,18 @@ const (
 )
 
 type flags struct {
-	logLevel string
-	envFile  string
+	logLevel    string
+	envFile     string
+	configFile  string
+	printConfig bool
 }
 
 // Setup flags
 func getFlags() (f flags) {
 	flag.StringVar(&f.logLevel, "log", "info", "log level [debug|info|warn|error|crit]")
 	flag.StringVar(&f.envFile, "envFile", "", "path to .env file")
+	flag.StringVar(&f.configFile, "config", "", "path to config file [yaml|toml|json], env variables override its values")
+	flag.BoolVar(&f.printConfig, "print-config", false, "print effective config with masked secrets and exit")
 	flag.Parse()
 
 	return
@@ -36,10 +41,17 @@ func main() {
 		log.Logger.Scanner.Fatalf("Log setup: %s", err)
 	}
 
-	cfg, err := config_types.LoadFile[config.Config](f.envFile)
+	cfg, err := config_types.LoadFile[config.Config](f.configFile, f.envFile)
 	if err != nil {
 		log.Logger.Scanner.Fatalf("Config: %s", err)
 	}
+	if f.printConfig {
+		err = config_types.PrintConfig(os.Stdout, cfg)
+		if err != nil {
+			log.Logger.Scanner.Fatalf("PrintConfig: %s", err)
+		}
+		return
+	}
 
 	log.Logger.Scanner.Info("Start service")
 
@@ -71,6 +83,14 @@ func main() {
 		}
 	}()
 
+	// Health checks
+	go func() {
+		err := app.RunHealth()
+		if err != nil {
+			log.Logger.Scanner.Fatalf("Health: %s", err)
+		}
+	}()
+
 	// Termination handler.
 	util.GracefulStop(app.WaitGroup(), waitTimeout, func() {
 		err = app.Stop()
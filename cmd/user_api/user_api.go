@@ -2,10 +2,12 @@ package main
 
 import (
 	"flag"
+	"os"
 	"time"
 
 	"extrnode-be/internal/pkg/config_types"
 	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/pkg/storage/clickhouse"
 	"extrnode-be/internal/pkg/util"
 	"extrnode-be/internal/user_api"
 	"extrnode-be/internal/user_api/config"
@@ -16,14 +18,20 @@ const (
 )
 
 type flags struct {
-	logLevel string
-	envFile  string
+	logLevel      string
+	envFile       string
+	configFile    string
+	printConfig   bool
+	chMigrateDown int
 }
 
 // Setup flags
 func getFlags() (f flags) {
 	flag.StringVar(&f.logLevel, "log", "info", "log level [debug|info|warn|error|crit]")
 	flag.StringVar(&f.envFile, "envFile", "", "path to .env file")
+	flag.StringVar(&f.configFile, "config", "", "path to config file [yaml|toml|json], env variables override its values")
+	flag.BoolVar(&f.printConfig, "print-config", false, "print effective config with masked secrets and exit")
+	flag.IntVar(&f.chMigrateDown, "ch-migrate-down", 0, "roll back N latest clickhouse migrations and exit")
 	flag.Parse()
 
 	return
@@ -36,10 +44,25 @@ func main() {
 		log.Logger.UserApi.Fatalf("Log setup: %s", err)
 	}
 
-	cfg, err := config_types.LoadFile[config.Config](f.envFile)
+	cfg, err := config_types.LoadFile[config.Config](f.configFile, f.envFile)
 	if err != nil {
 		log.Logger.UserApi.Fatalf("Config: %s", err)
 	}
+	if f.printConfig {
+		err = config_types.PrintConfig(os.Stdout, cfg)
+		if err != nil {
+			log.Logger.UserApi.Fatalf("PrintConfig: %s", err)
+		}
+		return
+	}
+	if f.chMigrateDown > 0 {
+		rolledBack, err := clickhouse.Rollback(cfg.CH, f.chMigrateDown)
+		if err != nil {
+			log.Logger.UserApi.Fatalf("clickhouse Rollback: %s", err)
+		}
+		log.Logger.UserApi.Infof("clickhouse: rolled back migrations: %d", rolledBack)
+		return
+	}
 
 	log.Logger.UserApi.Info("Start service")
 
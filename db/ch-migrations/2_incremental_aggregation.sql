@@ -0,0 +1,29 @@
+-- +migrate Up
+-- aggregation windows processed by each job, the last one is the job watermark
+CREATE TABLE IF NOT EXISTS aggregation_state
+(
+    job          String,
+    window_start DateTime('UTC'),
+    processed_at DateTime64(9)
+) ENGINE = ReplacingMergeTree(processed_at)
+    ORDER BY (job, window_start);
+
+CREATE TABLE IF NOT EXISTS aggregated_user_data_hourly
+(
+    user_uuid   String,
+    rpc_method  String,
+    total_req   UInt64,
+    success_req UInt64,
+    http_err    UInt64,
+    rpc_err     UInt64,
+    hour        DateTime('UTC')
+) ENGINE = ReplacingMergeTree()
+    ORDER BY (user_uuid, hour, rpc_method);
+
+-- raw stats are expired by ttl instead of delete mutations, they are kept for backfill
+ALTER TABLE stats MODIFY TTL timestamp + INTERVAL 7 DAY;
+
+-- +migrate Down
+ALTER TABLE stats REMOVE TTL;
+DROP TABLE IF EXISTS aggregated_user_data_hourly;
+DROP TABLE IF EXISTS aggregation_state;
@@ -0,0 +1,10 @@
+-- +migrate Up
+-- credits charged by proxy, requests saved before metering have no credits
+ALTER TABLE stats ADD COLUMN IF NOT EXISTS credits UInt64 DEFAULT 0;
+ALTER TABLE aggregated_user_data ADD COLUMN IF NOT EXISTS credits UInt64 DEFAULT 0;
+ALTER TABLE aggregated_user_data_hourly ADD COLUMN IF NOT EXISTS credits UInt64 DEFAULT 0;
+
+-- +migrate Down
+ALTER TABLE aggregated_user_data_hourly DROP COLUMN IF EXISTS credits;
+ALTER TABLE aggregated_user_data DROP COLUMN IF EXISTS credits;
+ALTER TABLE stats DROP COLUMN IF EXISTS credits;
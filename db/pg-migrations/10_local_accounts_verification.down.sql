@@ -0,0 +1,4 @@
+alter table public.local_accounts
+    drop column acc_verification_sent_at;
+alter table public.local_accounts
+    drop column acc_email_verified_at;
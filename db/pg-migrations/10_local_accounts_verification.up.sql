@@ -0,0 +1,5 @@
+-- emails of local accounts were trusted before, they are verified by link now
+alter table public.local_accounts
+    add acc_email_verified_at timestamptz;
+alter table public.local_accounts
+    add acc_verification_sent_at timestamptz;
@@ -0,0 +1,12 @@
+-- credits of rpc methods are shared by proxy charging requests and user api returning usage
+create table public.method_credits
+(
+    -- '*' sets credits of methods without own row
+    mcr_method  varchar(64)
+        constraint method_credits_pk
+            primary key,
+    mcr_credits bigint not null
+);
+
+insert into public.method_credits (mcr_method, mcr_credits)
+values ('*', 1);
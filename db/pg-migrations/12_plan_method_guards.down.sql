@@ -0,0 +1,2 @@
+alter table public.plans
+    drop column pln_lift_method_guards;
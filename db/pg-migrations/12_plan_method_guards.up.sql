@@ -0,0 +1,3 @@
+-- keys of plan may send requests rejected by method guards of proxy: unfiltered getProgramAccounts, large signatures limits and blocks ranges
+alter table public.plans
+    add pln_lift_method_guards boolean default false not null;
@@ -0,0 +1,16 @@
+delete
+from public.api_token_policies
+where key_id is not null;
+drop index public.api_token_policies_key_id_uindex;
+drop index public.api_token_policies_usr_id_uindex;
+alter table public.api_token_policies
+    drop constraint api_token_policies_owner_check;
+alter table public.api_token_policies
+    drop column key_id;
+alter table public.api_token_policies
+    drop column pol_id;
+alter table public.api_token_policies
+    alter column usr_id set not null;
+alter table public.api_token_policies
+    add constraint api_token_policies_pk
+        primary key (usr_id);
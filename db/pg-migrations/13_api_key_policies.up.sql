@@ -0,0 +1,21 @@
+-- policy of user is default for its keys, policy of key replaces it
+alter table public.api_token_policies
+    drop constraint api_token_policies_pk;
+alter table public.api_token_policies
+    alter column usr_id drop not null;
+alter table public.api_token_policies
+    add pol_id bigserial
+        constraint api_token_policies_pk
+            primary key;
+alter table public.api_token_policies
+    add key_id bigint
+        constraint api_token_policies_api_keys_key_id_fk
+            references public.api_keys
+            on update cascade on delete cascade;
+alter table public.api_token_policies
+    add constraint api_token_policies_owner_check
+        check ((usr_id is null) <> (key_id is null));
+create unique index api_token_policies_usr_id_uindex
+    on public.api_token_policies (usr_id);
+create unique index api_token_policies_key_id_uindex
+    on public.api_token_policies (key_id);
@@ -0,0 +1,14 @@
+alter table public.organizations
+    drop column org_allowed_origins;
+
+delete
+from public.api_token_policies
+where org_id is not null;
+drop index public.api_token_policies_org_id_uindex;
+alter table public.api_token_policies
+    drop constraint api_token_policies_owner_check;
+alter table public.api_token_policies
+    add constraint api_token_policies_owner_check
+        check ((usr_id is null) <> (key_id is null));
+alter table public.api_token_policies
+    drop column org_id;
@@ -0,0 +1,17 @@
+-- policy of organization is default for its keys, policy of key replaces it
+alter table public.api_token_policies
+    add org_id bigint
+        constraint api_token_policies_organizations_org_id_fk
+            references public.organizations
+            on update cascade on delete cascade;
+alter table public.api_token_policies
+    drop constraint api_token_policies_owner_check;
+alter table public.api_token_policies
+    add constraint api_token_policies_owner_check
+        check (num_nonnulls(usr_id, key_id, org_id) = 1);
+create unique index api_token_policies_org_id_uindex
+    on public.api_token_policies (org_id);
+
+-- browsers are not allowed to use keys of organization until origins are set
+alter table public.organizations
+    add org_allowed_origins text[] default '{}' not null;
@@ -0,0 +1 @@
+drop table public.api_token_policies;
\ No newline at end of file
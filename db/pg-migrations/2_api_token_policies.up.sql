@@ -0,0 +1,14 @@
+create table public.api_token_policies
+(
+    usr_id                    bigint                not null
+        constraint api_token_policies_pk
+            primary key
+        constraint api_token_policies_users_usr_id_fk
+            references public.users
+            on update cascade on delete cascade,
+    pol_allowed_methods       text[]  default '{}'  not null,
+    pol_denied_methods        text[]  default '{}'  not null,
+    pol_allowed_program_ids   text[]  default '{}'  not null,
+    pol_denied_encodings      text[]  default '{}'  not null,
+    pol_max_data_slice_length integer default 0     not null
+);
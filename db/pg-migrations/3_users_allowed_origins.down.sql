@@ -0,0 +1,2 @@
+alter table public.users
+    drop column usr_allowed_origins;
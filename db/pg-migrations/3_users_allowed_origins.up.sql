@@ -0,0 +1,2 @@
+alter table public.users
+    add usr_allowed_origins text[] default '{}' not null;
@@ -0,0 +1,13 @@
+alter table public.users
+    add usr_api_token uuid;
+update public.users
+set usr_api_token = (select key_token from public.api_keys where api_keys.usr_id = users.usr_id order by key_id limit 1);
+update public.users
+set usr_api_token = md5(random()::text || usr_id)::uuid
+where usr_api_token is null;
+alter table public.users
+    alter column usr_api_token set not null;
+create unique index users_usr_api_token_uindex
+    on public.users (usr_api_token);
+
+drop table public.api_keys;
@@ -0,0 +1,27 @@
+create table public.api_keys
+(
+    key_id           bigserial
+        constraint api_keys_pk
+            primary key,
+    usr_id           bigint                    not null
+        constraint api_keys_users_usr_id_fk
+            references public.users
+            on update cascade on delete cascade,
+    key_name         varchar(64)               not null,
+    key_token        uuid                      not null,
+    key_created_at   timestamptz default now() not null,
+    key_expires_at   timestamptz,
+    key_revoked_at   timestamptz,
+    key_last_used_at timestamptz
+);
+create unique index api_keys_key_token_uindex
+    on public.api_keys (key_token);
+create index api_keys_usr_id_index
+    on public.api_keys (usr_id);
+
+insert into public.api_keys (usr_id, key_name, key_token)
+select usr_id, 'default', usr_api_token
+from public.users;
+
+alter table public.users
+    drop column usr_api_token;
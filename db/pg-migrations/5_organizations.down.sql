@@ -0,0 +1,16 @@
+delete
+from public.api_keys
+where org_id is not null;
+alter table public.api_keys
+    drop constraint api_keys_owner_check;
+alter table public.api_keys
+    drop column org_id;
+alter table public.api_keys
+    alter column usr_id set not null;
+
+drop table public.organization_invitations;
+drop table public.organization_members;
+drop table public.organizations;
+
+alter table public.users
+    drop column usr_email;
@@ -0,0 +1,69 @@
+alter table public.users
+    add usr_email varchar(320);
+
+create table public.organizations
+(
+    org_id         bigserial
+        constraint organizations_pk
+            primary key,
+    org_name       varchar(64)               not null,
+    org_created_at timestamptz default now() not null
+);
+
+create table public.organization_members
+(
+    org_id         bigint                    not null
+        constraint organization_members_organizations_org_id_fk
+            references public.organizations
+            on update cascade on delete cascade,
+    usr_id         bigint                    not null
+        constraint organization_members_users_usr_id_fk
+            references public.users
+            on update cascade on delete cascade,
+    mem_role       varchar(16)               not null
+        constraint organization_members_mem_role_check
+            check (mem_role in ('owner', 'admin', 'viewer')),
+    mem_created_at timestamptz default now() not null,
+    constraint organization_members_pk
+        primary key (org_id, usr_id)
+);
+create index organization_members_usr_id_index
+    on public.organization_members (usr_id);
+
+create table public.organization_invitations
+(
+    inv_id         bigserial
+        constraint organization_invitations_pk
+            primary key,
+    org_id         bigint                    not null
+        constraint organization_invitations_organizations_org_id_fk
+            references public.organizations
+            on update cascade on delete cascade,
+    inv_email      varchar(320)              not null,
+    inv_role       varchar(16)               not null
+        constraint organization_invitations_inv_role_check
+            check (inv_role in ('owner', 'admin', 'viewer')),
+    inv_created_by bigint
+        constraint organization_invitations_users_usr_id_fk
+            references public.users
+            on update cascade on delete set null,
+    inv_created_at timestamptz default now() not null,
+    inv_expires_at timestamptz               not null
+);
+create unique index organization_invitations_org_id_inv_email_uindex
+    on public.organization_invitations (org_id, lower(inv_email));
+create index organization_invitations_inv_email_index
+    on public.organization_invitations (lower(inv_email));
+
+alter table public.api_keys
+    alter column usr_id drop not null;
+alter table public.api_keys
+    add org_id bigint
+        constraint api_keys_organizations_org_id_fk
+            references public.organizations
+            on update cascade on delete cascade;
+alter table public.api_keys
+    add constraint api_keys_owner_check
+        check ((usr_id is null) <> (org_id is null));
+create index api_keys_org_id_index
+    on public.api_keys (org_id);
@@ -0,0 +1,11 @@
+create table public.local_accounts
+(
+    acc_id            bigserial
+        constraint local_accounts_pk
+            primary key,
+    acc_email         varchar(320)              not null,
+    acc_password_hash varchar(60)               not null,
+    acc_created_at    timestamptz default now() not null
+);
+create unique index local_accounts_acc_email_uindex
+    on public.local_accounts (lower(acc_email));
@@ -0,0 +1,2 @@
+drop table public.wallet_nonces;
+drop table public.user_wallets;
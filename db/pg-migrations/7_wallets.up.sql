@@ -0,0 +1,28 @@
+create table public.user_wallets
+(
+    wlt_pubkey     varchar(44)               not null
+        constraint user_wallets_pk
+            primary key,
+    usr_id         bigint                    not null
+        constraint user_wallets_users_usr_id_fk
+            references public.users
+            on update cascade on delete cascade,
+    wlt_created_at timestamptz default now() not null
+);
+create index user_wallets_usr_id_index
+    on public.user_wallets (usr_id);
+
+create table public.wallet_nonces
+(
+    wnc_nonce      varchar(64)  not null
+        constraint wallet_nonces_pk
+            primary key,
+    wnc_pubkey     varchar(44)  not null,
+    -- set for nonces of wallet linking
+    usr_id         bigint
+        constraint wallet_nonces_users_usr_id_fk
+            references public.users
+            on update cascade on delete cascade,
+    wnc_message    text         not null,
+    wnc_expires_at timestamptz  not null
+);
@@ -0,0 +1,6 @@
+alter table public.organizations
+    drop column pln_id;
+alter table public.users
+    drop column pln_id;
+
+drop table public.plans;
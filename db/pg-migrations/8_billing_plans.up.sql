@@ -0,0 +1,32 @@
+create table public.plans
+(
+    pln_id                        bigserial
+        constraint plans_pk
+            primary key,
+    pln_name                      varchar(64)           not null,
+    -- credits included in monthly price, the rest is overage
+    pln_monthly_credits           bigint                not null,
+    pln_price_cents               bigint  default 0     not null,
+    pln_overage_cents_per_million bigint  default 0     not null,
+    -- plan of users and organizations without assigned one
+    pln_is_default                boolean default false not null
+);
+create unique index plans_pln_name_uindex
+    on public.plans (pln_name);
+create unique index plans_pln_is_default_uindex
+    on public.plans (pln_is_default)
+    where pln_is_default;
+
+insert into public.plans (pln_name, pln_monthly_credits, pln_is_default)
+values ('free', 1000000, true);
+
+alter table public.users
+    add pln_id bigint
+        constraint users_plans_pln_id_fk
+            references public.plans
+            on update cascade on delete set null;
+alter table public.organizations
+    add pln_id bigint
+        constraint organizations_plans_pln_id_fk
+            references public.plans
+            on update cascade on delete set null;
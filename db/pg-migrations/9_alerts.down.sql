@@ -0,0 +1,2 @@
+drop table public.alert_deliveries;
+drop table public.alert_rules;
@@ -0,0 +1,53 @@
+create table public.alert_rules
+(
+    alr_id             bigserial
+        constraint alert_rules_pk
+            primary key,
+    usr_id             bigint                    not null
+        constraint alert_rules_users_usr_id_fk
+            references public.users
+            on update cascade on delete cascade,
+    alr_name           varchar(64)               not null,
+    -- quota, error_rate or latency
+    alr_type           varchar(16)               not null,
+    -- percent of monthly credits, percent of failed requests or p95 latency in ms
+    alr_threshold      double precision          not null,
+    -- window of error rate and latency
+    alr_window_minutes integer default 0         not null,
+    alr_webhook_url    text                      not null,
+    alr_webhook_secret varchar(64)               not null,
+    alr_enabled        boolean default true      not null,
+    -- rule is firing from triggered event until resolved one
+    alr_firing         boolean default false     not null,
+    alr_evaluated_at   timestamptz,
+    alr_created_at     timestamptz default now() not null
+);
+create index alert_rules_usr_id_index
+    on public.alert_rules (usr_id);
+
+create table public.alert_deliveries
+(
+    dlv_id              bigserial
+        constraint alert_deliveries_pk
+            primary key,
+    alr_id              bigint                    not null
+        constraint alert_deliveries_alert_rules_alr_id_fk
+            references public.alert_rules
+            on update cascade on delete cascade,
+    dlv_event_id        uuid                      not null,
+    dlv_event           varchar(16)               not null,
+    dlv_payload         text                      not null,
+    -- pending, delivered or failed
+    dlv_status          varchar(16)               not null,
+    dlv_attempts        integer     default 0     not null,
+    dlv_response_status integer,
+    dlv_error           text,
+    dlv_next_attempt_at timestamptz default now() not null,
+    dlv_created_at      timestamptz default now() not null,
+    dlv_delivered_at    timestamptz
+);
+create index alert_deliveries_alr_id_index
+    on public.alert_deliveries (alr_id);
+create index alert_deliveries_pending_index
+    on public.alert_deliveries (dlv_next_attempt_at)
+    where dlv_status = 'pending';
@@ -0,0 +1,76 @@
+-- +migrate Up
+-- stats are saved to sqlite when it's selected as stats sink
+create table if not exists stats
+(
+    user_uuid         varchar(36)  not null,
+    request_id        varchar(36)  not null,
+    status            integer      not null,
+    execution_time_ms integer      not null,
+    endpoint          varchar(255) not null,
+    attempts          integer      not null,
+    response_time_ms  integer      not null,
+    rpc_error_code    varchar(32)  not null,
+    user_agent        text         not null,
+    rpc_method        varchar(64)  not null,
+    rpc_request_data  text         not null,
+    timestamp         NUMERIC      not null
+);
+create index if not exists stats_timestamp_index
+    on stats (timestamp);
+
+create table if not exists scanner_methods
+(
+    server_id        varchar(64) not null,
+    time             NUMERIC     not null,
+    peer             varchar(64) not null,
+    method           varchar(64) not null,
+    time_connect_ms  integer     not null,
+    time_response_ms integer     not null,
+    response_code    integer     not null,
+    response_valid   integer     not null
+);
+create index if not exists scanner_methods_time_index
+    on scanner_methods (time);
+
+create table if not exists scanner_peers
+(
+    server_id       varchar(64) not null,
+    time            NUMERIC     not null,
+    peer            varchar(64) not null,
+    time_connect_ms integer     not null,
+    is_alive        integer     not null
+);
+create index if not exists scanner_peers_time_index
+    on scanner_peers (time);
+
+create table if not exists aggregated_user_data
+(
+    user_uuid   varchar(36) not null,
+    rpc_method  varchar(64) not null,
+    total_req   integer     not null,
+    success_req integer     not null,
+    http_err    integer     not null,
+    rpc_err     integer     not null,
+    day         DATE        not null,
+    constraint aggregated_user_data_pk
+        primary key (user_uuid, rpc_method, day)
+);
+
+create table if not exists aggregated_analysis_data
+(
+    rpc_method        varchar(64) not null,
+    rpc_request_data  text        not null,
+    execution_time_ms integer     not null,
+    response_time_ms  integer     not null,
+    total_req         integer     not null,
+    day               DATE        not null,
+    constraint aggregated_analysis_data_pk
+        primary key (rpc_method, rpc_request_data, day)
+);
+
+-- +migrate Down
+drop table if exists stats;
+drop table if exists scanner_methods;
+drop table if exists scanner_peers;
+drop table if exists aggregated_user_data;
+drop table if exists aggregated_analysis_data;
@@ -0,0 +1,12 @@
+-- +migrate Up
+-- credits charged by proxy, requests saved before metering have no credits
+alter table stats
+    add credits integer default 0 not null;
+alter table aggregated_user_data
+    add credits integer default 0 not null;
+
+-- +migrate Down
+alter table aggregated_user_data
+    drop column credits;
+alter table stats
+    drop column credits;
@@ -0,0 +1,79 @@
+-- +migrate Up
+-- state changes of peers detected by scanner
+create table if not exists node_events
+(
+    nev_id          integer                          not null on conflict rollback
+        constraint node_events_pk
+            primary key autoincrement,
+    nev_uuid        varchar(36)                      not null on conflict rollback,
+    prs_id          integer                          not null on conflict rollback
+        constraint node_events_peers_prs_id_fk
+            references peers
+            on update cascade on delete cascade,
+    -- ip:port and pubkey of peer when event is detected
+    nev_endpoint    varchar(64)                      not null on conflict rollback,
+    nev_node_pubkey varchar(44) default ''           not null on conflict rollback,
+    nev_event       varchar(32)                      not null on conflict rollback,
+    -- rpc method of method events
+    nev_method      varchar(64) default ''           not null on conflict rollback,
+    nev_created_at  NUMERIC     default (DATETIME('now')) not null on conflict rollback
+);
+create index if not exists node_events_nev_endpoint_index
+    on node_events (nev_endpoint);
+create index if not exists node_events_nev_node_pubkey_index
+    on node_events (nev_node_pubkey);
+create index if not exists node_events_nev_created_at_index
+    on node_events (nev_created_at);
+
+-- webhooks of node operators, subscription matches node pubkey or ip:port
+create table if not exists node_subscriptions
+(
+    nsb_id             integer                          not null on conflict rollback
+        constraint node_subscriptions_pk
+            primary key autoincrement,
+    nsb_node_pubkey    varchar(44) default ''           not null on conflict rollback,
+    nsb_endpoint       varchar(64) default ''           not null on conflict rollback,
+    nsb_webhook_url    text                             not null on conflict rollback,
+    nsb_webhook_secret varchar(64)                      not null on conflict rollback,
+    -- manages subscription by api
+    nsb_token          varchar(36)                      not null on conflict rollback,
+    nsb_created_at     NUMERIC     default (DATETIME('now')) not null on conflict rollback
+);
+create index if not exists node_subscriptions_nsb_node_pubkey_index
+    on node_subscriptions (nsb_node_pubkey);
+create index if not exists node_subscriptions_nsb_endpoint_index
+    on node_subscriptions (nsb_endpoint);
+
+create table if not exists node_event_deliveries
+(
+    ndl_id              integer                          not null on conflict rollback
+        constraint node_event_deliveries_pk
+            primary key autoincrement,
+    nev_id              integer                          not null on conflict rollback
+        constraint node_event_deliveries_node_events_nev_id_fk
+            references node_events
+            on update cascade on delete cascade,
+    nsb_id              integer                          not null on conflict rollback
+        constraint node_event_deliveries_node_subscriptions_nsb_id_fk
+            references node_subscriptions
+            on update cascade on delete cascade,
+    -- pending, delivered or failed
+    ndl_status          varchar(16)                      not null on conflict rollback,
+    ndl_attempts        integer     default 0            not null on conflict rollback,
+    ndl_response_status integer,
+    ndl_error           text,
+    ndl_next_attempt_at NUMERIC     default (DATETIME('now')) not null on conflict rollback,
+    ndl_created_at      NUMERIC     default (DATETIME('now')) not null on conflict rollback,
+    ndl_delivered_at    NUMERIC
+);
+create index if not exists node_event_deliveries_nev_id_index
+    on node_event_deliveries (nev_id);
+create index if not exists node_event_deliveries_nsb_id_index
+    on node_event_deliveries (nsb_id);
+create index if not exists node_event_deliveries_ndl_status_ndl_next_attempt_at_index
+    on node_event_deliveries (ndl_status, ndl_next_attempt_at);
+
+-- +migrate Down
+drop table if exists node_event_deliveries;
+drop table if exists node_subscriptions;
+drop table if exists node_events;
@@ -0,0 +1,19 @@
+-- +migrate Up
+-- node events keep history of all peer transitions with previous and new values of changed fields
+alter table node_events
+    add nev_server_id varchar(64) default '' not null;
+alter table node_events
+    add nev_old_value varchar(64) default '' not null;
+alter table node_events
+    add nev_new_value varchar(64) default '' not null;
+create index if not exists node_events_prs_id_nev_created_at_index
+    on node_events (prs_id, nev_created_at);
+
+-- +migrate Down
+drop index if exists node_events_prs_id_nev_created_at_index;
+alter table node_events
+    drop column nev_new_value;
+alter table node_events
+    drop column nev_old_value;
+alter table node_events
+    drop column nev_server_id;
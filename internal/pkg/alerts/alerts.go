@@ -0,0 +1,107 @@
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"extrnode-be/internal/pkg/storage/postgres"
+	"extrnode-be/internal/pkg/webhook"
+)
+
+const (
+	// RuleTypeQuota fires when credits of the current month reach percent of plan monthly credits
+	RuleTypeQuota = "quota"
+	// RuleTypeErrorRate fires when percent of failed requests in window exceeds threshold
+	RuleTypeErrorRate = "error_rate"
+	// RuleTypeLatency fires when p95 execution time in window exceeds threshold in ms
+	RuleTypeLatency = "latency"
+
+	EventTriggered = "triggered"
+	EventResolved  = "resolved"
+	EventTest      = "test"
+
+	maxWindowMinutes = 24 * 60
+)
+
+type (
+	// Event is payload of webhook request
+	Event struct {
+		ID        uuid.UUID `json:"id"`
+		Event     string    `json:"event"`
+		CreatedAt time.Time `json:"created_at"`
+		Rule      EventRule `json:"rule"`
+		// value of rule condition when event is created
+		Value float64 `json:"value"`
+	}
+	EventRule struct {
+		ID            int64   `json:"id"`
+		Name          string  `json:"name"`
+		Type          string  `json:"type"`
+		Threshold     float64 `json:"threshold"`
+		WindowMinutes int     `json:"window_minutes"`
+	}
+)
+
+// ValidateRule checks condition and webhook url of rule
+func ValidateRule(r postgres.AlertRule) error {
+	switch r.Type {
+	case RuleTypeQuota:
+		if r.Threshold <= 0 {
+			return fmt.Errorf("threshold must be positive percent")
+		}
+	case RuleTypeErrorRate:
+		if r.Threshold < 0 || r.Threshold >= 100 {
+			return fmt.Errorf("threshold must be percent in [0, 100)")
+		}
+	case RuleTypeLatency:
+		if r.Threshold <= 0 {
+			return fmt.Errorf("threshold must be positive ms")
+		}
+	default:
+		return fmt.Errorf("unknown type: %s", r.Type)
+	}
+	if r.Type != RuleTypeQuota && (r.WindowMinutes <= 0 || r.WindowMinutes > maxWindowMinutes) {
+		return fmt.Errorf("window_minutes must be in [1, %d]", maxWindowMinutes)
+	}
+
+	if err := webhook.ValidateURL(r.WebhookURL); err != nil {
+		return fmt.Errorf("invalid webhook_url: %s", err)
+	}
+
+	return nil
+}
+
+// NewDelivery returns pending delivery of rule event
+func NewDelivery(r postgres.AlertRule, event string, value float64) (d postgres.AlertDelivery, err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return d, fmt.Errorf("uuid.NewRandom: %s", err)
+	}
+
+	payload, err := json.Marshal(Event{
+		ID:        id,
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Rule: EventRule{
+			ID:            r.ID,
+			Name:          r.Name,
+			Type:          r.Type,
+			Threshold:     r.Threshold,
+			WindowMinutes: r.WindowMinutes,
+		},
+		Value: value,
+	})
+	if err != nil {
+		return d, fmt.Errorf("json.Marshal: %s", err)
+	}
+
+	return postgres.AlertDelivery{
+		RuleID:  r.ID,
+		EventID: id,
+		Event:   event,
+		Payload: string(payload),
+	}, nil
+}
@@ -0,0 +1,238 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"extrnode-be/internal/pkg/billing"
+	"extrnode-be/internal/pkg/config_types"
+	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/pkg/storage/clickhouse"
+	"extrnode-be/internal/pkg/storage/postgres"
+	"extrnode-be/internal/pkg/webhook"
+)
+
+const deliveriesBatch = 100
+
+// Service evaluates alert rules of all users and sends webhooks of their events. Several instances may run at once:
+// event is added by the instance which changes rule state, deliveries are claimed by one instance
+type Service struct {
+	pgStorage   postgres.Storage
+	chStorage   *clickhouse.Storage
+	client      webhook.Client
+	interval    time.Duration
+	maxAttempts int
+	// closed when service is stopped by context
+	done chan struct{}
+}
+
+func New(ctx context.Context, pgStorage postgres.Storage, chStorage *clickhouse.Storage, cfg config_types.UserApiConfig) *Service {
+	s := &Service{
+		pgStorage:   pgStorage,
+		chStorage:   chStorage,
+		client:      webhook.NewClient(cfg.WebhookTimeout),
+		interval:    cfg.AlertsInterval,
+		maxAttempts: cfg.WebhookMaxAttempts,
+		done:        make(chan struct{}),
+	}
+
+	go s.start(ctx)
+
+	return s
+}
+
+// Done is closed when service is stopped by context
+func (s *Service) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Service) start(ctx context.Context) {
+	defer close(s.done)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-time.After(s.interval):
+			err := s.evaluate(time.Now())
+			if err != nil {
+				log.Logger.UserApi.Errorf("alerts evaluate: %s", err)
+			}
+			err = s.deliver(ctx)
+			if err != nil {
+				log.Logger.UserApi.Errorf("alerts deliver: %s", err)
+			}
+		}
+	}
+}
+
+// evaluate changes state of rules which condition is changed and adds deliveries of their events.
+// Error of one rule is logged, so other rules are still evaluated. Rules cover personal keys of user only
+func (s *Service) evaluate(now time.Time) error {
+	rules, err := s.pgStorage.GetEnabledAlertRules()
+	if err != nil {
+		return fmt.Errorf("GetEnabledAlertRules: %s", err)
+	}
+
+	evaluated := make([]int64, 0, len(rules))
+	var (
+		userID    int64
+		apiTokens []string
+		tokensErr error
+	)
+	for _, r := range rules {
+		// rules are ordered by user, so tokens are loaded once for user
+		if r.UserID != userID {
+			userID = r.UserID
+			apiTokens, tokensErr = s.userApiTokens(userID)
+			if tokensErr != nil {
+				log.Logger.UserApi.Errorf("alerts userApiTokens %d: %s", userID, tokensErr)
+			}
+		}
+		// rules of user aren't evaluated without tokens, otherwise they would be resolved by empty usage
+		if tokensErr != nil {
+			continue
+		}
+
+		value, firing, err := s.evaluateRule(r, apiTokens, now)
+		if err != nil {
+			log.Logger.UserApi.Errorf("alerts evaluateRule %d: %s", r.ID, err)
+			continue
+		}
+		evaluated = append(evaluated, r.ID)
+		if firing == r.Firing {
+			continue
+		}
+
+		event := EventResolved
+		if firing {
+			event = EventTriggered
+		}
+		d, err := NewDelivery(r, event, value)
+		if err != nil {
+			log.Logger.UserApi.Errorf("alerts NewDelivery %d: %s", r.ID, err)
+			continue
+		}
+		_, err = s.pgStorage.SetAlertRuleFiring(r.ID, firing, d)
+		if err != nil {
+			log.Logger.UserApi.Errorf("alerts SetAlertRuleFiring %d: %s", r.ID, err)
+		}
+	}
+
+	err = s.pgStorage.SetAlertRulesEvaluated(evaluated, now)
+	if err != nil {
+		return fmt.Errorf("SetAlertRulesEvaluated: %s", err)
+	}
+
+	return nil
+}
+
+// evaluateRule returns value of rule condition and whether it's fulfilled
+func (s *Service) evaluateRule(r postgres.AlertRule, apiTokens []string, now time.Time) (value float64, firing bool, err error) {
+	switch r.Type {
+	case RuleTypeQuota:
+		plan, isFound, err := s.pgStorage.GetPlan(postgres.ApiKeyOwner{UserID: r.UserID})
+		if err != nil {
+			return 0, false, fmt.Errorf("GetPlan: %s", err)
+		}
+		if !isFound || plan.MonthlyCredits == 0 {
+			return 0, false, nil
+		}
+		from, to := billing.MonthRange(now.UTC())
+		usage, err := s.chStorage.GetKeysUsage(apiTokens, from, to)
+		if err != nil {
+			return 0, false, fmt.Errorf("GetKeysUsage: %s", err)
+		}
+		var credits uint64
+		for _, u := range usage {
+			credits += u.Credits
+		}
+		value = float64(credits) * 100 / float64(plan.MonthlyCredits)
+
+		return value, value >= r.Threshold, nil
+
+	case RuleTypeErrorRate, RuleTypeLatency:
+		stats, err := s.chStorage.GetRecentStats(apiTokens, now.Add(-time.Duration(r.WindowMinutes)*time.Minute))
+		if err != nil {
+			return 0, false, fmt.Errorf("GetRecentStats: %s", err)
+		}
+		if stats.TotalReq == 0 {
+			return 0, false, nil
+		}
+		if r.Type == RuleTypeLatency {
+			return stats.P95, stats.P95 > r.Threshold, nil
+		}
+		value = float64(stats.TotalReq-stats.SuccessReq) * 100 / float64(stats.TotalReq)
+
+		return value, value > r.Threshold, nil
+	}
+
+	return 0, false, fmt.Errorf("unknown type: %s", r.Type)
+}
+
+// userApiTokens returns tokens of all user keys, revoked keys are included as their usage still counts in month
+func (s *Service) userApiTokens(userID int64) ([]string, error) {
+	keys, err := s.pgStorage.GetApiKeys(postgres.ApiKeyOwner{UserID: userID})
+	if err != nil {
+		return nil, fmt.Errorf("GetApiKeys: %s", err)
+	}
+	apiTokens := make([]string, 0, len(keys))
+	for _, k := range keys {
+		apiTokens = append(apiTokens, k.Token.String())
+	}
+
+	return apiTokens, nil
+}
+
+// deliver sends due deliveries until there are no more of them
+func (s *Service) deliver(ctx context.Context) error {
+	for ctx.Err() == nil {
+		// claimed deliveries are postponed until all of them may be sent
+		deliveries, err := s.pgStorage.ClaimAlertDeliveries(deliveriesBatch, deliveriesBatch*s.client.Timeout())
+		if err != nil {
+			return fmt.Errorf("ClaimAlertDeliveries: %s", err)
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+
+		for _, d := range deliveries {
+			s.send(ctx, &d)
+			err = s.pgStorage.SaveAlertDeliveryAttempt(d)
+			if err != nil {
+				return fmt.Errorf("SaveAlertDeliveryAttempt: %s", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// send posts event to webhook and sets result of the attempt
+func (s *Service) send(ctx context.Context, d *postgres.AlertDelivery) {
+	d.Attempts++
+	statusCode, err := s.client.Post(ctx, d.WebhookURL, d.WebhookSecret, d.Event, d.EventID.String(), []byte(d.Payload))
+	if statusCode != 0 {
+		d.ResponseStatus = &statusCode
+	}
+	if err == nil {
+		now := time.Now()
+		d.Status = postgres.AlertDeliveryDelivered
+		d.DeliveredAt = &now
+		d.Error = nil
+		return
+	}
+
+	errMsg := err.Error()
+	if len(errMsg) > webhook.MaxErrorLen {
+		errMsg = errMsg[:webhook.MaxErrorLen]
+	}
+	d.Error = &errMsg
+	if d.Attempts >= s.maxAttempts {
+		d.Status = postgres.AlertDeliveryFailed
+		return
+	}
+	d.NextAttemptAt = time.Now().Add(webhook.RetryDelay(d.Attempts))
+}
@@ -0,0 +1,91 @@
+package auth_providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"extrnode-be/internal/pkg/config_types"
+	"extrnode-be/internal/pkg/mailer"
+	"extrnode-be/internal/pkg/storage/postgres"
+)
+
+type (
+	// User is authenticated user. UID is stored as provider id of postgres user
+	User struct {
+		UID           string
+		Email         string
+		EmailVerified bool
+		// user is authenticated without email, e.g. by wallet signature. Email of such user isn't verified
+		IdentityVerified bool
+	}
+	// Provider verifies bearer tokens of user api requests
+	Provider interface {
+		Name() string
+		// VerifyToken returns user of valid token and token expiration
+		VerifyToken(ctx context.Context, token string) (u *User, expiresAt time.Time, err error)
+		Ping(ctx context.Context) error
+	}
+)
+
+var (
+	ErrTokenExpired = errors.New("token expired")
+	ErrTokenRevoked = errors.New("token revoked")
+	ErrTokenInvalid = errors.New("token invalid")
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// New creates provider selected by config
+func New(ctx context.Context, cfg config_types.UserApiConfig, pgStorage postgres.Storage) (Provider, error) {
+	switch cfg.AuthProvider {
+	case config_types.AuthProviderFirebase:
+		return NewFirebase(ctx, cfg.FirebaseFilePath)
+	case config_types.AuthProviderOidc:
+		return NewOidc(ctx, cfg.OidcIssuer, cfg.OidcAudience, cfg.OidcJwksUrl), nil
+	case config_types.AuthProviderLocal:
+		m, err := mailer.New(cfg.SmtpAddr, cfg.SmtpUsername, cfg.SmtpPassword, cfg.SmtpFrom)
+		if err != nil {
+			return nil, fmt.Errorf("mailer.New: %s", err)
+		}
+		return NewLocal(pgStorage, cfg.LocalTokenSecret, cfg.LocalTokenTTL, cfg.LocalSignUp, m, cfg.EmailVerificationUrl), nil
+	}
+
+	return nil, fmt.Errorf("unknown auth provider: %s", cfg.AuthProvider)
+}
+
+// Chain verifies token by providers in turn. Next provider is tried only if token is invalid for the previous one
+type Chain []Provider
+
+func (c Chain) Name() string {
+	names := make([]string, 0, len(c))
+	for _, p := range c {
+		names = append(names, p.Name())
+	}
+
+	return strings.Join(names, ",")
+}
+
+func (c Chain) VerifyToken(ctx context.Context, token string) (u *User, expiresAt time.Time, err error) {
+	err = ErrTokenInvalid
+	for _, p := range c {
+		u, expiresAt, err = p.VerifyToken(ctx, token)
+		if !errors.Is(err, ErrTokenInvalid) {
+			return u, expiresAt, err
+		}
+	}
+
+	return nil, expiresAt, err
+}
+
+func (c Chain) Ping(ctx context.Context) error {
+	for _, p := range c {
+		err := p.Ping(ctx)
+		if err != nil {
+			return fmt.Errorf("%s: %s", p.Name(), err)
+		}
+	}
+
+	return nil
+}
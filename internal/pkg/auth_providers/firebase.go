@@ -0,0 +1,75 @@
+package auth_providers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	firebase "firebase.google.com/go/v4"
+	"firebase.google.com/go/v4/auth"
+	"google.golang.org/api/option"
+)
+
+type firebaseProvider struct {
+	client *auth.Client
+}
+
+func NewFirebase(ctx context.Context, credentialsFile string) (Provider, error) {
+	opt := option.WithCredentialsFile(credentialsFile)
+	app, err := firebase.NewApp(ctx, nil, opt)
+	if err != nil {
+		return nil, fmt.Errorf("NewApp: %s", err)
+	}
+
+	client, err := app.Auth(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Auth: %s", err)
+	}
+
+	return &firebaseProvider{client: client}, nil
+}
+
+func (f *firebaseProvider) Name() string {
+	return "firebase"
+}
+
+// VerifyToken checks that token isn't revoked and loads user, so current email verification status is returned
+func (f *firebaseProvider) VerifyToken(ctx context.Context, token string) (*User, time.Time, error) {
+	tokenInfo, err := f.client.VerifyIDTokenAndCheckRevoked(ctx, token)
+	if err != nil {
+		switch {
+		case auth.IsIDTokenExpired(err):
+			return nil, time.Time{}, ErrTokenExpired
+		case auth.IsIDTokenRevoked(err):
+			return nil, time.Time{}, ErrTokenRevoked
+		case auth.IsIDTokenInvalid(err):
+			return nil, time.Time{}, ErrTokenInvalid
+		}
+		return nil, time.Time{}, fmt.Errorf("VerifyIDTokenAndCheckRevoked: %s", err)
+	}
+	if tokenInfo == nil {
+		return nil, time.Time{}, ErrTokenInvalid
+	}
+
+	user, err := f.client.GetUser(ctx, tokenInfo.UID)
+	if err != nil {
+		if auth.IsUserNotFound(err) {
+			return nil, time.Time{}, ErrUserNotFound
+		}
+		return nil, time.Time{}, fmt.Errorf("GetUser: %s", err)
+	}
+
+	return &User{
+		UID:           user.UID,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+	}, time.Unix(tokenInfo.Expires, 0), nil
+}
+
+func (f *firebaseProvider) Ping(context.Context) error {
+	if f.client == nil {
+		return fmt.Errorf("firebase auth is not initialized")
+	}
+
+	return nil
+}
@@ -0,0 +1,299 @@
+package auth_providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/bcrypt"
+
+	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/pkg/mailer"
+	"extrnode-be/internal/pkg/storage/postgres"
+)
+
+const (
+	localIssuer       = "extrnode"
+	localUIDPrefix    = "local:"
+	minPasswordLen    = 8
+	maxPasswordLen    = 72 // bcrypt ignores the rest
+	localPasswordCost = bcrypt.DefaultCost
+	// verification tokens have audience, so they can't be used as session tokens
+	localVerificationAudience = "email_verification"
+	emailVerificationTTL      = 24 * time.Hour
+	// verification email can't be requested more often
+	emailVerificationInterval = time.Minute
+)
+
+var (
+	ErrSignUpDisabled     = errors.New("sign up is disabled")
+	ErrEmailUsed          = errors.New("email is already used")
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrInvalidEmail       = errors.New("invalid email")
+	ErrInvalidPassword    = fmt.Errorf("password must be %d-%d bytes", minPasswordLen, maxPasswordLen)
+	ErrEmailVerified      = errors.New("email is already verified")
+	ErrVerificationSent   = errors.New("verification email is sent recently")
+	ErrVerificationOff    = errors.New("email verification is not configured")
+)
+
+type (
+	// Local signs in users by email and password stored in postgres and issues own tokens.
+	// Email is verified by link sent to it, token issued before verification has unverified email
+	Local struct {
+		storage  postgres.Storage
+		secret   []byte
+		tokenTTL time.Duration
+		signUp   bool
+		// nil if verification emails are not sent
+		mailer          *mailer.Mailer
+		verificationUrl string
+		// compared on unknown email, so response time doesn't disclose existing accounts
+		dummyHash []byte
+	}
+	localClaims struct {
+		jwt.RegisteredClaims
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+)
+
+func NewLocal(storage postgres.Storage, secret string, tokenTTL time.Duration, signUp bool, m *mailer.Mailer, verificationUrl string) *Local {
+	dummyHash, _ := bcrypt.GenerateFromPassword([]byte("dummy password"), localPasswordCost)
+
+	return &Local{
+		storage:         storage,
+		secret:          []byte(secret),
+		tokenTTL:        tokenTTL,
+		signUp:          signUp,
+		mailer:          m,
+		verificationUrl: verificationUrl,
+		dummyHash:       dummyHash,
+	}
+}
+
+func (l *Local) Name() string {
+	return "local"
+}
+
+func (l *Local) VerifyToken(_ context.Context, token string) (*User, time.Time, error) {
+	claims, err := l.parseToken(token, "")
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return &User{
+		UID:           claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+	}, claims.ExpiresAt.Time, nil
+}
+
+// parseToken validates token issued for the audience, session tokens have no audience
+func (l *Local) parseToken(token, audience string) (claims localClaims, err error) {
+	_, err = jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return l.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+			return claims, ErrTokenExpired
+		}
+		return claims, ErrTokenInvalid
+	}
+	if claims.Issuer != localIssuer || !strings.HasPrefix(claims.Subject, localUIDPrefix) || claims.ExpiresAt == nil {
+		return claims, ErrTokenInvalid
+	}
+	if (audience == "" && len(claims.Audience) != 0) || (audience != "" && !claims.VerifyAudience(audience, true)) {
+		return claims, ErrTokenInvalid
+	}
+
+	return claims, nil
+}
+
+func (l *Local) Ping(context.Context) error {
+	return nil
+}
+
+// SignUp creates account and returns its token
+func (l *Local) SignUp(email, password string) (token string, expiresAt time.Time, err error) {
+	if !l.signUp {
+		return "", expiresAt, ErrSignUpDisabled
+	}
+	err = validateCredentials(email, password)
+	if err != nil {
+		return "", expiresAt, err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), localPasswordCost)
+	if err != nil {
+		return "", expiresAt, fmt.Errorf("GenerateFromPassword: %s", err)
+	}
+	acc, isCreated, err := l.storage.CreateLocalAccount(email, string(hash))
+	if err != nil {
+		return "", expiresAt, fmt.Errorf("CreateLocalAccount: %s", err)
+	}
+	if !isCreated {
+		return "", expiresAt, ErrEmailUsed
+	}
+
+	_, err = l.storage.MarkLocalAccountVerificationSent(acc.ID, emailVerificationInterval)
+	if err == nil {
+		err = l.sendVerification(acc)
+	}
+	if err != nil {
+		// account is created, link can be requested again
+		log.Logger.UserApi.Errorf("local: send verification: %s", err)
+	}
+
+	return l.issueToken(acc)
+}
+
+// SendVerification sends verification link to email of account of user
+func (l *Local) SendVerification(uid string) error {
+	if l.mailer == nil {
+		return ErrVerificationOff
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(uid, localUIDPrefix), 10, 64)
+	if err != nil || !strings.HasPrefix(uid, localUIDPrefix) {
+		return ErrTokenInvalid
+	}
+
+	acc, isFound, err := l.storage.GetLocalAccount(id)
+	if err != nil {
+		return fmt.Errorf("GetLocalAccount: %s", err)
+	}
+	if !isFound {
+		return ErrTokenInvalid
+	}
+	if acc.EmailVerifiedAt != nil {
+		return ErrEmailVerified
+	}
+	isMarked, err := l.storage.MarkLocalAccountVerificationSent(acc.ID, emailVerificationInterval)
+	if err != nil {
+		return fmt.Errorf("MarkLocalAccountVerificationSent: %s", err)
+	}
+	if !isMarked {
+		return ErrVerificationSent
+	}
+
+	return l.sendVerification(acc)
+}
+
+// VerifyEmail marks email of verification token as verified and returns new token of account
+func (l *Local) VerifyEmail(verificationToken string) (token string, expiresAt time.Time, err error) {
+	claims, err := l.parseToken(verificationToken, localVerificationAudience)
+	if err != nil {
+		return "", expiresAt, err
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(claims.Subject, localUIDPrefix), 10, 64)
+	if err != nil {
+		return "", expiresAt, ErrTokenInvalid
+	}
+
+	acc, isFound, err := l.storage.VerifyLocalAccountEmail(id, claims.Email)
+	if err != nil {
+		return "", expiresAt, fmt.Errorf("VerifyLocalAccountEmail: %s", err)
+	}
+	if !isFound {
+		return "", expiresAt, ErrTokenInvalid
+	}
+
+	return l.issueToken(acc)
+}
+
+func (l *Local) sendVerification(acc postgres.LocalAccount) error {
+	if l.mailer == nil {
+		return ErrVerificationOff
+	}
+
+	now := time.Now()
+	claims := localClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    localIssuer,
+			Subject:   fmt.Sprintf("%s%d", localUIDPrefix, acc.ID),
+			Audience:  jwt.ClaimStrings{localVerificationAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(emailVerificationTTL)),
+		},
+		Email: acc.Email,
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(l.secret)
+	if err != nil {
+		return fmt.Errorf("SignedString: %s", err)
+	}
+
+	link, err := url.Parse(l.verificationUrl)
+	if err != nil {
+		return fmt.Errorf("url.Parse: %s", err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	body := fmt.Sprintf("Open the link to verify your email: %s\r\n\r\nThe link expires in %s.", link.String(), emailVerificationTTL)
+	err = l.mailer.Send(acc.Email, "Verify your email", body)
+	if err != nil {
+		return fmt.Errorf("Send: %s", err)
+	}
+
+	return nil
+}
+
+// SignIn checks password and returns token of account
+func (l *Local) SignIn(email, password string) (token string, expiresAt time.Time, err error) {
+	acc, isFound, err := l.storage.GetLocalAccountByEmail(email)
+	if err != nil {
+		return "", expiresAt, fmt.Errorf("GetLocalAccountByEmail: %s", err)
+	}
+	if !isFound {
+		_ = bcrypt.CompareHashAndPassword(l.dummyHash, []byte(password))
+		return "", expiresAt, ErrInvalidCredentials
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(acc.PasswordHash), []byte(password))
+	if err != nil {
+		return "", expiresAt, ErrInvalidCredentials
+	}
+
+	return l.issueToken(acc)
+}
+
+func (l *Local) issueToken(acc postgres.LocalAccount) (token string, expiresAt time.Time, err error) {
+	now := time.Now()
+	expiresAt = now.Add(l.tokenTTL)
+	claims := localClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    localIssuer,
+			Subject:   fmt.Sprintf("%s%d", localUIDPrefix, acc.ID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		Email:         acc.Email,
+		EmailVerified: acc.EmailVerifiedAt != nil,
+	}
+
+	token, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(l.secret)
+	if err != nil {
+		return "", expiresAt, fmt.Errorf("SignedString: %s", err)
+	}
+
+	return token, expiresAt, nil
+}
+
+func validateCredentials(email, password string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return ErrInvalidEmail
+	}
+	if len(password) < minPasswordLen || len(password) > maxPasswordLen {
+		return ErrInvalidPassword
+	}
+
+	return nil
+}
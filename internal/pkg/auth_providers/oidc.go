@@ -0,0 +1,277 @@
+package auth_providers
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"extrnode-be/internal/pkg/log"
+)
+
+const (
+	// keys are refreshed periodically and on unknown key id, but not more often than min interval
+	jwksRefreshInterval    = time.Hour
+	jwksMinRefreshInterval = time.Minute
+	jwksRequestTimeout     = 10 * time.Second
+
+	oidcDiscoveryPath = "/.well-known/openid-configuration"
+)
+
+// signing algorithms of asymmetric keys published in jwks
+var oidcSigningMethods = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "PS256", "PS384", "PS512"}
+
+type (
+	oidcProvider struct {
+		ctx      context.Context
+		issuer   string
+		audience string
+		client   *http.Client
+
+		mx sync.Mutex
+		// discovered from issuer if not set
+		jwksUrl     string
+		keys        map[string]crypto.PublicKey
+		refreshedAt time.Time
+		refreshErr  error
+	}
+	oidcClaims struct {
+		jwt.RegisteredClaims
+		Email string `json:"email"`
+		// some providers send it as string
+		EmailVerified interface{} `json:"email_verified"`
+	}
+	jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	jwk struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+)
+
+// NewOidc creates provider which validates jwt of the issuer by its jwks. Keys are loaded on first request,
+// so service starts when issuer is unavailable
+func NewOidc(ctx context.Context, issuer, audience, jwksUrl string) Provider {
+	return &oidcProvider{
+		ctx:      ctx,
+		issuer:   strings.TrimSuffix(issuer, "/"),
+		audience: audience,
+		jwksUrl:  jwksUrl,
+		client:   &http.Client{Timeout: jwksRequestTimeout},
+	}
+}
+
+func (o *oidcProvider) Name() string {
+	return "oidc"
+}
+
+func (o *oidcProvider) VerifyToken(_ context.Context, token string) (*User, time.Time, error) {
+	var claims oidcClaims
+	_, err := jwt.ParseWithClaims(token, &claims, o.keyFunc, jwt.WithValidMethods(oidcSigningMethods))
+	if err != nil {
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+			return nil, time.Time{}, ErrTokenExpired
+		}
+		if errors.Is(err, errJwksUnavailable) {
+			return nil, time.Time{}, err
+		}
+		return nil, time.Time{}, ErrTokenInvalid
+	}
+
+	// issuer may be configured with trailing slash
+	if strings.TrimSuffix(claims.Issuer, "/") != o.issuer || !claims.VerifyAudience(o.audience, true) ||
+		claims.Subject == "" || claims.ExpiresAt == nil {
+		return nil, time.Time{}, ErrTokenInvalid
+	}
+
+	return &User{
+		UID:           claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified == true || claims.EmailVerified == "true",
+	}, claims.ExpiresAt.Time, nil
+}
+
+// Ping loads keys if they aren't loaded yet
+func (o *oidcProvider) Ping(context.Context) error {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	if o.keys == nil {
+		return o.refreshKeys()
+	}
+
+	return nil
+}
+
+var errJwksUnavailable = errors.New("jwks unavailable")
+
+func (o *oidcProvider) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	key, ok := o.keys[kid]
+	if ok && time.Since(o.refreshedAt) < jwksRefreshInterval {
+		return key, nil
+	}
+
+	// key may be rotated by issuer
+	if time.Since(o.refreshedAt) >= jwksMinRefreshInterval || o.keys == nil {
+		err := o.refreshKeys()
+		if err != nil {
+			log.Logger.UserApi.Errorf("oidc: refreshKeys: %s", err)
+			if o.keys == nil {
+				return nil, errJwksUnavailable
+			}
+		}
+	}
+
+	key, ok = o.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id: %s", kid)
+	}
+
+	return key, nil
+}
+
+// refreshKeys loads keys from jwks url, old keys are kept on failure
+func (o *oidcProvider) refreshKeys() error {
+	o.refreshedAt = time.Now()
+
+	if o.jwksUrl == "" {
+		var discovery struct {
+			JwksUri string `json:"jwks_uri"`
+		}
+		err := o.getJson(o.issuer+oidcDiscoveryPath, &discovery)
+		if err != nil {
+			return fmt.Errorf("discovery: %s", err)
+		}
+		if discovery.JwksUri == "" {
+			return errors.New("discovery: empty jwks_uri")
+		}
+		o.jwksUrl = discovery.JwksUri
+	}
+
+	var set jwks
+	err := o.getJson(o.jwksUrl, &set)
+	if err != nil {
+		return fmt.Errorf("jwks: %s", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			log.Logger.UserApi.Warnf("oidc: skip key %s: %s", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return errors.New("jwks: no signing keys")
+	}
+	o.keys = keys
+
+	return nil
+}
+
+func (o *oidcProvider) getJson(url string, res interface{}) error {
+	req, err := http.NewRequestWithContext(o.ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: status %d", url, resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("n: %s", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("e: %s", err)
+		}
+		if !e.IsInt64() {
+			return nil, errors.New("e is too large")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %s", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("y: %s", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type: %s", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
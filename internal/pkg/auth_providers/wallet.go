@@ -0,0 +1,218 @@
+package auth_providers
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/golang-jwt/jwt/v4"
+
+	"extrnode-be/internal/pkg/storage/postgres"
+)
+
+const (
+	walletIssuer    = "extrnode"
+	walletUIDPrefix = "wallet:"
+	walletNonceTTL  = 5 * time.Minute
+	walletNonceLen  = 16
+)
+
+var (
+	ErrInvalidPubkey    = errors.New("invalid pubkey")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrNonceNotFound    = errors.New("nonce not found or expired")
+	ErrWalletLinked     = errors.New("wallet is linked to another user")
+)
+
+type (
+	// Wallet signs in users by signature of solana wallet and issues sessions signed by server key.
+	// Session of user linked the wallet to existing account has the account provider id, so it's the same user
+	Wallet struct {
+		storage    postgres.Storage
+		key        ed25519.PrivateKey
+		sessionTTL time.Duration
+	}
+	walletClaims struct {
+		jwt.RegisteredClaims
+		Email string `json:"email"`
+	}
+	// WalletNonce is message which must be signed by wallet
+	WalletNonce struct {
+		Nonce     string    `json:"nonce"`
+		Message   string    `json:"message"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+)
+
+func NewWallet(storage postgres.Storage, privateKey string, sessionTTL time.Duration) (*Wallet, error) {
+	key, err := solana.PrivateKeyFromBase58(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("PrivateKeyFromBase58: %s", err)
+	}
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid private key length: %d", len(key))
+	}
+
+	return &Wallet{
+		storage:    storage,
+		key:        ed25519.PrivateKey(key),
+		sessionTTL: sessionTTL,
+	}, nil
+}
+
+func (w *Wallet) Name() string {
+	return "wallet"
+}
+
+func (w *Wallet) VerifyToken(_ context.Context, token string) (*User, time.Time, error) {
+	var claims walletClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return w.key.Public(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}))
+	if err != nil {
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+			return nil, time.Time{}, ErrTokenExpired
+		}
+		return nil, time.Time{}, ErrTokenInvalid
+	}
+	if claims.Issuer != walletIssuer || claims.Subject == "" || claims.ExpiresAt == nil {
+		return nil, time.Time{}, ErrTokenInvalid
+	}
+
+	// wallet proves only the account, email of linked account may be unverified
+	return &User{
+		UID:              claims.Subject,
+		Email:            claims.Email,
+		IdentityVerified: true,
+	}, claims.ExpiresAt.Time, nil
+}
+
+func (w *Wallet) Ping(context.Context) error {
+	return nil
+}
+
+// SignInNonce issues nonce to sign in by wallet
+func (w *Wallet) SignInNonce(pubkey string) (WalletNonce, error) {
+	return w.issueNonce(pubkey, 0, "sign in with")
+}
+
+// LinkNonce issues nonce to link wallet to user
+func (w *Wallet) LinkNonce(userID int64, pubkey string) (WalletNonce, error) {
+	return w.issueNonce(pubkey, userID, "link")
+}
+
+// SignIn checks signature of nonce message and returns session of user linked to the wallet. Unknown wallet gets new user
+func (w *Wallet) SignIn(pubkey, nonce, signature string) (token string, expiresAt time.Time, err error) {
+	err = w.useNonce(pubkey, 0, nonce, signature)
+	if err != nil {
+		return "", expiresAt, err
+	}
+
+	u, err := w.storage.GetOrCreateWalletUser(pubkey, walletUIDPrefix+pubkey)
+	if err != nil {
+		return "", expiresAt, fmt.Errorf("GetOrCreateWalletUser: %s", err)
+	}
+
+	return w.issueToken(u)
+}
+
+// Link checks signature of nonce message and links wallet to user
+func (w *Wallet) Link(userID int64, pubkey, nonce, signature string) (postgres.Wallet, error) {
+	err := w.useNonce(pubkey, userID, nonce, signature)
+	if err != nil {
+		return postgres.Wallet{}, err
+	}
+
+	wallet, isLinked, err := w.storage.LinkWallet(userID, pubkey)
+	if err != nil {
+		return wallet, fmt.Errorf("LinkWallet: %s", err)
+	}
+	if !isLinked {
+		return wallet, ErrWalletLinked
+	}
+
+	return wallet, nil
+}
+
+// IsOriginWallet returns true if user is created by sign in with the wallet
+func IsOriginWallet(providerID, pubkey string) bool {
+	return providerID == walletUIDPrefix+pubkey
+}
+
+func (w *Wallet) issueNonce(pubkey string, userID int64, action string) (n WalletNonce, err error) {
+	_, err = solana.PublicKeyFromBase58(pubkey)
+	if err != nil {
+		return n, ErrInvalidPubkey
+	}
+
+	b := make([]byte, walletNonceLen)
+	_, err = rand.Read(b)
+	if err != nil {
+		return n, fmt.Errorf("rand.Read: %s", err)
+	}
+
+	n.Nonce = hex.EncodeToString(b)
+	n.ExpiresAt = time.Now().Add(walletNonceTTL).UTC().Truncate(time.Second)
+	n.Message = fmt.Sprintf("extrnode wants you to %s your Solana account:\n%s\n\nNonce: %s\nExpires At: %s",
+		action, pubkey, n.Nonce, n.ExpiresAt.Format(time.RFC3339))
+
+	err = w.storage.CreateWalletNonce(n.Nonce, pubkey, userID, n.Message, n.ExpiresAt)
+	if err != nil {
+		return n, fmt.Errorf("CreateWalletNonce: %s", err)
+	}
+
+	return n, nil
+}
+
+// useNonce checks that nonce message is signed by wallet. Nonce can be used once
+func (w *Wallet) useNonce(pubkey string, userID int64, nonce, signature string) error {
+	pk, err := solana.PublicKeyFromBase58(pubkey)
+	if err != nil {
+		return ErrInvalidPubkey
+	}
+	sig, err := solana.SignatureFromBase58(strings.TrimSpace(signature))
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	message, isFound, err := w.storage.UseWalletNonce(nonce, pubkey, userID)
+	if err != nil {
+		return fmt.Errorf("UseWalletNonce: %s", err)
+	}
+	if !isFound {
+		return ErrNonceNotFound
+	}
+	if !sig.Verify(pk, []byte(message)) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+func (w *Wallet) issueToken(u postgres.User) (token string, expiresAt time.Time, err error) {
+	now := time.Now()
+	expiresAt = now.Add(w.sessionTTL)
+	claims := walletClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    walletIssuer,
+			Subject:   u.ProviderID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		Email: u.Email,
+	}
+
+	token, err = jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims).SignedString(w.key)
+	if err != nil {
+		return "", expiresAt, fmt.Errorf("SignedString: %s", err)
+	}
+
+	return token, expiresAt, nil
+}
@@ -0,0 +1,125 @@
+package billing
+
+import (
+	"time"
+
+	"extrnode-be/internal/pkg/storage/postgres"
+)
+
+const (
+	LineTypePlan    = "plan"
+	LineTypeUsage   = "usage"
+	LineTypeOverage = "overage"
+
+	MonthLayout = "2006-01"
+
+	creditsPerMillion = 1_000_000
+)
+
+type (
+	// KeyUsage is usage of api key in month
+	KeyUsage struct {
+		ApiKeyID   int64  `json:"api_key_id"`
+		ApiKeyName string `json:"api_key_name"`
+		TotalReq   uint64 `json:"total_req"`
+		Credits    uint64 `json:"credits"`
+	}
+	// Usage is monthly usage of user or organization compared with plan
+	Usage struct {
+		Month          string        `json:"month"`
+		Plan           postgres.Plan `json:"plan"`
+		TotalReq       uint64        `json:"total_req"`
+		Credits        uint64        `json:"credits"`
+		OverageCredits uint64        `json:"overage_credits"`
+		OverageCents   uint64        `json:"overage_cents"`
+		Keys           []KeyUsage    `json:"keys"`
+	}
+	// InvoiceLine is line item of invoice. Usage lines are informational, they are charged by plan and overage lines
+	InvoiceLine struct {
+		Type        string `json:"type" csv:"type"`
+		Description string `json:"description" csv:"description"`
+		ApiKeyID    int64  `json:"api_key_id,omitempty" csv:"api_key_id"`
+		Quantity    uint64 `json:"quantity" csv:"quantity"`
+		AmountCents uint64 `json:"amount_cents" csv:"amount_cents"`
+	}
+	Invoice struct {
+		Month       string        `json:"month"`
+		PeriodStart string        `json:"period_start"`
+		PeriodEnd   string        `json:"period_end"`
+		Lines       []InvoiceLine `json:"lines"`
+		TotalCents  uint64        `json:"total_cents"`
+	}
+)
+
+// MonthRange returns the first and the last day of month
+func MonthRange(month time.Time) (from, to time.Time) {
+	from = time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	return from, from.AddDate(0, 1, -1)
+}
+
+// NewUsage sums usage of keys and calculates overage of plan
+func NewUsage(month time.Time, plan postgres.Plan, keys []KeyUsage) Usage {
+	u := Usage{
+		Month: month.Format(MonthLayout),
+		Plan:  plan,
+		Keys:  keys,
+	}
+	if u.Keys == nil {
+		u.Keys = []KeyUsage{}
+	}
+	for _, k := range keys {
+		u.TotalReq += k.TotalReq
+		u.Credits += k.Credits
+	}
+	if u.Credits > plan.MonthlyCredits {
+		u.OverageCredits = u.Credits - plan.MonthlyCredits
+		u.OverageCents = overageCents(u.OverageCredits, plan.OverageCentsPerMillion)
+	}
+
+	return u
+}
+
+// Invoice returns line items of usage: plan price, credits of each key and overage
+func (u Usage) Invoice() Invoice {
+	month, _ := time.Parse(MonthLayout, u.Month)
+	from, to := MonthRange(month)
+	inv := Invoice{
+		Month:       u.Month,
+		PeriodStart: from.Format("2006-01-02"),
+		PeriodEnd:   to.Format("2006-01-02"),
+	}
+
+	inv.Lines = append(inv.Lines, InvoiceLine{
+		Type:        LineTypePlan,
+		Description: "plan " + u.Plan.Name,
+		Quantity:    1,
+		AmountCents: u.Plan.PriceCents,
+	})
+	for _, k := range u.Keys {
+		inv.Lines = append(inv.Lines, InvoiceLine{
+			Type:        LineTypeUsage,
+			Description: "credits of api key " + k.ApiKeyName,
+			ApiKeyID:    k.ApiKeyID,
+			Quantity:    k.Credits,
+		})
+	}
+	if u.OverageCredits != 0 {
+		inv.Lines = append(inv.Lines, InvoiceLine{
+			Type:        LineTypeOverage,
+			Description: "credits above plan",
+			Quantity:    u.OverageCredits,
+			AmountCents: u.OverageCents,
+		})
+	}
+	for _, l := range inv.Lines {
+		inv.TotalCents += l.AmountCents
+	}
+
+	return inv
+}
+
+// overageCents is rounded up, so fraction of cent is charged as a cent
+func overageCents(credits, centsPerMillion uint64) uint64 {
+	return (credits*centsPerMillion + creditsPerMillion - 1) / creditsPerMillion
+}
@@ -0,0 +1,76 @@
+package billing
+
+import (
+	"fmt"
+
+	"extrnode-be/internal/pkg/storage/postgres"
+)
+
+// defaultCredits are charged when credits of other methods are not set
+const defaultCredits = 1
+
+// Meter calculates credits of rpc requests
+type Meter struct {
+	methodCredits  map[string]uint64
+	defaultCredits uint64
+}
+
+// NewMeter takes credits of methods, postgres.DefaultCreditsMethod key sets credits of other methods
+func NewMeter(methodCredits map[string]uint64) Meter {
+	m := Meter{
+		methodCredits:  make(map[string]uint64, len(methodCredits)),
+		defaultCredits: defaultCredits,
+	}
+	for method, credits := range methodCredits {
+		if method == postgres.DefaultCreditsMethod {
+			m.defaultCredits = credits
+			continue
+		}
+		m.methodCredits[method] = credits
+	}
+
+	return m
+}
+
+// LoadMeter returns meter of credits stored in postgres, they are shared by proxy and user api
+func LoadMeter(storage postgres.Storage) (Meter, error) {
+	methodCredits, err := storage.GetMethodCredits()
+	if err != nil {
+		return Meter{}, fmt.Errorf("GetMethodCredits: %s", err)
+	}
+
+	return NewMeter(methodCredits), nil
+}
+
+// MethodCredits returns credits of one request of method
+func (m Meter) MethodCredits(method string) uint64 {
+	if credits, ok := m.methodCredits[method]; ok {
+		return credits
+	}
+
+	return m.defaultCredits
+}
+
+// Credits returns credits of request, each request of batch is charged
+func (m Meter) Credits(methods []string) (credits uint64) {
+	for _, method := range methods {
+		credits += m.MethodCredits(method)
+	}
+
+	return credits
+}
+
+// DefaultCredits is charged for methods without own credits
+func (m Meter) DefaultCredits() uint64 {
+	return m.defaultCredits
+}
+
+// Methods returns methods with own credits
+func (m Meter) Methods() map[string]uint64 {
+	res := make(map[string]uint64, len(m.methodCredits))
+	for method, credits := range m.methodCredits {
+		res[method] = credits
+	}
+
+	return res
+}
@@ -3,56 +3,170 @@ package config_types
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
 )
 
-// struct field names are used for env variable names. Edit with care
+// struct field names are used for env variable names and config file keys. Edit with care.
+// Fields with secret tag are masked in printed config
 type (
 	ScannerConfig struct {
 		ThreadsNum int    `required:"true" split_words:"true"`
 		Hostname   string `required:"true" split_words:"true"`
+		// port of health and readiness checks server, 0 disables the server
+		HealthPort uint64 `required:"false" split_words:"true"`
+		// node events are sent to webhooks of subscribers, failed webhooks are retried with exponential backoff until max attempts
+		WebhookTimeout     time.Duration `default:"10s" split_words:"true"`
+		WebhookMaxAttempts int           `default:"8" split_words:"true"`
+		// finished webhook deliveries are deleted after this period, node events are kept without expiry
+		DeliveriesRetention time.Duration `default:"720h" split_words:"true"`
 	}
 	ScannerApiConfig struct {
 		Port     uint64 `required:"true" split_words:"true"`
 		CertFile string `required:"false" split_words:"true"`
+		// comma separated, wildcards are supported: https://*.example.com
+		CorsAllowOrigins []string `default:"*" split_words:"true"`
 	}
 	ProxyConfig struct {
-		Port              uint64          `required:"true" split_words:"true"`
-		MetricsPort       uint64          `required:"false" split_words:"true"`
+		Port        uint64 `required:"true" split_words:"true"`
+		MetricsPort uint64 `required:"false" split_words:"true"`
+		// enables target management api on the metrics port, passed as bearer token
+		AdminToken        string          `required:"false" split_words:"true" secret:"true"`
 		CertFile          string          `required:"false" split_words:"true"`
 		FailoverEndpoints FailoverTargets `required:"false" split_words:"true"`
+		// default allowed origins, replaced by origins of api token if they are set. Comma separated
+		CorsAllowOrigins []string `default:"*" split_words:"true"`
+		// settings below can be changed without restart, reload is triggered by SIGHUP or env file change
+		// attempts to get successful response from targets
+		MaxAttempts int `default:"5" split_words:"true"`
+		// requests per second from single ip
+		RateLimit float64 `default:"20" split_words:"true"`
+		// interval of env and certificate files modification check, 0 disables the check
+		ConfigWatchInterval time.Duration `default:"30s" split_words:"true"`
+		// connection pool settings, applied to each target separately
+		TargetMaxIdleConns    int           `default:"10" split_words:"true"`
+		TargetMaxConns        int           `default:"0" split_words:"true"` // 0 means no limit
+		TargetIdleConnTimeout time.Duration `default:"90s" split_words:"true"`
+		// responses larger than the limit (in bytes) are streamed without retry on error. 0 means no limit
+		ResponseBufferLimit int64 `default:"1048576" split_words:"true"`
+		// request limits, 0 disables the check
+		MaxRequestBodySize             int64  `default:"1048576" split_words:"true"`
+		MaxBatchLength                 int    `default:"100" split_words:"true"`
+		MaxParamsDepth                 int    `default:"10" split_words:"true"`
+		AllowUnfilteredProgramAccounts bool   `default:"true" split_words:"true"`
+		MaxSignaturesLimit             uint64 `default:"1000" split_words:"true"`
+		MaxBlocksRange                 uint64 `default:"10000" split_words:"true"`
+		// api token policies are reloaded from postgres after this interval
+		PolicyCacheTTL time.Duration `default:"1m" split_words:"true"`
+		// on stop readiness check fails first, requests are still served during drain delay,
+		// then listener is closed and in-flight requests are given drain timeout to finish
+		DrainDelay   time.Duration `default:"0" split_words:"true"`
+		DrainTimeout time.Duration `default:"10s" split_words:"true"`
+		// listen with SO_REUSEPORT, so new process can take over the port while the old one is draining (linux only)
+		ReusePort bool `default:"false" split_words:"true"`
 	}
 	UserApiConfig struct {
-		Port             uint64 `required:"true" split_words:"true"`
-		CertFile         string `required:"false" split_words:"true"`
-		FirebaseFilePath string `required:"true" split_words:"true"`
+		Port     uint64 `required:"true" split_words:"true"`
+		CertFile string `required:"false" split_words:"true"`
+		// comma separated, wildcards are supported: https://*.example.com
+		CorsAllowOrigins []string `default:"*" split_words:"true"`
+		// firebase, oidc or local
+		AuthProvider string `default:"firebase" split_words:"true"`
+		// required by firebase provider
+		FirebaseFilePath string `required:"false" split_words:"true"`
+		// oidc provider validates jwt of the issuer by its jwks. Jwks url is discovered from the issuer if empty
+		OidcIssuer   string `required:"false" split_words:"true"`
+		OidcAudience string `required:"false" split_words:"true"`
+		OidcJwksUrl  string `required:"false" split_words:"true"`
+		// local provider signs in users by email and password and issues own tokens signed by the secret
+		LocalTokenSecret string        `required:"false" split_words:"true" secret:"true"`
+		LocalTokenTTL    time.Duration `default:"24h" split_words:"true"`
+		LocalSignUp      bool          `default:"false" split_words:"true"`
+		// emails of local accounts are verified by link to this page, token is added as `token` query param
+		EmailVerificationUrl string `required:"false" split_words:"true"`
+		// smtp server host:port sending verification links, required by local provider with sign up
+		SmtpAddr     string `required:"false" split_words:"true"`
+		SmtpUsername string `required:"false" split_words:"true"`
+		SmtpPassword string `required:"false" split_words:"true" secret:"true"`
+		SmtpFrom     string `required:"false" split_words:"true"`
+		// base58 ed25519 key signing user sessions, e.g. after solana wallet sign in. Empty disables wallet sign in
+		ApiPrivateKey string        `required:"false" split_words:"true" secret:"true"`
+		SessionTTL    time.Duration `default:"24h" split_words:"true"`
+		// alert rules are evaluated by clickhouse stats with this interval, 0 disables alerts
+		AlertsInterval time.Duration `default:"1m" split_words:"true"`
+		// failed webhooks are retried with exponential backoff until max attempts
+		WebhookTimeout     time.Duration `default:"10s" split_words:"true"`
+		WebhookMaxAttempts int           `default:"8" split_words:"true"`
 	}
 )
 
-// struct field names are used for env variable names. Edit with care
+// struct field names are used for env variable names and config file keys. Edit with care
 type (
 	PostgresConfig struct {
-		Host           string `required:"true" split_words:"true"`
-		Port           uint64 `required:"true" split_words:"true"`
-		User           string `required:"true" split_words:"true"`
-		Pass           string `required:"true" split_words:"true"`
-		DB             string `required:"true" split_words:"true"`
-		MigrationsPath string `required:"true" split_words:"true"`
+		// required fields are checked in Validate, postgres is optional for proxy
+		Host           string `required:"false" split_words:"true"`
+		Port           uint64 `required:"false" split_words:"true"`
+		User           string `required:"false" split_words:"true"`
+		Pass           string `required:"false" split_words:"true" secret:"true"`
+		DB             string `required:"false" split_words:"true"`
+		MigrationsPath string `required:"false" split_words:"true"`
 	}
 	SQLiteConfig struct {
 		DBPath         string `required:"true" split_words:"true"`
 		MigrationsPath string `required:"true" split_words:"true"`
 	}
 	ClickhouseConfig struct {
-		DSN string `required:"true" split_words:"true"`
+		// empty DSN disables clickhouse
+		DSN            string `required:"false" split_words:"true" secret:"true"`
+		MigrationsPath string `default:"db/ch-migrations" split_words:"true"`
 	}
+	// StatsConfig sets where proxy and scanner stats are saved and how they are buffered
+	StatsConfig struct {
+		// clickhouse, sqlite, file or none. Clickhouse sink with empty DSN is the same as none
+		Sink string `default:"clickhouse" split_words:"true"`
+		// file sink writes newline delimited json files, which are rotated by size
+		FileDir      string `required:"false" split_words:"true"`
+		FileMaxSize  int64  `default:"104857600" split_words:"true"`
+		FileMaxFiles int    `default:"10" split_words:"true"`
+		// batch is inserted when it reaches this size or on flush interval
+		BatchSize int `default:"1000" split_words:"true"`
+		// concurrent batch inserts of each collector
+		FlushWorkers int `default:"1" split_words:"true"`
+		// max entries kept in memory by each collector
+		BufferSize int `default:"100000" split_words:"true"`
+		// drop or block new entries when buffer is full and they can't be spilled to disk
+		BufferFullPolicy string `default:"drop" split_words:"true"`
+		// entries are written to spill files before insertion and replayed on start. Empty disables spill
+		SpillDir string `required:"false" split_words:"true"`
+		// failed inserts are retried with exponential backoff up to this delay
+		RetryMaxDelay time.Duration `default:"1m" split_words:"true"`
+	}
+)
+
+const (
+	StatsSinkClickhouse = "clickhouse"
+	StatsSinkSQLite     = "sqlite"
+	StatsSinkFile       = "file"
+	StatsSinkNone       = "none"
+
+	BufferFullPolicyDrop  = "drop"
+	BufferFullPolicyBlock = "block"
+
+	AuthProviderFirebase = "firebase"
+	AuthProviderOidc     = "oidc"
+	AuthProviderLocal    = "local"
+
+	// local tokens are signed by HS256, so the secret must be long enough
+	minLocalTokenSecretLen = 32
 )
 
 type FailoverTargets []struct {
-	Url            string
-	ReqLimitHourly uint64
+	Url            string `json:"url" yaml:"url"`
+	ReqLimitHourly uint64 `json:"reqLimitHourly" yaml:"reqLimitHourly"`
 }
 
 func (f *FailoverTargets) Decode(value string) error {
@@ -67,14 +181,73 @@ type PossibleConfig interface {
 	Validate() error
 }
 
-func LoadFile[T PossibleConfig](envFile string) (c T, err error) {
+var (
+	// names of variables set in process environment before loading files. They have priority over file values
+	processEnv map[string]struct{}
+	// names of variables set from files, they are replaced on reload
+	filesEnv map[string]struct{}
+)
+
+// LoadFile loads config from env variables, env file and config file, in order of priority. Empty file paths are skipped.
+// Function can be called again to reload changed files
+func LoadFile[T PossibleConfig](configFile, envFile string) (c T, err error) {
+	if processEnv == nil {
+		processEnv = make(map[string]struct{})
+		for _, kv := range os.Environ() {
+			name, _, _ := strings.Cut(kv, "=")
+			processEnv[name] = struct{}{}
+		}
+	}
+
+	values := make(map[string]string)
+	if configFile != "" {
+		values, err = readConfigFile[T](configFile)
+		if err != nil {
+			return c, fmt.Errorf("readConfigFile (%s): %s", configFile, err)
+		}
+	}
 	if envFile != "" {
-		err = godotenv.Load(envFile)
+		envFileValues, err := godotenv.Read(envFile)
 		if err != nil {
-			return c, fmt.Errorf("godotenv.Load (%s): %s", envFile, err)
+			return c, fmt.Errorf("godotenv.Read (%s): %s", envFile, err)
 		}
+		for name, value := range envFileValues {
+			values[name] = value
+		}
+	}
+
+	err = setFilesEnv(values)
+	if err != nil {
+		return c, err
+	}
+
+	return process[T]()
+}
+
+func setFilesEnv(values map[string]string) error {
+	// values removed from files since the previous load
+	for name := range filesEnv {
+		if _, ok := values[name]; !ok {
+			os.Unsetenv(name)
+		}
+	}
+
+	filesEnv = make(map[string]struct{}, len(values))
+	for name, value := range values {
+		if _, ok := processEnv[name]; ok {
+			continue
+		}
+		err := os.Setenv(name, value)
+		if err != nil {
+			return fmt.Errorf("os.Setenv (%s): %s", name, err)
+		}
+		filesEnv[name] = struct{}{}
 	}
 
+	return nil
+}
+
+func process[T PossibleConfig]() (c T, err error) {
 	err = envconfig.Process("", &c)
 	if err != nil {
 		return c, fmt.Errorf("envconfig.Process: %s", err)
@@ -0,0 +1,217 @@
+package config_types
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config file groups values by sections named as env variable prefixes, keys are the rest of env variable names in lowercase:
+//
+//	proxy:
+//	  port: 443
+//	  failover_endpoints:
+//	    - url: http://127.0.0.1:8001
+//	      reqLimitHourly: 1000
+//	sl:
+//	  db_path: sqlite/sqlite.db
+//
+// File values are passed to envconfig as env variables, so variables set in environment or .env file override them
+// and default values are used only if value is set nowhere. Sections of other services are skipped.
+
+const secretMask = "******"
+
+// the same rules as in envconfig are used to build variable names
+var (
+	gatherRegexp  = regexp.MustCompile("([^A-Z]+|[A-Z]+[^A-Z]+|[A-Z]+)")
+	acronymRegexp = regexp.MustCompile("([A-Z]+)([A-Z][^A-Z]+)")
+)
+
+type configField struct {
+	section string
+	// env variable name
+	key    string
+	value  reflect.Value
+	secret bool
+}
+
+// configFields returns fields of config sections. Config must be a struct of section structs
+func configFields(c interface{}) (fields []configField) {
+	v := reflect.Indirect(reflect.ValueOf(c))
+	for i := 0; i < v.NumField(); i++ {
+		section := v.Field(i)
+		sectionType := v.Type().Field(i)
+		if section.Kind() != reflect.Struct {
+			continue
+		}
+
+		sectionKey := strings.ToUpper(envName(sectionType))
+		for j := 0; j < section.NumField(); j++ {
+			fieldType := section.Type().Field(j)
+			if !fieldType.IsExported() {
+				continue
+			}
+			fields = append(fields, configField{
+				section: strings.ToLower(sectionKey),
+				key:     strings.ToUpper(fmt.Sprintf("%s_%s", sectionKey, envName(fieldType))),
+				value:   section.Field(j),
+				secret:  fieldType.Tag.Get("secret") == "true",
+			})
+		}
+	}
+
+	return fields
+}
+
+func envName(f reflect.StructField) string {
+	if f.Tag.Get("split_words") != "true" {
+		return f.Name
+	}
+
+	var name []string
+	for _, words := range gatherRegexp.FindAllStringSubmatch(f.Name, -1) {
+		if m := acronymRegexp.FindStringSubmatch(words[0]); len(m) == 3 {
+			name = append(name, m[1], m[2])
+		} else {
+			name = append(name, words[0])
+		}
+	}
+
+	return strings.Join(name, "_")
+}
+
+// readConfigFile returns file values as env variables. Format is chosen by file extension
+func readConfigFile[T PossibleConfig](configFile string) (map[string]string, error) {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("ReadFile: %s", err)
+	}
+
+	sections := make(map[string]map[string]interface{})
+	switch ext := strings.ToLower(filepath.Ext(configFile)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &sections)
+	case ".toml":
+		err = toml.Unmarshal(data, &sections)
+	case ".json":
+		err = json.Unmarshal(data, &sections)
+	default:
+		return nil, fmt.Errorf("unsupported config file format: %s", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal: %s", err)
+	}
+
+	var c T
+	knownSections := make(map[string]struct{})
+	knownKeys := make(map[string]struct{})
+	for _, f := range configFields(&c) {
+		knownSections[f.section] = struct{}{}
+		knownKeys[f.key] = struct{}{}
+	}
+
+	values := make(map[string]string)
+	for section, fields := range sections {
+		// the same file may be shared by several services
+		if _, ok := knownSections[strings.ToLower(section)]; !ok {
+			continue
+		}
+		for name, value := range fields {
+			key := strings.ToUpper(fmt.Sprintf("%s_%s", section, name))
+			if _, ok := knownKeys[key]; !ok {
+				return nil, fmt.Errorf("unknown config key: %s.%s", section, name)
+			}
+
+			values[key], err = envValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %s", section, name, err)
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// envValue converts file value to env variable format: lists of scalars are comma separated, objects are json encoded
+func envValue(value interface{}) (string, error) {
+	switch typed := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return typed, nil
+	case float64:
+		// json numbers, large integers must not be formatted with exponent
+		return strconv.FormatFloat(typed, 'f', -1, 64), nil
+	case []interface{}:
+		items := make([]string, 0, len(typed))
+		for _, item := range typed {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				return jsonValue(value)
+			}
+			itemValue, err := envValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, itemValue)
+		}
+
+		return strings.Join(items, ","), nil
+	case map[string]interface{}, []map[string]interface{}:
+		return jsonValue(value)
+	default:
+		return fmt.Sprint(typed), nil
+	}
+}
+
+func jsonValue(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("json.Marshal: %s", err)
+	}
+
+	return string(data), nil
+}
+
+// PrintConfig writes effective config in yaml file format. Secrets are masked
+func PrintConfig(w io.Writer, c interface{}) error {
+	sections := make(map[string]map[string]interface{})
+	for _, f := range configFields(c) {
+		if sections[f.section] == nil {
+			sections[f.section] = make(map[string]interface{})
+		}
+		name := strings.ToLower(strings.TrimPrefix(f.key, strings.ToUpper(f.section)+"_"))
+
+		var value interface{}
+		switch typed := f.value.Interface().(type) {
+		case time.Duration:
+			value = typed.String()
+		default:
+			value = typed
+		}
+		if f.secret && !f.value.IsZero() {
+			value = secretMask
+		}
+		sections[f.section][name] = value
+	}
+
+	// map keys are sorted by encoder, so output is stable
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	err := encoder.Encode(sections)
+	if err != nil {
+		return fmt.Errorf("yaml.Encode: %s", err)
+	}
+
+	return encoder.Close()
+}
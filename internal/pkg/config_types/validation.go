@@ -1,38 +1,171 @@
 package config_types
 
 import (
+	"crypto/ed25519"
 	"errors"
 	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/gagliardetto/solana-go"
 )
 
 func (e ScannerApiConfig) Validate() error {
-	if e.Port == 0 {
-		return errors.New("invalid port")
+	if err := validatePort(e.Port); err != nil {
+		return err
+	}
+	if err := validateOptionalFile(e.CertFile); err != nil {
+		return fmt.Errorf("invalid cert file: %s", err)
+	}
+	if err := validateCorsOrigins(e.CorsAllowOrigins); err != nil {
+		return err
 	}
 
 	return nil
 }
 
 func (u UserApiConfig) Validate() error {
-	if u.Port == 0 {
-		return errors.New("invalid port")
+	if err := validatePort(u.Port); err != nil {
+		return err
+	}
+	if err := validateOptionalFile(u.CertFile); err != nil {
+		return fmt.Errorf("invalid cert file: %s", err)
+	}
+	if err := validateCorsOrigins(u.CorsAllowOrigins); err != nil {
+		return err
+	}
+
+	switch u.AuthProvider {
+	case AuthProviderFirebase:
+		if u.FirebaseFilePath == "" {
+			return errors.New("invalid firebase file path")
+		}
+		if err := validateOptionalFile(u.FirebaseFilePath); err != nil {
+			return fmt.Errorf("invalid firebase file path: %s", err)
+		}
+	case AuthProviderOidc:
+		if err := validateUrl(u.OidcIssuer, "https", "http"); err != nil {
+			return fmt.Errorf("invalid oidc issuer: %s", err)
+		}
+		if u.OidcAudience == "" {
+			return errors.New("empty oidc audience")
+		}
+		if u.OidcJwksUrl != "" {
+			if err := validateUrl(u.OidcJwksUrl, "https", "http"); err != nil {
+				return fmt.Errorf("invalid oidc jwks url: %s", err)
+			}
+		}
+	case AuthProviderLocal:
+		if len(u.LocalTokenSecret) < minLocalTokenSecretLen {
+			return fmt.Errorf("local token secret must be at least %d characters", minLocalTokenSecretLen)
+		}
+		if u.LocalTokenTTL <= 0 {
+			return errors.New("invalid local token ttl")
+		}
+		// signed up accounts can't be used until email is verified
+		if u.LocalSignUp || u.SmtpAddr != "" {
+			if _, _, err := net.SplitHostPort(u.SmtpAddr); err != nil {
+				return errors.New("invalid smtp addr")
+			}
+			if _, err := mail.ParseAddress(u.SmtpFrom); err != nil {
+				return errors.New("invalid smtp from")
+			}
+			if err := validateUrl(u.EmailVerificationUrl, "https", "http"); err != nil {
+				return fmt.Errorf("invalid email verification url: %s", err)
+			}
+		}
+	default:
+		return fmt.Errorf("invalid auth provider: %s", u.AuthProvider)
 	}
-	if u.FirebaseFilePath == "" {
-		return errors.New("invalid firebase file path")
+	if u.ApiPrivateKey != "" {
+		key, err := solana.PrivateKeyFromBase58(u.ApiPrivateKey)
+		if err != nil || len(key) != ed25519.PrivateKeySize {
+			return errors.New("invalid api private key")
+		}
+		if u.SessionTTL <= 0 {
+			return errors.New("invalid session ttl")
+		}
+	}
+	if u.AlertsInterval < 0 {
+		return errors.New("invalid alerts interval")
+	}
+	if u.AlertsInterval > 0 {
+		if u.WebhookTimeout <= 0 {
+			return errors.New("invalid webhook timeout")
+		}
+		if u.WebhookMaxAttempts <= 0 {
+			return errors.New("invalid webhook max attempts")
+		}
 	}
 
 	return nil
 }
 
 func (p ProxyConfig) Validate() error {
-	if p.Port == 0 {
-		return errors.New("invalid port")
+	if err := validatePort(p.Port); err != nil {
+		return err
+	}
+	if p.MetricsPort != 0 {
+		if err := validatePort(p.MetricsPort); err != nil {
+			return fmt.Errorf("metrics: %s", err)
+		}
+		if p.MetricsPort == p.Port {
+			return errors.New("metrics port must differ from port")
+		}
+	}
+	if err := validateOptionalFile(p.CertFile); err != nil {
+		return fmt.Errorf("invalid cert file: %s", err)
 	}
 	for _, h := range p.FailoverEndpoints {
-		if h.Url == "" {
-			return errors.New("invalid failover endpoints")
+		if err := validateUrl(h.Url, "http", "https"); err != nil {
+			return fmt.Errorf("invalid failover endpoint: %s", err)
 		}
 	}
+	if err := validateCorsOrigins(p.CorsAllowOrigins); err != nil {
+		return err
+	}
+	if p.AdminToken != "" && p.MetricsPort == 0 {
+		return errors.New("admin api requires metrics port")
+	}
+	if p.MaxAttempts <= 0 {
+		return errors.New("invalid max attempts")
+	}
+	if p.RateLimit <= 0 {
+		return errors.New("invalid rate limit")
+	}
+	if p.ConfigWatchInterval < 0 {
+		return errors.New("invalid config watch interval")
+	}
+	if p.TargetMaxIdleConns < 0 {
+		return errors.New("invalid target max idle conns")
+	}
+	if p.TargetMaxConns < 0 {
+		return errors.New("invalid target max conns")
+	}
+	if p.ResponseBufferLimit < 0 {
+		return errors.New("invalid response buffer limit")
+	}
+	if p.MaxRequestBodySize < 0 {
+		return errors.New("invalid max request body size")
+	}
+	if p.MaxBatchLength < 0 {
+		return errors.New("invalid max batch length")
+	}
+	if p.MaxParamsDepth < 0 {
+		return errors.New("invalid max params depth")
+	}
+	if p.PolicyCacheTTL <= 0 {
+		return errors.New("invalid policy cache ttl")
+	}
+	if p.DrainDelay < 0 {
+		return errors.New("invalid drain delay")
+	}
+	if p.DrainTimeout <= 0 {
+		return errors.New("invalid drain timeout")
+	}
 
 	return nil
 }
@@ -41,16 +174,88 @@ func (p SQLiteConfig) Validate() error {
 	if p.DBPath == "" {
 		return fmt.Errorf("invalid DBPath")
 	}
-	if p.MigrationsPath == "" {
-		return fmt.Errorf("invalid MigrationsPath")
+	// db file is created on start, but directory must exist
+	if err := validateDir(filepath.Dir(p.DBPath)); err != nil {
+		return fmt.Errorf("invalid DBPath: %s", err)
+	}
+	if err := validateDir(p.MigrationsPath); err != nil {
+		return fmt.Errorf("invalid MigrationsPath: %s", err)
 	}
 
 	return nil
 }
 
 func (p PostgresConfig) Validate() error {
-	if p.Port == 0 {
-		return fmt.Errorf("invalid port")
+	if p.Host == "" {
+		return fmt.Errorf("empty host")
+	}
+	if err := validatePort(p.Port); err != nil {
+		return err
+	}
+	if p.User == "" {
+		return fmt.Errorf("empty user")
+	}
+	if p.DB == "" {
+		return fmt.Errorf("empty DB")
+	}
+	if err := validateDir(p.MigrationsPath); err != nil {
+		return fmt.Errorf("invalid MigrationsPath: %s", err)
+	}
+
+	return nil
+}
+
+// empty DSN is allowed, stats are not saved in this case
+func (c ClickhouseConfig) Validate() error {
+	if c.DSN == "" {
+		return nil
+	}
+	if err := validateUrl(c.DSN, "clickhouse", "tcp", "http", "https"); err != nil {
+		// dsn may contain password, so it's not printed
+		return errors.New("invalid DSN")
+	}
+	if err := validateDir(c.MigrationsPath); err != nil {
+		return fmt.Errorf("invalid MigrationsPath: %s", err)
+	}
+
+	return nil
+}
+
+func (c StatsConfig) Validate() error {
+	switch c.Sink {
+	case StatsSinkClickhouse, StatsSinkSQLite, StatsSinkNone:
+	case StatsSinkFile:
+		if err := validateDir(c.FileDir); err != nil {
+			return fmt.Errorf("invalid file dir: %s", err)
+		}
+		if c.FileMaxSize <= 0 {
+			return errors.New("invalid file max size")
+		}
+		if c.FileMaxFiles <= 0 {
+			return errors.New("invalid file max files")
+		}
+	default:
+		return fmt.Errorf("invalid sink: %s", c.Sink)
+	}
+	if c.BatchSize <= 0 {
+		return errors.New("invalid batch size")
+	}
+	if c.FlushWorkers <= 0 {
+		return errors.New("invalid flush workers")
+	}
+	if c.BufferSize < c.BatchSize {
+		return errors.New("buffer size must not be less than batch size")
+	}
+	if c.BufferFullPolicy != BufferFullPolicyDrop && c.BufferFullPolicy != BufferFullPolicyBlock {
+		return fmt.Errorf("invalid buffer full policy: %s", c.BufferFullPolicy)
+	}
+	if c.SpillDir != "" {
+		if err := validateDir(c.SpillDir); err != nil {
+			return fmt.Errorf("invalid spill dir: %s", err)
+		}
+	}
+	if c.RetryMaxDelay <= 0 {
+		return errors.New("invalid retry max delay")
 	}
 
 	return nil
@@ -63,6 +268,85 @@ func (s ScannerConfig) Validate() error {
 	if s.Hostname == "" {
 		return fmt.Errorf("empty Hostname")
 	}
+	if s.HealthPort != 0 {
+		if err := validatePort(s.HealthPort); err != nil {
+			return fmt.Errorf("health: %s", err)
+		}
+	}
+	if s.WebhookTimeout <= 0 {
+		return errors.New("invalid webhook timeout")
+	}
+	if s.WebhookMaxAttempts <= 0 {
+		return errors.New("invalid webhook max attempts")
+	}
+	if s.DeliveriesRetention <= 0 {
+		return errors.New("invalid deliveries retention")
+	}
+
+	return nil
+}
+
+func validateCorsOrigins(origins []string) error {
+	for _, o := range origins {
+		if o == "" {
+			return errors.New("empty cors allow origin")
+		}
+	}
+
+	return nil
+}
+
+func validatePort(port uint64) error {
+	if port == 0 || port > 65535 {
+		return fmt.Errorf("invalid port: %d", port)
+	}
+
+	return nil
+}
+
+func validateUrl(rawUrl string, schemes ...string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" {
+		return fmt.Errorf("empty host: %s", rawUrl)
+	}
+	for _, s := range schemes {
+		if u.Scheme == s {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unsupported scheme: %s", u.Scheme)
+}
+
+func validateOptionalFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+
+	return nil
+}
+
+func validateDir(path string) error {
+	if path == "" {
+		return errors.New("empty path")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
+	}
 
 	return nil
 }
@@ -0,0 +1,132 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	statusOk          = "ok"
+	statusFail        = "fail"
+	statusUnavailable = "unavailable"
+	statusDraining    = "draining"
+
+	checkTimeout = 3 * time.Second
+)
+
+type (
+	// Check returns error if dependency is not available. Info is reported as is, e.g. number of targets
+	Check func(ctx context.Context) (info interface{}, err error)
+
+	// Health serves /healthz and /readyz. Liveness doesn't depend on dependencies, so orchestrator doesn't restart
+	// service because of unavailable database. Readiness fails if any required check fails or service is draining
+	Health struct {
+		mx       sync.Mutex
+		checks   []namedCheck
+		draining atomic.Bool
+	}
+	namedCheck struct {
+		name     string
+		required bool
+		check    Check
+	}
+
+	DependencyStatus struct {
+		Status   string      `json:"status"`
+		Required bool        `json:"required"`
+		Info     interface{} `json:"info,omitempty"`
+		Error    string      `json:"error,omitempty"`
+	}
+	Status struct {
+		Status       string                      `json:"status"`
+		Dependencies map[string]DependencyStatus `json:"dependencies,omitempty"`
+	}
+)
+
+func New() *Health {
+	return &Health{}
+}
+
+// AddCheck adds dependency check. Failed required check makes service not ready, others are reported only
+func (h *Health) AddCheck(name string, required bool, check Check) {
+	h.mx.Lock()
+	h.checks = append(h.checks, namedCheck{name: name, required: required, check: check})
+	h.mx.Unlock()
+}
+
+// SetDraining makes readiness fail, it's called on stop
+func (h *Health) SetDraining() {
+	h.draining.Store(true)
+}
+
+func (h *Health) IsDraining() bool {
+	return h.draining.Load()
+}
+
+func (h *Health) Register(router *echo.Echo) {
+	router.GET("/healthz", h.healthzHandler)
+	router.GET("/readyz", h.readyzHandler)
+}
+
+// healthzHandler doesn't run checks, so slow dependencies can't fail liveness
+func (h *Health) healthzHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, Status{Status: statusOk})
+}
+
+func (h *Health) readyzHandler(c echo.Context) error {
+	status, isReady := h.check(c.Request().Context())
+	if h.IsDraining() {
+		status.Status = statusDraining
+		isReady = false
+	}
+	if !isReady {
+		return c.JSON(http.StatusServiceUnavailable, status)
+	}
+
+	return c.JSON(http.StatusOK, status)
+}
+
+// check runs all checks concurrently
+func (h *Health) check(ctx context.Context) (status Status, isReady bool) {
+	h.mx.Lock()
+	checks := append([]namedCheck(nil), h.checks...)
+	h.mx.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		results = make([]DependencyStatus, len(checks))
+	)
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c namedCheck) {
+			defer wg.Done()
+			info, err := c.check(ctx)
+			results[i] = DependencyStatus{Status: statusOk, Required: c.required, Info: info}
+			if err != nil {
+				results[i].Status = statusFail
+				results[i].Error = err.Error()
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	status = Status{Status: statusOk, Dependencies: make(map[string]DependencyStatus, len(checks))}
+	isReady = true
+	for i, c := range checks {
+		status.Dependencies[c.name] = results[i]
+		if c.required && results[i].Status != statusOk {
+			status.Status = statusUnavailable
+			isReady = false
+		}
+	}
+
+	return status, isReady
+}
@@ -0,0 +1,58 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+)
+
+// Mailer sends plain text emails by smtp server. Connection is upgraded by STARTTLS if server supports it
+type Mailer struct {
+	addr string
+	from mail.Address
+	auth smtp.Auth
+}
+
+// New returns nil if smtp server isn't configured
+func New(addr, username, password, from string) (*Mailer, error) {
+	if addr == "" {
+		return nil, nil
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("SplitHostPort: %s", err)
+	}
+	fromAddr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("ParseAddress: %s", err)
+	}
+
+	m := &Mailer{addr: addr, from: *fromAddr}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return m, nil
+}
+
+func (m *Mailer) Send(to, subject, body string) error {
+	msg := strings.Join([]string{
+		"From: " + m.from.String(),
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"",
+		body,
+	}, "\r\n")
+
+	err := smtp.SendMail(m.addr, m.auth, m.from.Address, []string{to}, []byte(msg))
+	if err != nil {
+		return fmt.Errorf("SendMail: %s", err)
+	}
+
+	return nil
+}
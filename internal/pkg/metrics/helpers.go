@@ -4,6 +4,7 @@ import "github.com/labstack/echo-contrib/prometheus"
 
 const (
 	gaugeMetricType        = "gauge"
+	gaugeVecMetricType     = "gauge_vec"
 	counterVecMetricType   = "counter_vec"
 	histogramVecMetricType = "histogram_vec"
 )
@@ -17,6 +18,16 @@ func newGauge(id, name, description string) *prometheus.Metric {
 	}
 }
 
+func newGaugeVec(id, name, description string, labels []string) *prometheus.Metric {
+	return &prometheus.Metric{
+		ID:          id,
+		Name:        name,
+		Description: description,
+		Type:        gaugeVecMetricType,
+		Args:        labels,
+	}
+}
+
 func newCounter(id, name, description string, labels []string) *prometheus.Metric {
 	return &prometheus.Metric{
 		ID:          id,
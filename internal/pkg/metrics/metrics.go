@@ -11,6 +11,10 @@ import (
 const (
 	methodMetricArg = "method"
 	successArg      = "success"
+	targetArg       = "target"
+	reusedArg       = "reused"
+	reasonArg       = "reason"
+	collectorArg    = "collector"
 )
 
 // See the NewMetrics func for proper descriptions and prometheus names!
@@ -21,14 +25,26 @@ var (
 		// Gauge
 		startTime          *prometheus.Metric
 		availableEndpoints *prometheus.Metric
+		targetOpenConns    *prometheus.Metric
+		targetActiveReqs   *prometheus.Metric
+		collectorQueue     *prometheus.Metric
+		collectorSpilled   *prometheus.Metric
 
 		// Counter
 		httpResponsesTotal *prometheus.Metric
+		targetConnsTotal   *prometheus.Metric
+		rejectedReqsTotal  *prometheus.Metric
+		collectorDropped   *prometheus.Metric
 
 		// Histogram
-		executionTime    *prometheus.Metric
-		nodeResponseTime *prometheus.Metric
-		nodeAttempts     *prometheus.Metric
+		executionTime      *prometheus.Metric
+		nodeResponseTime   *prometheus.Metric
+		nodeAttempts       *prometheus.Metric
+		targetDialTime     *prometheus.Metric
+		targetTLSHandshake *prometheus.Metric
+		requestSize        *prometheus.Metric
+		responseSize       *prometheus.Metric
+		collectorFlushTime *prometheus.Metric
 	}
 
 	metricList []*prometheus.Metric
@@ -49,6 +65,34 @@ func init() {
 		"amount of available endpoints (without partners)",
 	))
 
+	initMetric(&metrics.targetOpenConns, newGaugeVec(
+		"targetOpenConns",
+		"target_open_connections",
+		"amount of open connections in target pool",
+		[]string{targetArg},
+	))
+
+	initMetric(&metrics.targetActiveReqs, newGaugeVec(
+		"targetActiveReqs",
+		"target_active_requests",
+		"amount of requests currently served by target pool, including relay of response body",
+		[]string{targetArg},
+	))
+
+	initMetric(&metrics.collectorQueue, newGaugeVec(
+		"collectorQueue",
+		"collector_queue_depth",
+		"amount of entries waiting for insertion to clickhouse in memory",
+		[]string{collectorArg},
+	))
+
+	initMetric(&metrics.collectorSpilled, newGaugeVec(
+		"collectorSpilled",
+		"collector_spilled_batches",
+		"amount of batches waiting for insertion to clickhouse in spill files only",
+		[]string{collectorArg},
+	))
+
 	basicArgs := []string{methodMetricArg, successArg}
 
 	initMetric(&metrics.httpResponsesTotal, newCounter(
@@ -58,6 +102,27 @@ func init() {
 		basicArgs,
 	))
 
+	initMetric(&metrics.targetConnsTotal, newCounter(
+		"targetConnsTotal",
+		"target_connections_total",
+		"connections taken from target pool",
+		[]string{targetArg, reusedArg},
+	))
+
+	initMetric(&metrics.rejectedReqsTotal, newCounter(
+		"rejectedReqsTotal",
+		"rejected_requests_total",
+		"requests rejected by validator limits",
+		[]string{methodMetricArg, reasonArg},
+	))
+
+	initMetric(&metrics.collectorDropped, newCounter(
+		"collectorDropped",
+		"collector_dropped_rows_total",
+		"entries dropped by collector because buffer is full",
+		[]string{collectorArg},
+	))
+
 	initMetric(&metrics.executionTime, newHistogram(
 		"executionTime",
 		"execution_time",
@@ -81,6 +146,47 @@ func init() {
 		basicArgs,
 		[]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
 	))
+
+	sizeBuckets := []float64{256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304, 16777216, 67108864}
+	initMetric(&metrics.requestSize, newHistogram(
+		"requestSize",
+		"request_size",
+		"request body size in bytes",
+		basicArgs,
+		sizeBuckets,
+	))
+
+	initMetric(&metrics.responseSize, newHistogram(
+		"responseSize",
+		"response_size",
+		"response body size in bytes, sent to user",
+		basicArgs,
+		sizeBuckets,
+	))
+
+	initMetric(&metrics.targetDialTime, newHistogram(
+		"targetDialTime",
+		"target_dial_time",
+		"the time it took to establish tcp connection to target",
+		[]string{targetArg},
+		[]float64{5, 10, 25, 50, 100, 250, 500, 1000, 2000},
+	))
+
+	initMetric(&metrics.targetTLSHandshake, newHistogram(
+		"targetTLSHandshake",
+		"target_tls_handshake_time",
+		"the time it took to perform tls handshake with target",
+		[]string{targetArg},
+		[]float64{5, 10, 25, 50, 100, 250, 500, 1000, 3000},
+	))
+
+	initMetric(&metrics.collectorFlushTime, newHistogram(
+		"collectorFlushTime",
+		"collector_flush_time",
+		"the time it took to insert batch to stats sink",
+		[]string{collectorArg, successArg},
+		[]float64{10, 50, 100, 250, 500, 1000, 3000, 10000, 30000},
+	))
 }
 
 func initMetric(dest **prometheus.Metric, metric *prometheus.Metric) {
@@ -112,6 +218,21 @@ func ObserveNodeAttempts(method string, success bool, attempts int) {
 	metrics.nodeAttempts.MetricCollector.(*prom.HistogramVec).With(l).Observe(float64(attempts))
 }
 
+func IncRejectedRequestsCnt(method, reason string) {
+	l := prom.Labels{methodMetricArg: method, reasonArg: reason}
+	metrics.rejectedReqsTotal.MetricCollector.(*prom.CounterVec).With(l).Inc()
+}
+
+func ObserveRequestSize(method string, success bool, size int) {
+	l := prom.Labels{methodMetricArg: method, successArg: fmt.Sprintf("%t", success)}
+	metrics.requestSize.MetricCollector.(*prom.HistogramVec).With(l).Observe(float64(size))
+}
+
+func ObserveResponseSize(method string, success bool, size int64) {
+	l := prom.Labels{methodMetricArg: method, successArg: fmt.Sprintf("%t", success)}
+	metrics.responseSize.MetricCollector.(*prom.HistogramVec).With(l).Observe(float64(size))
+}
+
 func IncHttpResponsesTotalCnt(method string, success bool) {
 	l := prom.Labels{methodMetricArg: method, successArg: fmt.Sprintf("%t", success)}
 	metrics.httpResponsesTotal.MetricCollector.(*prom.CounterVec).With(l).Inc()
@@ -120,3 +241,65 @@ func IncHttpResponsesTotalCnt(method string, success bool) {
 func ObserveAvailableEndpoints(amount int) {
 	metrics.availableEndpoints.MetricCollector.(prom.Gauge).Set(float64(amount))
 }
+
+func AddTargetOpenConns(target string, delta int) {
+	metrics.targetOpenConns.MetricCollector.(*prom.GaugeVec).With(prom.Labels{targetArg: target}).Add(float64(delta))
+}
+
+func AddTargetActiveReqs(target string, delta int) {
+	metrics.targetActiveReqs.MetricCollector.(*prom.GaugeVec).With(prom.Labels{targetArg: target}).Add(float64(delta))
+}
+
+func IncTargetConnsTotalCnt(target string, reused bool) {
+	l := prom.Labels{targetArg: target, reusedArg: fmt.Sprintf("%t", reused)}
+	metrics.targetConnsTotal.MetricCollector.(*prom.CounterVec).With(l).Inc()
+}
+
+func ObserveTargetDialTime(target string, d time.Duration) {
+	metrics.targetDialTime.MetricCollector.(*prom.HistogramVec).With(prom.Labels{targetArg: target}).Observe(float64(d.Milliseconds()))
+}
+
+func ObserveTargetTLSHandshake(target string, d time.Duration) {
+	metrics.targetTLSHandshake.MetricCollector.(*prom.HistogramVec).With(prom.Labels{targetArg: target}).Observe(float64(d.Milliseconds()))
+}
+
+// DeleteTargetMetrics removes series of the target which is not in the pool anymore
+func DeleteTargetMetrics(target string) {
+	l := prom.Labels{targetArg: target}
+	metrics.targetOpenConns.MetricCollector.(*prom.GaugeVec).Delete(l)
+	metrics.targetActiveReqs.MetricCollector.(*prom.GaugeVec).Delete(l)
+	metrics.targetDialTime.MetricCollector.(*prom.HistogramVec).Delete(l)
+	metrics.targetTLSHandshake.MetricCollector.(*prom.HistogramVec).Delete(l)
+	metrics.targetConnsTotal.MetricCollector.(*prom.CounterVec).DeletePartialMatch(l)
+}
+
+// collector metrics are used by scanner too, they are skipped if metrics are not registered by echo
+
+func SetCollectorQueueDepth(collector string, depth int) {
+	if metrics.collectorQueue.MetricCollector == nil {
+		return
+	}
+	metrics.collectorQueue.MetricCollector.(*prom.GaugeVec).With(prom.Labels{collectorArg: collector}).Set(float64(depth))
+}
+
+func SetCollectorSpilledBatches(collector string, batches int) {
+	if metrics.collectorSpilled.MetricCollector == nil {
+		return
+	}
+	metrics.collectorSpilled.MetricCollector.(*prom.GaugeVec).With(prom.Labels{collectorArg: collector}).Set(float64(batches))
+}
+
+func IncCollectorDroppedCnt(collector string) {
+	if metrics.collectorDropped.MetricCollector == nil {
+		return
+	}
+	metrics.collectorDropped.MetricCollector.(*prom.CounterVec).With(prom.Labels{collectorArg: collector}).Inc()
+}
+
+func ObserveCollectorFlushTime(collector string, success bool, d time.Duration) {
+	if metrics.collectorFlushTime.MetricCollector == nil {
+		return
+	}
+	l := prom.Labels{collectorArg: collector, successArg: fmt.Sprintf("%t", success)}
+	metrics.collectorFlushTime.MetricCollector.(*prom.HistogramVec).With(l).Observe(float64(d.Milliseconds()))
+}
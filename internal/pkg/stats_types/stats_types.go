@@ -0,0 +1,48 @@
+package stats_types
+
+import (
+	"time"
+)
+
+// entries saved by proxy and scanner to stats sink
+
+type Stat struct {
+	UserUUID      string
+	RequestID     string
+	Status        uint16
+	ExecutionTime int64
+	Endpoint      string
+	Attempts      uint8
+	ResponseTime  int64
+	RpcErrorCode  string
+	UserAgent     string
+	RpcMethod     string
+	// for sendTransaction - should be the programID
+	// for getSignaturesForAddress - address
+	// for getTokenAccountsByOwner - owner
+	// for getAccountInfo - account
+	// for getProgramAccounts - programID
+	RpcRequestData string
+	Timestamp      time.Time
+	// charged for the request, 0 if it isn't proxied to node
+	Credits uint64
+}
+
+type ScannerMethod struct {
+	ServerId       string
+	Time           time.Time
+	Peer           string
+	Method         string
+	TimeConnectMs  int64
+	TimeResponseMs int64
+	ResponseCode   uint16
+	ResponseValid  bool
+}
+
+type ScannerPeer struct {
+	ServerId      string
+	Time          time.Time
+	Peer          string
+	TimeConnectMs int64
+	IsAlive       bool
+}
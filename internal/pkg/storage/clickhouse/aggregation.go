@@ -0,0 +1,208 @@
+package clickhouse
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// aggregationJob aggregates stats by windows. Processed windows are saved to aggregation state,
+// so each window is aggregated once unless it's backfilled. Aggregated tables are ReplacingMergeTree,
+// so repeated aggregation of the same window replaces rows instead of duplicating them
+type aggregationJob struct {
+	name   string
+	window time.Duration
+	// query aggregates stats of [window start, window end)
+	query string
+	// deleteQuery removes aggregated rows of [window start, window end) before backfill,
+	// it's required if rows of the window aren't replaced by table key
+	deleteQuery string
+}
+
+const (
+	aggregationStateTable = "aggregation_state"
+	// stats may be inserted late, e.g. after failed inserts are retried, so window is aggregated some time after its end
+	aggregationDelay = 15 * time.Minute
+	// ttl of raw stats, see migrations
+	statsTTL = 7 * 24 * time.Hour
+)
+
+var ErrBackfillExpired = errors.New("stats of the period are expired")
+
+var aggregationJobs = []aggregationJob{
+	{
+		name:   "user_data_hourly",
+		window: time.Hour,
+		query: `INSERT INTO aggregated_user_data_hourly (user_uuid, rpc_method, total_req, success_req, http_err, rpc_err, credits, hour)
+			SELECT user_uuid,
+				rpc_method,
+				count(rpc_method),
+				count(if(rpc_error_code == '' AND status == 200 AND rpc_method != '', true, null)),
+				count(if(status != 200, true, null)),
+				count(if(rpc_error_code != '', true, null)),
+				sum(credits),
+				toStartOfHour(timestamp, 'UTC') as hour
+			FROM stats
+			WHERE timestamp >= ? AND timestamp < ?
+			GROUP BY rpc_method, user_uuid, hour`,
+	},
+	{
+		name:   "user_data_daily",
+		window: 24 * time.Hour,
+		query: `INSERT INTO aggregated_user_data (user_uuid, rpc_method, total_req, success_req, http_err, rpc_err, credits, day)
+			SELECT user_uuid,
+				rpc_method,
+				count(rpc_method),
+				count(if(rpc_error_code == '' AND status == 200 AND rpc_method != '', true, null)),
+				count(if(status != 200, true, null)),
+				count(if(rpc_error_code != '', true, null)),
+				sum(credits),
+				toDate(timestamp, 'UTC') as day
+			FROM stats
+			WHERE timestamp >= ? AND timestamp < ?
+			GROUP BY rpc_method, user_uuid, day`,
+	},
+	{
+		name:   "analysis_daily",
+		window: 24 * time.Hour,
+		query: `INSERT INTO aggregated_analysis_data (rpc_method, rpc_request_data, execution_time_ms, response_time_ms, total_req, day)
+			SELECT rpc_method,
+				rpc_request_data,
+				avg(execution_time_ms),
+				avg(response_time_ms),
+				count(rpc_method) as c,
+				toDate(timestamp, 'UTC') as day
+			FROM stats
+			WHERE timestamp >= ? AND timestamp < ?
+			GROUP BY rpc_method, rpc_request_data, day
+			ORDER BY rpc_method, c desc
+			LIMIT 100 BY rpc_method, day`,
+		// top requests of the day are changed by backfill, previous ones would be left in table.
+		// Mutation is applied to the parts existing before it, so rows inserted after it are kept
+		deleteQuery: `ALTER TABLE aggregated_analysis_data DELETE WHERE day >= toDate(?, 'UTC') AND day < toDate(?, 'UTC')`,
+	},
+}
+
+// Aggregate processes windows of each job which are completed after its watermark.
+// Without watermark job starts from the first stats in table
+func (s *Storage) Aggregate() error {
+	end := time.Now().Add(-aggregationDelay)
+	for _, job := range aggregationJobs {
+		start, err := s.aggregationWatermark(job)
+		if err != nil {
+			return fmt.Errorf("%s: aggregationWatermark: %s", job.name, err)
+		}
+		if start.IsZero() {
+			start, err = s.firstStatTime()
+			if err != nil {
+				return fmt.Errorf("%s: firstStatTime: %s", job.name, err)
+			}
+			if start.IsZero() {
+				continue
+			}
+		}
+
+		err = s.runAggregationJob(job, start, end, false)
+		if err != nil {
+			return fmt.Errorf("%s: %s", job.name, err)
+		}
+	}
+
+	return nil
+}
+
+// ValidateBackfill returns ErrBackfillExpired if any window of the period starts before raw stats ttl.
+// Aggregation of such window would replace its aggregated rows with partial data
+func (s *Storage) ValidateBackfill(from, to time.Time) error {
+	expireTime := time.Now().Add(-statsTTL)
+	for _, job := range aggregationJobs {
+		if from.UTC().Truncate(job.window).Before(expireTime) {
+			return ErrBackfillExpired
+		}
+	}
+
+	return nil
+}
+
+// Backfill processes windows of all jobs in [from, to) even if they are processed already
+func (s *Storage) Backfill(from, to time.Time) error {
+	err := s.ValidateBackfill(from, to)
+	if err != nil {
+		return err
+	}
+
+	end := time.Now().Add(-aggregationDelay)
+	if to.After(end) {
+		to = end
+	}
+	for _, job := range aggregationJobs {
+		err := s.runAggregationJob(job, from, to, true)
+		if err != nil {
+			return fmt.Errorf("%s: %s", job.name, err)
+		}
+	}
+
+	return nil
+}
+
+// runAggregationJob processes windows from the window containing start to the last window completed before end.
+// With isBackfill aggregated rows of the window are deleted before aggregation if job has delete query
+func (s *Storage) runAggregationJob(job aggregationJob, start, end time.Time, isBackfill bool) error {
+	// windows are aligned to utc hours and days
+	for windowStart := start.UTC().Truncate(job.window); !windowStart.Add(job.window).After(end); windowStart = windowStart.Add(job.window) {
+		if isBackfill && job.deleteQuery != "" {
+			_, err := s.conn.Exec(job.deleteQuery, windowStart, windowStart.Add(job.window))
+			if err != nil {
+				return fmt.Errorf("delete window %s: %s", windowStart.Format(time.RFC3339), err)
+			}
+		}
+
+		_, err := s.conn.Exec(job.query, windowStart, windowStart.Add(job.window))
+		if err != nil {
+			return fmt.Errorf("aggregate window %s: %s", windowStart.Format(time.RFC3339), err)
+		}
+
+		_, err = s.conn.Exec(fmt.Sprintf("INSERT INTO %s (job, window_start, processed_at) VALUES (?, ?, ?)", aggregationStateTable),
+			job.name, windowStart, time.Now())
+		if err != nil {
+			return fmt.Errorf("save window %s: %s", windowStart.Format(time.RFC3339), err)
+		}
+	}
+
+	return nil
+}
+
+// aggregationWatermark returns start of the next window after the last processed one, zero time if job never run
+func (s *Storage) aggregationWatermark(job aggregationJob) (time.Time, error) {
+	var (
+		processed uint64
+		last      time.Time
+	)
+	err := s.conn.QueryRow(fmt.Sprintf("SELECT count(), max(window_start) FROM %s WHERE job = ?", aggregationStateTable), job.name).
+		Scan(&processed, &last)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if processed == 0 {
+		return time.Time{}, nil
+	}
+
+	return last.Add(job.window), nil
+}
+
+// firstStatTime returns zero time if there are no stats
+func (s *Storage) firstStatTime() (time.Time, error) {
+	var (
+		total uint64
+		first time.Time
+	)
+	err := s.conn.QueryRow(`SELECT count(), min(timestamp) FROM stats`).Scan(&total, &first)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if total == 0 {
+		return time.Time{}, nil
+	}
+
+	return first, nil
+}
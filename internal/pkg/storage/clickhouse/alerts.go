@@ -0,0 +1,35 @@
+package clickhouse
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// RecentStats is usage of api tokens in the latest minutes, P95 is execution time in ms
+type RecentStats struct {
+	TotalReq   uint64
+	SuccessReq uint64
+	P95        float64
+}
+
+// GetRecentStats returns usage of api tokens since time from raw stats
+func (s *Storage) GetRecentStats(userUUIDs []string, since time.Time) (res RecentStats, err error) {
+	if len(userUUIDs) == 0 {
+		return res, nil
+	}
+
+	query := `SELECT count(), count(if(rpc_error_code == '' AND status == 200 AND rpc_method != '', true, null)), quantile(0.95)(execution_time_ms)
+		FROM stats
+		WHERE has(?, user_uuid) AND timestamp >= ?`
+	err = s.conn.QueryRow(query, userUUIDs, since).Scan(&res.TotalReq, &res.SuccessReq, &res.P95)
+	if err != nil {
+		return res, fmt.Errorf("select: %s", err)
+	}
+	// quantile of empty set is nan
+	if math.IsNaN(res.P95) {
+		res.P95 = 0
+	}
+
+	return res, nil
+}
@@ -0,0 +1,53 @@
+package clickhouse
+
+import (
+	"fmt"
+	"time"
+)
+
+// KeyUsage is usage of api token in billing period
+type KeyUsage struct {
+	UserUUID string
+	TotalReq uint64
+	Credits  uint64
+}
+
+// GetKeysUsage returns monthly rollup of api tokens in [from, to] dates. Tokens without requests are skipped.
+// Days which are not aggregated by daily job yet are taken from hourly aggregation
+func (s *Storage) GetKeysUsage(userUUIDs []string, from, to time.Time) (res []KeyUsage, err error) {
+	if len(userUUIDs) == 0 {
+		return nil, nil
+	}
+
+	query := `SELECT user_uuid, sum(total_req), sum(credits)
+	FROM (
+		SELECT user_uuid, total_req, credits
+		FROM aggregated_user_data FINAL
+		WHERE has(?, user_uuid) AND day >= toDate(?) AND day <= toDate(?)
+		UNION ALL
+		SELECT user_uuid, total_req, credits
+		FROM aggregated_user_data_hourly FINAL
+		WHERE has(?, user_uuid) AND toDate(hour, 'UTC') >= toDate(?) AND toDate(hour, 'UTC') <= toDate(?)
+			AND toDate(hour, 'UTC') > (SELECT toDate(max(window_start), 'UTC') FROM aggregation_state WHERE job = 'user_data_daily')
+	)
+	GROUP BY user_uuid
+	ORDER BY user_uuid`
+
+	fromDay, toDay := from.Format(dateLayout), to.Format(dateLayout)
+	rows, err := s.conn.Query(query, userUUIDs, fromDay, toDay, userUUIDs, fromDay, toDay)
+	if err != nil {
+		return nil, fmt.Errorf("select: %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u KeyUsage
+		err = rows.Scan(&u.UserUUID, &u.TotalReq, &u.Credits)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %s", err)
+		}
+		res = append(res, u)
+	}
+
+	return res, rows.Err()
+}
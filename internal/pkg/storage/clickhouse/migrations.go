@@ -0,0 +1,176 @@
+package clickhouse
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	migrate "github.com/rubenv/sql-migrate"
+
+	"extrnode-be/internal/pkg/log"
+)
+
+// migrations have the same format as sqlite ones. Clickhouse has no transactions and no dialect in sql-migrate,
+// so statements are executed one by one and applied migrations are tracked in migrationsTable.
+// Services are started concurrently, so migrations are applied under lock
+const (
+	migrationsTable     = "migrations"
+	migrationsLockTable = "migrations_lock"
+	// lock of crashed process expires, migrations must be applied faster
+	migrationsLockTTL = 10 * time.Minute
+	// concurrent lock requests become visible before the owner is chosen
+	migrationsLockSettleDelay = time.Second
+	migrationsLockRetryDelay  = time.Second
+)
+
+// Migrate applies up to max migrations in dir direction, all migrations if max is 0. Returns number of applied migrations
+func (s *Storage) Migrate(migrationsPath string, dir migrate.MigrationDirection, max int) (applied int, err error) {
+	source := migrate.FileMigrationSource{
+		Dir: migrationsPath,
+	}
+	migrations, err := source.FindMigrations()
+	if err != nil {
+		return 0, fmt.Errorf("FindMigrations: %s", err)
+	}
+
+	// rows are replaced by the latest applied_at, rolled back migration has applied = false
+	_, err = s.conn.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id String,
+		applied Bool,
+		applied_at DateTime64(9)
+	) ENGINE = ReplacingMergeTree(applied_at)
+	ORDER BY id`, migrationsTable))
+	if err != nil {
+		return 0, fmt.Errorf("create migrations table: %s", err)
+	}
+
+	release, err := s.lockMigrations()
+	if err != nil {
+		return 0, fmt.Errorf("lockMigrations: %s", err)
+	}
+	defer release()
+
+	appliedIDs, err := s.appliedMigrations()
+	if err != nil {
+		return 0, fmt.Errorf("appliedMigrations: %s", err)
+	}
+
+	var toApply []*migrate.Migration
+	if dir == migrate.Up {
+		for _, m := range migrations {
+			if !appliedIDs[m.Id] {
+				toApply = append(toApply, m)
+			}
+		}
+	} else {
+		for i := len(migrations) - 1; i >= 0; i-- {
+			if appliedIDs[migrations[i].Id] {
+				toApply = append(toApply, migrations[i])
+			}
+		}
+	}
+	if max > 0 && len(toApply) > max {
+		toApply = toApply[:max]
+	}
+
+	for _, m := range toApply {
+		statements := m.Up
+		if dir == migrate.Down {
+			statements = m.Down
+		}
+		for _, stmt := range statements {
+			_, err = s.conn.Exec(stmt)
+			if err != nil {
+				return applied, fmt.Errorf("migration %s: %s", m.Id, err)
+			}
+		}
+
+		_, err = s.conn.Exec(fmt.Sprintf("INSERT INTO %s (id, applied, applied_at) VALUES (?, ?, ?)", migrationsTable),
+			m.Id, dir == migrate.Up, time.Now())
+		if err != nil {
+			return applied, fmt.Errorf("save migration %s: %s", m.Id, err)
+		}
+		applied++
+	}
+
+	return applied, nil
+}
+
+func (s *Storage) appliedMigrations() (map[string]bool, error) {
+	rows, err := s.conn.Query(fmt.Sprintf("SELECT id FROM %s FINAL WHERE applied", migrationsTable))
+	if err != nil {
+		return nil, fmt.Errorf("select: %s", err)
+	}
+	defer rows.Close()
+
+	ids := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %s", err)
+		}
+		ids[id] = true
+	}
+
+	return ids, rows.Err()
+}
+
+// lockMigrations waits until lock is acquired. Clickhouse has no unique constraints, so each process inserts lock request
+// and the earliest request which is not released and not expired owns the lock
+func (s *Storage) lockMigrations() (release func(), err error) {
+	_, err = s.conn.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		owner String,
+		released Bool,
+		created_at DateTime64(3)
+	) ENGINE = MergeTree
+	ORDER BY created_at
+	TTL toDateTime(created_at) + INTERVAL 1 DAY`, migrationsLockTable))
+	if err != nil {
+		return nil, fmt.Errorf("create lock table: %s", err)
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("uuid.NewRandom: %s", err)
+	}
+	owner := id.String()
+	// server time is used, so lock requests of different hosts are ordered
+	insertQuery := fmt.Sprintf("INSERT INTO %s (owner, released, created_at) SELECT ?, ?, now64(3)", migrationsLockTable)
+	_, err = s.conn.Exec(insertQuery, owner, false)
+	if err != nil {
+		return nil, fmt.Errorf("insert lock: %s", err)
+	}
+	release = func() {
+		_, err := s.conn.Exec(insertQuery, owner, true)
+		if err != nil {
+			log.Logger.General.Errorf("clickhouse: release migrations lock: %s", err)
+		}
+	}
+	time.Sleep(migrationsLockSettleDelay)
+
+	ownerQuery := fmt.Sprintf(`SELECT owner FROM %s
+		WHERE created_at > now64(3) - INTERVAL %d SECOND
+		GROUP BY owner
+		HAVING NOT max(released)
+		ORDER BY min(created_at), owner
+		LIMIT 1`, migrationsLockTable, int(migrationsLockTTL.Seconds()))
+	deadline := time.Now().Add(migrationsLockTTL)
+	for {
+		var lockOwner string
+		err = s.conn.QueryRow(ownerQuery).Scan(&lockOwner)
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("select lock owner: %s", err)
+		}
+		if lockOwner == owner {
+			return release, nil
+		}
+		if time.Now().After(deadline) {
+			release()
+			return nil, fmt.Errorf("lock is held by %s", lockOwner)
+		}
+
+		time.Sleep(migrationsLockRetryDelay)
+	}
+}
@@ -1,75 +1,54 @@
 package clickhouse
 
 import (
-	"database/sql"
-	"fmt"
 	"time"
 
-	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/pkg/stats_types"
 )
 
-type ScannerMethod struct {
-	ServerId       string
-	Time           time.Time
-	Peer           string
-	Method         string
-	TimeConnectMs  int64
-	TimeResponseMs int64
-	ResponseCode   uint16
-	ResponseValid  bool
-}
-
-func (s *Storage) BatchInsertScannerMethods(sms []ScannerMethod) error {
+func (s *Storage) BatchInsertScannerMethods(sms []stats_types.ScannerMethod) error {
 	if len(sms) == 0 {
 		return nil
 	}
 
-	tx, err := s.conn.Begin()
-	if err != nil {
-		return fmt.Errorf("tx begin error: %s", err)
-	}
-
-	defer func() {
-		err := tx.Rollback()
-		if err != nil && err != sql.ErrTxDone {
-			log.Logger.General.Errorf("tx rollback error: %s", err)
-		}
-	}()
-
-	stmt, err := tx.Prepare(`INSERT INTO scanner_methods (
-        server_id,
-        time,
-        peer,
-        method,
-        time_connect_ms,
-        time_response_ms,
-        response_code,
-        response_valid
-	)`)
-	if err != nil {
-		return fmt.Errorf("prepare statement error: %s", err)
-	}
-
-	for _, sm := range sms {
-		_, err = stmt.Exec(
-			sm.ServerId,
-			sm.Time,
-			sm.Peer,
-			sm.Method,
-			sm.TimeConnectMs,
-			sm.TimeResponseMs,
-			sm.ResponseCode,
-			sm.ResponseValid,
-		)
-		if err != nil {
-			return fmt.Errorf("exec statement error: %s", err)
-		}
-	}
-
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("tx commit error: %s", err)
+	var (
+		serverID       = make([]string, 0, len(sms))
+		scanTime       = make([]time.Time, 0, len(sms))
+		peer           = make([]string, 0, len(sms))
+		method         = make([]string, 0, len(sms))
+		timeConnectMs  = make([]int64, 0, len(sms))
+		timeResponseMs = make([]int64, 0, len(sms))
+		responseCode   = make([]uint16, 0, len(sms))
+		responseValid  = make([]bool, 0, len(sms))
+	)
+	for _, e := range sms {
+		serverID = append(serverID, e.ServerId)
+		scanTime = append(scanTime, e.Time)
+		peer = append(peer, e.Peer)
+		method = append(method, e.Method)
+		timeConnectMs = append(timeConnectMs, e.TimeConnectMs)
+		timeResponseMs = append(timeResponseMs, e.TimeResponseMs)
+		responseCode = append(responseCode, e.ResponseCode)
+		responseValid = append(responseValid, e.ResponseValid)
 	}
 
-	return nil
+	return s.sendBatch(`INSERT INTO scanner_methods (
+		server_id,
+		time,
+		peer,
+		method,
+		time_connect_ms,
+		time_response_ms,
+		response_code,
+		response_valid
+	)`,
+		serverID,
+		scanTime,
+		peer,
+		method,
+		timeConnectMs,
+		timeResponseMs,
+		responseCode,
+		responseValid,
+	)
 }
@@ -1,104 +1,74 @@
 package clickhouse
 
 import (
-	"database/sql"
-	"fmt"
 	"time"
 
-	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/pkg/stats_types"
 )
 
-type Stat struct {
-	UserUUID      string
-	RequestID     string
-	Status        uint16
-	ExecutionTime int64
-	Endpoint      string
-	Attempts      uint8
-	ResponseTime  int64
-	RpcErrorCode  string
-	UserAgent     string
-	RpcMethod     string
-	// for sendTransaction - should be the programID
-	// for getSignaturesForAddress - address
-	// for getTokenAccountsByOwner - owner
-	// for getAccountInfo - account
-	// for getProgramAccounts - programID
-	RpcRequestData string
-	Timestamp      time.Time
-}
-
-func (s *Storage) BatchInsertStats(stats []Stat) error {
+func (s *Storage) BatchInsertStats(stats []stats_types.Stat) error {
 	if len(stats) == 0 {
 		return nil
 	}
 
-	tx, err := s.conn.Begin()
-	if err != nil {
-		return fmt.Errorf("tx begin error: %s", err)
+	var (
+		userUUID        = make([]string, 0, len(stats))
+		requestID       = make([]string, 0, len(stats))
+		status          = make([]uint16, 0, len(stats))
+		executionTimeMs = make([]int64, 0, len(stats))
+		endpoint        = make([]string, 0, len(stats))
+		attempts        = make([]uint8, 0, len(stats))
+		responseTimeMs  = make([]int64, 0, len(stats))
+		rpcErrorCode    = make([]string, 0, len(stats))
+		userAgent       = make([]string, 0, len(stats))
+		rpcMethod       = make([]string, 0, len(stats))
+		rpcRequestData  = make([]string, 0, len(stats))
+		timestamp       = make([]time.Time, 0, len(stats))
+		credits         = make([]uint64, 0, len(stats))
+	)
+	for _, e := range stats {
+		userUUID = append(userUUID, e.UserUUID)
+		requestID = append(requestID, e.RequestID)
+		status = append(status, e.Status)
+		executionTimeMs = append(executionTimeMs, e.ExecutionTime)
+		endpoint = append(endpoint, e.Endpoint)
+		attempts = append(attempts, e.Attempts)
+		responseTimeMs = append(responseTimeMs, e.ResponseTime)
+		rpcErrorCode = append(rpcErrorCode, e.RpcErrorCode)
+		userAgent = append(userAgent, e.UserAgent)
+		rpcMethod = append(rpcMethod, e.RpcMethod)
+		rpcRequestData = append(rpcRequestData, e.RpcRequestData)
+		timestamp = append(timestamp, e.Timestamp)
+		credits = append(credits, e.Credits)
 	}
 
-	defer func() {
-		err := tx.Rollback()
-		if err != nil && err != sql.ErrTxDone {
-			log.Logger.General.Errorf("tx rollback error: %s", err)
-		}
-	}()
-
-	stmt, err := tx.Prepare(`INSERT INTO stats (
+	return s.sendBatch(`INSERT INTO stats (
 		user_uuid,
-        request_id,
-        status,
-        execution_time_ms,
-        endpoint,
-        attempts,
-        response_time_ms,
-        rpc_error_code,
-        user_agent,
-        rpc_method,
-        rpc_request_data,
-        timestamp
-	)`)
-	if err != nil {
-		return fmt.Errorf("prepare statement error: %s", err)
-	}
-
-	for _, s := range stats {
-		_, err = stmt.Exec(
-			s.UserUUID,
-			s.RequestID,
-			s.Status,
-			s.ExecutionTime,
-			s.Endpoint,
-			s.Attempts,
-			s.ResponseTime,
-			s.RpcErrorCode,
-			s.UserAgent,
-			s.RpcMethod,
-			s.RpcRequestData,
-			s.Timestamp,
-		)
-		if err != nil {
-			return fmt.Errorf("exec statement error: %s", err)
-		}
-	}
-
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("tx commit error: %s", err)
-	}
-
-	return nil
-}
-
-func (s *Storage) DeleteOutdatedStats() error {
-	query := `ALTER TABLE stats DELETE
-    	WHERE toDate(now()) > toDate(timestamp);`
-
-	_, err := s.conn.Exec(query)
-	if err != nil {
-		return fmt.Errorf("exec: %s", err)
-	}
-
-	return nil
+		request_id,
+		status,
+		execution_time_ms,
+		endpoint,
+		attempts,
+		response_time_ms,
+		rpc_error_code,
+		user_agent,
+		rpc_method,
+		rpc_request_data,
+		timestamp,
+		credits
+	)`,
+		userUUID,
+		requestID,
+		status,
+		executionTimeMs,
+		endpoint,
+		attempts,
+		responseTimeMs,
+		rpcErrorCode,
+		userAgent,
+		rpcMethod,
+		rpcRequestData,
+		timestamp,
+		credits,
+	)
 }
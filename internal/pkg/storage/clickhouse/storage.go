@@ -1,25 +1,72 @@
 package clickhouse
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	migrate "github.com/rubenv/sql-migrate"
 
+	"extrnode-be/internal/pkg/config_types"
 	"extrnode-be/internal/pkg/log"
 )
 
 type Storage struct {
 	conn *sql.DB
+	// native protocol connection for batch inserts
+	nativeConn driver.Conn
 }
 
-func New(dsn string) (s *Storage, err error) {
-	if dsn == "" {
+const batchInsertTimeout = time.Minute
+
+func New(cfg config_types.ClickhouseConfig) (s *Storage, err error) {
+	if cfg.DSN == "" {
 		log.Logger.General.Infof("start without CH")
 		return nil, nil
 	}
 
+	s, err = open(cfg.DSN)
+	if err != nil {
+		return s, err
+	}
+	appliedMigrations, err := s.Migrate(cfg.MigrationsPath, migrate.Up, 0)
+	if err != nil {
+		return s, fmt.Errorf("Migrate: %s", err)
+	}
+
+	log.Logger.General.Infof("clickhouse: applied migrations: %d", appliedMigrations)
+
+	return s, nil
+}
+
+// Rollback connects without applying migrations and rolls back up to steps latest applied migrations under migrations lock.
+// Returns number of rolled back migrations
+func Rollback(cfg config_types.ClickhouseConfig, steps int) (rolledBack int, err error) {
+	if steps <= 0 {
+		return 0, fmt.Errorf("steps must be positive")
+	}
+	if cfg.DSN == "" {
+		return 0, fmt.Errorf("dsn is empty")
+	}
+
+	s, err := open(cfg.DSN)
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+
+	rolledBack, err = s.Migrate(cfg.MigrationsPath, migrate.Down, steps)
+	if err != nil {
+		return rolledBack, fmt.Errorf("Migrate: %s", err)
+	}
+
+	return rolledBack, nil
+}
+
+func open(dsn string) (s *Storage, err error) {
 	opt, err := clickhouse.ParseDSN(dsn)
 	if err != nil {
 		return s, fmt.Errorf("ParseDSN: %s", err)
@@ -35,13 +82,60 @@ func New(dsn string) (s *Storage, err error) {
 		return s, fmt.Errorf("connection ping error: %s", err)
 	}
 
-	return &Storage{conn: conn}, nil
+	nativeOpt := *opt
+	nativeOpt.MaxIdleConns = 5
+	nativeOpt.MaxOpenConns = 10
+	nativeOpt.ConnMaxLifetime = time.Hour
+	nativeConn, err := clickhouse.Open(&nativeOpt)
+	if err != nil {
+		return s, fmt.Errorf("open native connection: %s", err)
+	}
+
+	return &Storage{conn: conn, nativeConn: nativeConn}, nil
 }
 
 func (s *Storage) Close() error {
 	if s.conn == nil {
 		return nil
 	}
+	if s.nativeConn != nil {
+		err := s.nativeConn.Close()
+		if err != nil {
+			return fmt.Errorf("close native connection: %s", err)
+		}
+	}
 
 	return s.conn.Close()
 }
+
+// sendBatch inserts rows by columns, columns must be in the order of query columns
+func (s *Storage) sendBatch(query string, columns ...interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), batchInsertTimeout)
+	defer cancel()
+
+	batch, err := s.nativeConn.PrepareBatch(ctx, query)
+	if err != nil {
+		return fmt.Errorf("prepare batch error: %s", err)
+	}
+	for i, column := range columns {
+		err = batch.Column(i).Append(column)
+		if err != nil {
+			abortErr := batch.Abort()
+			if abortErr != nil {
+				log.Logger.General.Errorf("batch abort error: %s", abortErr)
+			}
+			return fmt.Errorf("append column %d error: %s", i, err)
+		}
+	}
+
+	err = batch.Send()
+	if err != nil {
+		return fmt.Errorf("send batch error: %s", err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.conn.PingContext(ctx)
+}
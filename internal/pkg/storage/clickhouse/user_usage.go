@@ -0,0 +1,123 @@
+package clickhouse
+
+import (
+	"fmt"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+type (
+	// UserUsage is usage of rpc method by day
+	UserUsage struct {
+		Day        time.Time
+		RpcMethod  string
+		TotalReq   uint64
+		SuccessReq uint64
+		HttpErr    uint64
+		RpcErr     uint64
+		Credits    uint64
+	}
+	// UserLatency is execution time percentiles in ms, empty RpcMethod means all methods
+	UserLatency struct {
+		RpcMethod string
+		P50       float64
+		P90       float64
+		P99       float64
+	}
+)
+
+// GetUserUsage returns usage of api tokens by days in [from, to] dates. Days which are not aggregated by daily job yet
+// are taken from hourly aggregation
+func (s *Storage) GetUserUsage(userUUIDs []string, from, to time.Time) (res []UserUsage, err error) {
+	if len(userUUIDs) == 0 {
+		return nil, nil
+	}
+
+	query := `SELECT day, rpc_method, sum(total_req), sum(success_req), sum(http_err), sum(rpc_err), sum(credits)
+	FROM (
+		SELECT day, rpc_method, total_req, success_req, http_err, rpc_err, credits
+		FROM aggregated_user_data FINAL
+		WHERE has(?, user_uuid) AND day >= toDate(?) AND day <= toDate(?)
+		UNION ALL
+		SELECT toDate(hour, 'UTC') as day, rpc_method, total_req, success_req, http_err, rpc_err, credits
+		FROM aggregated_user_data_hourly FINAL
+		WHERE has(?, user_uuid) AND day >= toDate(?) AND day <= toDate(?)
+			AND day > (SELECT toDate(max(window_start), 'UTC') FROM aggregation_state WHERE job = 'user_data_daily')
+	)
+	GROUP BY day, rpc_method
+	ORDER BY day, rpc_method`
+
+	fromDay, toDay := from.Format(dateLayout), to.Format(dateLayout)
+	rows, err := s.conn.Query(query, userUUIDs, fromDay, toDay, userUUIDs, fromDay, toDay)
+	if err != nil {
+		return nil, fmt.Errorf("select: %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u UserUsage
+		err = rows.Scan(&u.Day, &u.RpcMethod, &u.TotalReq, &u.SuccessReq, &u.HttpErr, &u.RpcErr, &u.Credits)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %s", err)
+		}
+		res = append(res, u)
+	}
+
+	return res, rows.Err()
+}
+
+// GetUserLatency returns execution time percentiles of api tokens in [from, to] dates, total is nil if there are no requests.
+// Raw stats are kept by ttl, so older requests are not included
+func (s *Storage) GetUserLatency(userUUIDs []string, from, to time.Time) (total *UserLatency, methods []UserLatency, err error) {
+	if len(userUUIDs) == 0 {
+		return nil, nil, nil
+	}
+
+	const query = `SELECT %s, count(), quantiles(0.5, 0.9, 0.99)(execution_time_ms)
+		FROM stats
+		WHERE has(?, user_uuid) AND toDate(timestamp, 'UTC') >= toDate(?) AND toDate(timestamp, 'UTC') <= toDate(?)`
+
+	totals, err := s.selectUserLatency(fmt.Sprintf(query, "''"), userUUIDs, from, to)
+	if err != nil {
+		return nil, nil, fmt.Errorf("total: %s", err)
+	}
+	if len(totals) != 0 {
+		total = &totals[0]
+	}
+
+	methods, err = s.selectUserLatency(fmt.Sprintf(query, "rpc_method")+" GROUP BY rpc_method ORDER BY rpc_method", userUUIDs, from, to)
+	if err != nil {
+		return nil, nil, fmt.Errorf("methods: %s", err)
+	}
+
+	return total, methods, nil
+}
+
+func (s *Storage) selectUserLatency(query string, userUUIDs []string, from, to time.Time) (res []UserLatency, err error) {
+	rows, err := s.conn.Query(query, userUUIDs, from.Format(dateLayout), to.Format(dateLayout))
+	if err != nil {
+		return nil, fmt.Errorf("select: %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			l         UserLatency
+			total     uint64
+			quantiles []float64
+		)
+		err = rows.Scan(&l.RpcMethod, &total, &quantiles)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %s", err)
+		}
+		// quantiles of empty set are nan
+		if total == 0 || len(quantiles) != 3 {
+			continue
+		}
+		l.P50, l.P90, l.P99 = quantiles[0], quantiles[1], quantiles[2]
+		res = append(res, l)
+	}
+
+	return res, rows.Err()
+}
@@ -0,0 +1,449 @@
+package delayed_insertion
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"extrnode-be/internal/pkg/config_types"
+	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/pkg/metrics"
+	"extrnode-be/internal/pkg/stats_types"
+	"extrnode-be/internal/pkg/storage/stats_sink"
+)
+
+const (
+	// aggregation is incremental, so each run processes only windows completed since the previous one
+	aggregatorInterval = time.Hour
+	// final flush on stop is retried, because entries are lost otherwise
+	finalFlushAttempts = 3
+	finalFlushDelay    = time.Second
+	// first retry delay of failed insert, doubled on each next failure
+	retryMinDelay = time.Second
+)
+
+var ErrBackfillUnsupported = errors.New("stats sink doesn't support backfill")
+
+type (
+	collectorPossibleTypes interface {
+		stats_types.Stat | stats_types.ScannerMethod | stats_types.ScannerPeer
+	}
+	// Collector buffers entries and inserts them by batches. Batch is inserted when it reaches batch size or on flush interval,
+	// several batches may be inserted concurrently by flush workers. Failed batches are retried with backoff.
+	// With spill dir every entry is written to the spill file of current batch, so batches may be released
+	// from memory when buffer is full and are replayed after restart
+	Collector[T collectorPossibleTypes] struct {
+		ctx           context.Context
+		sink          stats_sink.StatsSink
+		name          string
+		flushInterval time.Duration
+		batchSize     int
+		flushWorkers  int
+		bufferSize    int
+		blockOnFull   bool
+		spillDir      string
+		retryMaxDelay time.Duration
+		// directory of this collector inside spill dir and its lock, held until stop
+		instanceDir  string
+		instanceLock *os.File
+
+		mx    sync.Mutex
+		cache []T
+		// spill file of current batch, nil if spill is disabled or nothing is added yet
+		spillFile   *os.File
+		spillWriter *bufio.Writer
+		// some entries of current batch are not written to spill file
+		spillFailed bool
+		// batches waiting for insertion, oldest first
+		pending []*batch[T]
+		// entries kept in memory: current batch and pending batches which are not released
+		memEntries int
+		// pending batches which are released from memory
+		spilledBatches int
+		// closed and replaced when memory is freed, blocked Add waits for it
+		freed chan struct{}
+		// signals that batch size is reached
+		flushNow chan struct{}
+
+		// closed after final flush
+		done chan struct{}
+	}
+	batch[T collectorPossibleTypes] struct {
+		// nil if batch is released from memory, entries are read from spill file in this case
+		entries []T
+		// empty if batch is not completely written to spill file
+		spillPath string
+	}
+	Aggregator struct {
+		ctx  context.Context
+		sink stats_sink.AggregatingSink
+		// aggregation and backfill are not run concurrently
+		mx sync.Mutex
+	}
+)
+
+func New[T collectorPossibleTypes](ctx context.Context, sink stats_sink.StatsSink, flushInterval time.Duration, cfg config_types.StatsConfig) (c *Collector[T]) {
+	c = &Collector[T]{
+		ctx:           ctx,
+		sink:          sink,
+		name:          collectorName[T](),
+		flushInterval: flushInterval,
+		batchSize:     cfg.BatchSize,
+		flushWorkers:  cfg.FlushWorkers,
+		bufferSize:    cfg.BufferSize,
+		blockOnFull:   cfg.BufferFullPolicy == config_types.BufferFullPolicyBlock,
+		spillDir:      cfg.SpillDir,
+		retryMaxDelay: cfg.RetryMaxDelay,
+		cache:         make([]T, 0, cfg.BatchSize),
+		freed:         make(chan struct{}),
+		flushNow:      make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+
+	if sink == nil {
+		close(c.done)
+		return
+	}
+
+	if c.spillDir != "" {
+		paths, err := c.initSpillDir()
+		if err != nil {
+			log.Logger.Collector.Errorf("%s: initSpillDir: %s", c.name, err)
+		}
+		if c.instanceLock == nil {
+			// entries are kept in memory only
+			c.spillDir = ""
+		}
+		for _, path := range paths {
+			c.pending = append(c.pending, &batch[T]{spillPath: path})
+		}
+		c.spilledBatches = len(paths)
+		if len(paths) != 0 {
+			log.Logger.Collector.Infof("%s: %d spilled batches are replayed", c.name, len(paths))
+		}
+	}
+
+	go c.start()
+
+	return
+}
+
+// NewAggregator starts aggregation if sink supports it
+func NewAggregator(ctx context.Context, sink stats_sink.StatsSink) (a *Aggregator) {
+	a = &Aggregator{ctx: ctx}
+	if sink == nil {
+		return
+	}
+	aggregatingSink, ok := sink.(stats_sink.AggregatingSink)
+	if !ok {
+		log.Logger.Collector.Infof("%s sink doesn't support aggregation", sink.Name())
+		return
+	}
+	a.sink = aggregatingSink
+
+	go a.start()
+
+	return
+}
+
+func collectorName[T collectorPossibleTypes]() string {
+	var entries []T
+	switch any(entries).(type) {
+	case []stats_types.Stat:
+		return "stats"
+	case []stats_types.ScannerMethod:
+		return "scanner_methods"
+	case []stats_types.ScannerPeer:
+		return "scanner_peers"
+	}
+
+	return fmt.Sprintf("%T", entries)
+}
+
+// Done is closed when collector is stopped by context and remaining entries are flushed
+func (c *Collector[T]) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Collector[T]) start() {
+	defer close(c.done)
+
+	// spill file of current batch is synced even if flush waits for retry
+	var syncTick <-chan time.Time
+	if c.spillDir != "" {
+		ticker := time.NewTicker(c.flushInterval)
+		defer ticker.Stop()
+		syncTick = ticker.C
+	}
+
+	var retryDelay time.Duration
+	// sync of spill file doesn't postpone the next flush
+	nextFlush := time.Now().Add(c.flushInterval)
+	for {
+		flushNow := c.flushNow
+		if retryDelay != 0 {
+			// full batches wait for retry too
+			flushNow = nil
+		}
+
+		var err error
+		select {
+		case <-c.ctx.Done():
+			c.finalFlush()
+			c.closeSpillDir()
+
+			return
+
+		case <-syncTick:
+			c.mx.Lock()
+			err = c.syncSpillFile()
+			if err != nil {
+				// entries are kept in memory only, batch can't be released
+				log.Logger.Collector.Errorf("%s: syncSpillFile: %s", c.name, err)
+				c.spillFailed = true
+			}
+			c.mx.Unlock()
+			continue
+		case <-flushNow:
+			err = c.flushData()
+		case <-time.After(time.Until(nextFlush)):
+			err = c.flushData()
+		}
+		if err == nil {
+			retryDelay = 0
+			nextFlush = time.Now().Add(c.flushInterval)
+			continue
+		}
+
+		retryDelay = c.nextRetryDelay(retryDelay)
+		nextFlush = time.Now().Add(retryDelay)
+		log.Logger.Collector.Errorf("%s: flushData: %s. Retry in %s", c.name, err, retryDelay)
+	}
+}
+
+func (c *Collector[T]) nextRetryDelay(delay time.Duration) time.Duration {
+	delay *= 2
+	if delay < retryMinDelay {
+		delay = retryMinDelay
+	}
+	if delay > c.retryMaxDelay {
+		delay = c.retryMaxDelay
+	}
+
+	return delay
+}
+
+func (a *Aggregator) start() {
+	err := a.aggregate()
+	if err != nil {
+		log.Logger.Collector.Errorf("aggregate: %s", err)
+	}
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			err := a.aggregate()
+			if err != nil {
+				log.Logger.Collector.Errorf("aggregate: %s", err)
+			}
+			return
+
+		case <-time.After(aggregatorInterval):
+			err := a.aggregate()
+			if err != nil {
+				log.Logger.Collector.Errorf("aggregate: %s", err)
+			}
+		}
+	}
+}
+
+func (a *Aggregator) aggregate() error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	return a.sink.Aggregate()
+}
+
+func (a *Aggregator) BackfillSupported() bool {
+	_, ok := a.sink.(stats_sink.BackfillingSink)
+	return ok
+}
+
+// ValidateBackfill returns error if stats of [from, to) can't be aggregated again, e.g. they are expired
+func (a *Aggregator) ValidateBackfill(from, to time.Time) error {
+	sink, ok := a.sink.(stats_sink.BackfillingSink)
+	if !ok {
+		return ErrBackfillUnsupported
+	}
+
+	return sink.ValidateBackfill(from, to)
+}
+
+// Backfill aggregates stats of [from, to) again, e.g. after late inserts. Processed windows are replaced
+func (a *Aggregator) Backfill(from, to time.Time) error {
+	sink, ok := a.sink.(stats_sink.BackfillingSink)
+	if !ok {
+		return ErrBackfillUnsupported
+	}
+
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	return sink.Backfill(from, to)
+}
+
+// finalFlush is called after all entries are added. Batches which are not inserted remain in spill files
+func (c *Collector[T]) finalFlush() {
+	var err error
+	for i := 1; i <= finalFlushAttempts; i++ {
+		err = c.flushData()
+		if err == nil {
+			break
+		}
+		log.Logger.Collector.Errorf("%s: final flush attempt %d: %s", c.name, i, err)
+		if i < finalFlushAttempts {
+			time.Sleep(finalFlushDelay)
+		}
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if err == nil || len(c.pending) == 0 {
+		return
+	}
+
+	var lost, spilled int
+	for _, b := range c.pending {
+		if b.spillPath != "" {
+			spilled++
+		} else {
+			lost += len(b.entries)
+		}
+	}
+	if spilled != 0 {
+		log.Logger.Collector.Warnf("%s: final flush: %d batches are kept in spill files for replay", c.name, spilled)
+	}
+	if lost != 0 {
+		log.Logger.Collector.Errorf("%s: final flush: %d entries are lost", c.name, lost)
+	}
+}
+
+// flushData inserts pending batches and current batch by flush workers. Next batches are not started after failure
+func (c *Collector[T]) flushData() error {
+	if c.sink == nil {
+		return nil
+	}
+
+	c.mx.Lock()
+	c.rotate()
+	batches := append([]*batch[T](nil), c.pending...)
+	c.mx.Unlock()
+
+	var (
+		wg       sync.WaitGroup
+		errMx    sync.Mutex
+		firstErr error
+		workers  = make(chan struct{}, c.flushWorkers)
+	)
+	for _, b := range batches {
+		workers <- struct{}{}
+		errMx.Lock()
+		failed := firstErr != nil
+		errMx.Unlock()
+		if failed {
+			<-workers
+			break
+		}
+
+		wg.Add(1)
+		go func(b *batch[T]) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+
+			err := c.flushBatch(b)
+			if err != nil {
+				errMx.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMx.Unlock()
+			}
+		}(b)
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+// flushBatch inserts pending batch and removes it on success
+func (c *Collector[T]) flushBatch(b *batch[T]) error {
+	c.mx.Lock()
+	// batch may be released from memory by Add concurrently, so entries are taken under lock
+	entries, spillPath := b.entries, b.spillPath
+	c.mx.Unlock()
+
+	if entries == nil && spillPath != "" {
+		var err error
+		entries, err = readSpillFile[T](spillPath)
+		if err != nil {
+			// unreadable file can't be retried, it's kept for manual recovery
+			log.Logger.Collector.Errorf("%s: readSpillFile: %s", c.name, err)
+			spillPath = keepCorruptedSpillFile(spillPath)
+		}
+	}
+
+	timeNow := time.Now()
+	err := c.insert(entries)
+	metrics.ObserveCollectorFlushTime(c.name, err == nil, time.Since(timeNow))
+	if err != nil {
+		return err
+	}
+
+	c.mx.Lock()
+	c.removePending(b)
+	c.mx.Unlock()
+
+	if spillPath != "" {
+		removeSpillFile(spillPath)
+	}
+
+	return nil
+}
+
+func (c *Collector[T]) insert(entries []T) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var (
+		err     error
+		caller  string
+		timeNow = time.Now()
+	)
+	switch e := any(entries).(type) {
+	case []stats_types.Stat:
+		caller = "InsertStats"
+		err = c.sink.BatchInsertStats(e)
+	case []stats_types.ScannerMethod:
+		caller = "InsertScannerMethods"
+		err = c.sink.BatchInsertScannerMethods(e)
+	case []stats_types.ScannerPeer:
+		caller = "InsertScannerPeers"
+		err = c.sink.BatchInsertScannerPeers(e)
+	default:
+		return fmt.Errorf("unknow type to handle: %T", e)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %s", caller, err)
+	}
+
+	log.Logger.Collector.Debugf("fin flushData %s len %d. Elapsed %s", caller, len(entries), time.Since(timeNow))
+
+	return nil
+}
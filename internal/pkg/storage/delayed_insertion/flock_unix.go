@@ -0,0 +1,24 @@
+//go:build unix
+
+package delayed_insertion
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// tryLockFile takes exclusive flock, it's released by the kernel when process exits
+func tryLockFile(f *os.File) (bool, error) {
+	err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if errors.Is(err, unix.EWOULDBLOCK) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("Flock: %s", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,232 @@
+package delayed_insertion
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"extrnode-be/internal/pkg/log"
+)
+
+// Each collector writes spill files to its own directory <spill dir>/<collector>-<random suffix> and holds flock
+// on its lock file while running. Directories which are not locked belong to stopped processes, their files are
+// taken over by the next started collector. Spill files are named <unix nano>.spill and contain json encoded entries, one per line
+
+const (
+	spillFileExt      = ".spill"
+	spillLockFile     = "lock"
+	corruptedSpillExt = ".corrupted"
+	maxSpillLineSize  = 10 * 1024 * 1024
+)
+
+// writeSpillEntry appends entry to spill file of current batch. Entry is flushed to the file before Add returns, so it survives
+// crash of the process, the file is synced to disk on flush interval and on rotate. Must be called under lock
+func (c *Collector[T]) writeSpillEntry(entry T) error {
+	if c.spillFile == nil {
+		name := fmt.Sprintf("%d%s", time.Now().UnixNano(), spillFileExt)
+		f, err := os.OpenFile(filepath.Join(c.instanceDir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("OpenFile: %s", err)
+		}
+		c.spillFile = f
+		if c.spillWriter == nil {
+			c.spillWriter = bufio.NewWriter(f)
+		} else {
+			c.spillWriter.Reset(f)
+		}
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %s", err)
+	}
+	_, err = c.spillWriter.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("Write: %s", err)
+	}
+	err = c.spillWriter.Flush()
+	if err != nil {
+		return fmt.Errorf("Flush: %s", err)
+	}
+
+	return nil
+}
+
+// syncSpillFile writes spill file of current batch to disk, so entries survive crash of the host. Must be called under lock
+func (c *Collector[T]) syncSpillFile() error {
+	if c.spillFile == nil || c.spillFailed {
+		return nil
+	}
+	err := c.spillWriter.Flush()
+	if err != nil {
+		return fmt.Errorf("Flush: %s", err)
+	}
+	err = c.spillFile.Sync()
+	if err != nil {
+		return fmt.Errorf("Sync: %s", err)
+	}
+
+	return nil
+}
+
+// initSpillDir creates directory of the collector and returns spill files of stopped processes, oldest first
+func (c *Collector[T]) initSpillDir() ([]string, error) {
+	dir, err := os.MkdirTemp(c.spillDir, c.name+"-")
+	if err != nil {
+		return nil, fmt.Errorf("MkdirTemp: %s", err)
+	}
+	lock, err := lockSpillDir(dir)
+	if err == nil && lock == nil {
+		err = errors.New("directory is locked")
+	}
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("lockSpillDir: %s", err)
+	}
+	c.instanceDir, c.instanceLock = dir, lock
+
+	dirs, err := filepath.Glob(filepath.Join(c.spillDir, c.name+"-*"))
+	if err != nil {
+		return nil, fmt.Errorf("Glob: %s", err)
+	}
+	for _, d := range dirs {
+		if d == c.instanceDir {
+			continue
+		}
+		if info, err := os.Stat(d); err != nil || !info.IsDir() {
+			continue
+		}
+		err = c.takeOverSpillDir(d)
+		if err != nil {
+			log.Logger.Collector.Errorf("%s: takeOverSpillDir %s: %s", c.name, d, err)
+		}
+	}
+
+	paths, err := filepath.Glob(filepath.Join(c.instanceDir, "*"+spillFileExt))
+	if err != nil {
+		return nil, fmt.Errorf("Glob: %s", err)
+	}
+	// names are creation times of the same length
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// takeOverSpillDir moves spill files to the collector directory if directory is not locked by running process
+func (c *Collector[T]) takeOverSpillDir(dir string) error {
+	lock, err := lockSpillDir(dir)
+	if err != nil {
+		return err
+	}
+	if lock == nil {
+		return nil
+	}
+	defer lock.Close()
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+spillFileExt))
+	if err != nil {
+		return fmt.Errorf("Glob: %s", err)
+	}
+	for _, path := range paths {
+		err = os.Rename(path, filepath.Join(c.instanceDir, filepath.Base(path)))
+		if err != nil {
+			return fmt.Errorf("Rename: %s", err)
+		}
+	}
+	removeSpillDir(dir)
+
+	return nil
+}
+
+// closeSpillDir releases the collector directory, it's removed if nothing is left for replay
+func (c *Collector[T]) closeSpillDir() {
+	if c.instanceLock == nil {
+		return
+	}
+
+	removeSpillDir(c.instanceDir)
+	err := c.instanceLock.Close()
+	if err != nil {
+		log.Logger.Collector.Errorf("%s: close spill dir lock: %s", c.name, err)
+	}
+	c.instanceLock = nil
+}
+
+// lockSpillDir returns locked file of the directory or nil if it's locked by another process
+func lockSpillDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, spillLockFile), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("OpenFile: %s", err)
+	}
+	ok, err := tryLockFile(f)
+	if err != nil || !ok {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// removeSpillDir removes directory if only lock file is left in it
+func removeSpillDir(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 || entries[0].Name() != spillLockFile {
+		return
+	}
+	err = os.Remove(filepath.Join(dir, spillLockFile))
+	if err == nil {
+		err = os.Remove(dir)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Logger.Collector.Errorf("remove spill dir: %s", err)
+	}
+}
+
+// readSpillFile decodes entries. Incomplete last line is skipped, it's written partially on crash
+func readSpillFile[T collectorPossibleTypes](path string) ([]T, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Open: %s", err)
+	}
+	defer f.Close()
+
+	var entries []T
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxSpillLineSize)
+	for scanner.Scan() {
+		var entry T
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			log.Logger.Collector.Warnf("%s: skip invalid line: %s", path, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Scan: %s", err)
+	}
+
+	return entries, nil
+}
+
+// keepCorruptedSpillFile renames file, so it's not replayed and not removed. Returns empty path
+func keepCorruptedSpillFile(path string) string {
+	err := os.Rename(path, path+corruptedSpillExt)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Logger.Collector.Errorf("rename corrupted spill file: %s", err)
+	}
+
+	return ""
+}
+
+func removeSpillFile(path string) {
+	err := os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Logger.Collector.Errorf("remove spill file: %s", err)
+	}
+}
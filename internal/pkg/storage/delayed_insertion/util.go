@@ -0,0 +1,151 @@
+package delayed_insertion
+
+import (
+	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/pkg/metrics"
+)
+
+// Add buffers entry. If buffer is full, the oldest spilled batch is released from memory. If nothing can be released,
+// entry is dropped or Add waits for flush depending on buffer full policy
+func (c *Collector[collectorPossibleTypes]) Add(s collectorPossibleTypes) {
+	if c.sink == nil {
+		return
+	}
+
+	c.mx.Lock()
+	for c.memEntries >= c.bufferSize {
+		if c.releaseSpilled() {
+			continue
+		}
+
+		if !c.blockOnFull {
+			c.mx.Unlock()
+			metrics.IncCollectorDroppedCnt(c.name)
+			return
+		}
+
+		freed := c.freed
+		c.mx.Unlock()
+		select {
+		case <-freed:
+		case <-c.ctx.Done():
+			metrics.IncCollectorDroppedCnt(c.name)
+			return
+		}
+		c.mx.Lock()
+	}
+
+	if c.spillDir != "" && !c.spillFailed {
+		err := c.writeSpillEntry(s)
+		if err != nil {
+			// entries are kept in memory only, batch can't be released
+			log.Logger.Collector.Errorf("%s: writeSpillEntry: %s", c.name, err)
+			c.spillFailed = true
+		}
+	}
+	c.cache = append(c.cache, s)
+	c.memEntries++
+	if len(c.cache) >= c.batchSize {
+		c.rotate()
+		select {
+		case c.flushNow <- struct{}{}:
+		default:
+		}
+	}
+	c.updateMetrics()
+	c.mx.Unlock()
+}
+
+// rotate moves current batch to pending ones. Must be called under lock
+func (c *Collector[collectorPossibleTypes]) rotate() {
+	if len(c.cache) == 0 {
+		return
+	}
+
+	b := &batch[collectorPossibleTypes]{entries: c.cache}
+	if c.spillFile != nil {
+		err := c.syncSpillFile()
+		if err != nil {
+			log.Logger.Collector.Errorf("%s: syncSpillFile: %s", c.name, err)
+			c.spillFailed = true
+		}
+		err = c.spillFile.Close()
+		if err != nil {
+			log.Logger.Collector.Errorf("%s: close spill file: %s", c.name, err)
+			c.spillFailed = true
+		}
+		b.spillPath = c.spillFile.Name()
+		if c.spillFailed {
+			removeSpillFile(b.spillPath)
+			b.spillPath = ""
+		}
+	}
+
+	c.pending = append(c.pending, b)
+	c.cache = make([]collectorPossibleTypes, 0, c.batchSize)
+	c.spillFile = nil
+	c.spillFailed = false
+}
+
+// releaseSpilled frees memory of the oldest batch which is written to spill file. Must be called under lock
+func (c *Collector[collectorPossibleTypes]) releaseSpilled() bool {
+	if c.spillDir == "" {
+		return false
+	}
+	// current batch is rotated to be released, it's inserted with the next flush
+	if len(c.cache) != 0 && !c.spillFailed {
+		c.rotate()
+	}
+
+	for _, b := range c.pending {
+		if b.entries != nil && b.spillPath != "" {
+			c.memEntries -= len(b.entries)
+			b.entries = nil
+			c.spilledBatches++
+			c.updateMetrics()
+			return true
+		}
+	}
+
+	return false
+}
+
+// removePending removes inserted batch and frees its memory. Must be called under lock
+func (c *Collector[collectorPossibleTypes]) removePending(b *batch[collectorPossibleTypes]) {
+	for i := range c.pending {
+		if c.pending[i] != b {
+			continue
+		}
+
+		c.pending = append(c.pending[:i], c.pending[i+1:]...)
+		if b.entries != nil {
+			c.memEntries -= len(b.entries)
+			c.notifyFreed()
+		} else {
+			c.spilledBatches--
+		}
+		c.updateMetrics()
+
+		return
+	}
+}
+
+// notifyFreed wakes up Add calls which wait for free space. Must be called under lock
+func (c *Collector[collectorPossibleTypes]) notifyFreed() {
+	close(c.freed)
+	c.freed = make(chan struct{})
+}
+
+// updateMetrics must be called under lock
+func (c *Collector[collectorPossibleTypes]) updateMetrics() {
+	metrics.SetCollectorQueueDepth(c.name, c.memEntries)
+	metrics.SetCollectorSpilledBatches(c.name, c.spilledBatches)
+}
+
+// Len returns number of entries waiting for flush in memory
+func (c *Collector[collectorPossibleTypes]) Len() int {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	return c.memEntries
+}
@@ -0,0 +1,194 @@
+package ndjson
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"extrnode-be/internal/pkg/stats_types"
+)
+
+const (
+	fileExt = ".ndjson"
+	// rotated files are named <kind>-<time>.ndjson, so they are sorted by time
+	rotatedTimeLayout = "20060102T150405.000000000"
+
+	statsKind          = "stats"
+	scannerMethodsKind = "scanner_methods"
+	scannerPeersKind   = "scanner_peers"
+)
+
+// Storage appends entries to newline delimited json files <dir>/<kind>.ndjson.
+// File is rotated when it exceeds max size, only max files of rotated files are kept
+type Storage struct {
+	dir      string
+	maxSize  int64
+	maxFiles int
+
+	// each kind of entries is written by its own collector, lock protects rotation
+	mx sync.Mutex
+}
+
+type (
+	stat struct {
+		UserUUID       string    `json:"user_uuid"`
+		RequestID      string    `json:"request_id"`
+		Status         uint16    `json:"status"`
+		ExecutionTime  int64     `json:"execution_time_ms"`
+		Endpoint       string    `json:"endpoint"`
+		Attempts       uint8     `json:"attempts"`
+		ResponseTime   int64     `json:"response_time_ms"`
+		RpcErrorCode   string    `json:"rpc_error_code"`
+		UserAgent      string    `json:"user_agent"`
+		RpcMethod      string    `json:"rpc_method"`
+		RpcRequestData string    `json:"rpc_request_data"`
+		Timestamp      time.Time `json:"timestamp"`
+		Credits        uint64    `json:"credits"`
+	}
+	scannerMethod struct {
+		ServerId       string    `json:"server_id"`
+		Time           time.Time `json:"time"`
+		Peer           string    `json:"peer"`
+		Method         string    `json:"method"`
+		TimeConnectMs  int64     `json:"time_connect_ms"`
+		TimeResponseMs int64     `json:"time_response_ms"`
+		ResponseCode   uint16    `json:"response_code"`
+		ResponseValid  bool      `json:"response_valid"`
+	}
+	scannerPeer struct {
+		ServerId      string    `json:"server_id"`
+		Time          time.Time `json:"time"`
+		Peer          string    `json:"peer"`
+		TimeConnectMs int64     `json:"time_connect_ms"`
+		IsAlive       bool      `json:"is_alive"`
+	}
+)
+
+func New(dir string, maxSize int64, maxFiles int) (*Storage, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("MkdirAll: %s", err)
+	}
+
+	return &Storage{
+		dir:      dir,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+	}, nil
+}
+
+func (s *Storage) BatchInsertStats(stats []stats_types.Stat) error {
+	entries := make([]interface{}, 0, len(stats))
+	for _, e := range stats {
+		entries = append(entries, stat(e))
+	}
+
+	return s.write(statsKind, entries)
+}
+
+func (s *Storage) BatchInsertScannerMethods(sms []stats_types.ScannerMethod) error {
+	entries := make([]interface{}, 0, len(sms))
+	for _, e := range sms {
+		entries = append(entries, scannerMethod(e))
+	}
+
+	return s.write(scannerMethodsKind, entries)
+}
+
+func (s *Storage) BatchInsertScannerPeers(sps []stats_types.ScannerPeer) error {
+	entries := make([]interface{}, 0, len(sps))
+	for _, e := range sps {
+		entries = append(entries, scannerPeer(e))
+	}
+
+	return s.write(scannerPeersKind, entries)
+}
+
+// Ping checks that dir is writable
+func (s *Storage) Ping(_ context.Context) error {
+	f, err := os.CreateTemp(s.dir, ".ping-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	return os.Remove(f.Name())
+}
+
+// write appends batch to the file of kind. Batch is never split between files, so file may exceed max size by one batch
+func (s *Storage) write(kind string, entries []interface{}) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var data []byte
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("json.Marshal: %s", err)
+		}
+		data = append(data, line...)
+		data = append(data, '\n')
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	path := filepath.Join(s.dir, kind+fileExt)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("OpenFile: %s", err)
+	}
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("write: %s", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("stat: %s", err)
+	}
+	err = f.Close()
+	if err != nil {
+		return fmt.Errorf("close: %s", err)
+	}
+
+	if info.Size() >= s.maxSize {
+		err = s.rotate(kind, path)
+		if err != nil {
+			return fmt.Errorf("rotate: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// rotate renames current file and removes the oldest rotated files above max files
+func (s *Storage) rotate(kind, path string) error {
+	rotatedPath := filepath.Join(s.dir, fmt.Sprintf("%s-%s%s", kind, time.Now().UTC().Format(rotatedTimeLayout), fileExt))
+	err := os.Rename(path, rotatedPath)
+	if err != nil {
+		return fmt.Errorf("rename: %s", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(s.dir, kind+"-*"+fileExt))
+	if err != nil {
+		return fmt.Errorf("glob: %s", err)
+	}
+	sort.Strings(files)
+	for len(files) > s.maxFiles {
+		err = os.Remove(files[0])
+		if err != nil {
+			return fmt.Errorf("remove: %s", err)
+		}
+		files = files[1:]
+	}
+
+	return nil
+}
@@ -0,0 +1,238 @@
+package postgres
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+)
+
+type (
+	// AlertRule is condition on usage of user api keys, its events are sent to webhook
+	AlertRule struct {
+		ID            int64      `pg:"alr_id" json:"id"`
+		UserID        int64      `pg:"usr_id" json:"-"`
+		Name          string     `pg:"alr_name" json:"name"`
+		Type          string     `pg:"alr_type" json:"type"`
+		Threshold     float64    `pg:"alr_threshold" json:"threshold"`
+		WindowMinutes int        `pg:"alr_window_minutes" json:"window_minutes"`
+		WebhookURL    string     `pg:"alr_webhook_url" json:"webhook_url"`
+		WebhookSecret string     `pg:"alr_webhook_secret" json:"webhook_secret"`
+		Enabled       bool       `pg:"alr_enabled" json:"enabled"`
+		Firing        bool       `pg:"alr_firing" json:"firing"`
+		EvaluatedAt   *time.Time `pg:"alr_evaluated_at" json:"evaluated_at"`
+		CreatedAt     time.Time  `pg:"alr_created_at" json:"created_at"`
+	}
+	// AlertDelivery is webhook request of alert event, it's kept as delivery log
+	AlertDelivery struct {
+		ID             int64      `pg:"dlv_id" json:"id"`
+		RuleID         int64      `pg:"alr_id" json:"rule_id"`
+		EventID        uuid.UUID  `pg:"dlv_event_id" json:"event_id"`
+		Event          string     `pg:"dlv_event" json:"event"`
+		Payload        string     `pg:"dlv_payload" json:"payload"`
+		Status         string     `pg:"dlv_status" json:"status"`
+		Attempts       int        `pg:"dlv_attempts" json:"attempts"`
+		ResponseStatus *int       `pg:"dlv_response_status" json:"response_status"`
+		Error          *string    `pg:"dlv_error" json:"error"`
+		NextAttemptAt  time.Time  `pg:"dlv_next_attempt_at" json:"next_attempt_at"`
+		CreatedAt      time.Time  `pg:"dlv_created_at" json:"created_at"`
+		DeliveredAt    *time.Time `pg:"dlv_delivered_at" json:"delivered_at"`
+		// webhook of rule is loaded with claimed deliveries
+		WebhookURL    string `pg:"alr_webhook_url" json:"-"`
+		WebhookSecret string `pg:"alr_webhook_secret" json:"-"`
+	}
+)
+
+const (
+	AlertDeliveryPending   = "pending"
+	AlertDeliveryDelivered = "delivered"
+	AlertDeliveryFailed    = "failed"
+
+	alertRuleColumns = `alr_id, usr_id, alr_name, alr_type, alr_threshold, alr_window_minutes, alr_webhook_url, alr_webhook_secret,
+		alr_enabled, alr_firing, alr_evaluated_at, alr_created_at`
+	alertDeliveryColumns = `dlv_id, alr_id, dlv_event_id, dlv_event, dlv_payload, dlv_status, dlv_attempts, dlv_response_status,
+		dlv_error, dlv_next_attempt_at, dlv_created_at, dlv_delivered_at`
+)
+
+func (p *Storage) CreateAlertRule(r AlertRule) (res AlertRule, err error) {
+	query := `INSERT INTO alert_rules (usr_id, alr_name, alr_type, alr_threshold, alr_window_minutes, alr_webhook_url, alr_webhook_secret, alr_enabled)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING ` + alertRuleColumns
+	_, err = p.db.QueryOne(&res, query, r.UserID, r.Name, r.Type, r.Threshold, r.WindowMinutes, r.WebhookURL, r.WebhookSecret, r.Enabled)
+	if err != nil {
+		return res, fmt.Errorf("insert: %s", err)
+	}
+
+	return res, nil
+}
+
+func (p *Storage) GetAlertRules(userID int64) (rules []AlertRule, err error) {
+	query := `SELECT ` + alertRuleColumns + ` FROM alert_rules WHERE usr_id = ? ORDER BY alr_id`
+	_, err = p.db.Query(&rules, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("select: %s", err)
+	}
+
+	return rules, nil
+}
+
+func (p *Storage) CountAlertRules(userID int64) (count int, err error) {
+	_, err = p.db.QueryOne(pg.Scan(&count), `SELECT count(*) FROM alert_rules WHERE usr_id = ?`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("select: %s", err)
+	}
+
+	return count, nil
+}
+
+// GetEnabledAlertRules returns enabled rules of all users ordered by user
+func (p *Storage) GetEnabledAlertRules() (rules []AlertRule, err error) {
+	query := `SELECT ` + alertRuleColumns + ` FROM alert_rules WHERE alr_enabled ORDER BY usr_id, alr_id`
+	_, err = p.db.Query(&rules, query)
+	if err != nil {
+		return nil, fmt.Errorf("select: %s", err)
+	}
+
+	return rules, nil
+}
+
+// UpdateAlertRule changes condition and webhook url of rule. Disabled rule stops firing without resolved event
+func (p *Storage) UpdateAlertRule(r AlertRule) (res AlertRule, isFound bool, err error) {
+	query := `UPDATE alert_rules
+		SET alr_name = ?, alr_type = ?, alr_threshold = ?, alr_window_minutes = ?, alr_webhook_url = ?, alr_enabled = ?,
+			alr_firing = alr_firing AND ?
+		WHERE usr_id = ? AND alr_id = ?
+		RETURNING ` + alertRuleColumns
+	_, err = p.db.QueryOne(&res, query, r.Name, r.Type, r.Threshold, r.WindowMinutes, r.WebhookURL, r.Enabled, r.Enabled, r.UserID, r.ID)
+	if err == pg.ErrNoRows {
+		return res, false, nil
+	}
+	if err != nil {
+		return res, false, fmt.Errorf("update: %s", err)
+	}
+
+	return res, true, nil
+}
+
+// DeleteAlertRule deletes rule with its delivery log
+func (p *Storage) DeleteAlertRule(userID, ruleID int64) (isFound bool, err error) {
+	res, err := p.db.Exec(`DELETE FROM alert_rules WHERE usr_id = ? AND alr_id = ?`, userID, ruleID)
+	if err != nil {
+		return false, fmt.Errorf("delete: %s", err)
+	}
+
+	return res.RowsAffected() != 0, nil
+}
+
+// SetAlertRuleFiring changes state of rule and adds delivery of its event. isChanged is false if state is changed already,
+// e.g. by another instance, so event is added once
+func (p *Storage) SetAlertRuleFiring(ruleID int64, firing bool, d AlertDelivery) (isChanged bool, err error) {
+	s, err := p.BeginTx()
+	if err != nil {
+		return false, fmt.Errorf("beginTx: %s", err)
+	}
+	defer s.Rollback()
+
+	res, err := s.db.Exec(`UPDATE alert_rules SET alr_firing = ? WHERE alr_id = ? AND alr_firing = ? AND alr_enabled`, firing, ruleID, !firing)
+	if err != nil {
+		return false, fmt.Errorf("update: %s", err)
+	}
+	if res.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	d.RuleID = ruleID
+	_, err = s.CreateAlertDelivery(d)
+	if err != nil {
+		return false, err
+	}
+
+	err = s.Commit()
+	if err != nil {
+		return false, fmt.Errorf("commit: %s", err)
+	}
+
+	return true, nil
+}
+
+// SetAlertRulesEvaluated saves time of the last evaluation
+func (p *Storage) SetAlertRulesEvaluated(ruleIDs []int64, evaluatedAt time.Time) error {
+	if len(ruleIDs) == 0 {
+		return nil
+	}
+
+	_, err := p.db.Exec(`UPDATE alert_rules SET alr_evaluated_at = ? WHERE alr_id IN (?)`, evaluatedAt, pg.In(ruleIDs))
+	if err != nil {
+		return fmt.Errorf("update: %s", err)
+	}
+
+	return nil
+}
+
+// CreateAlertDelivery adds pending delivery of event
+func (p *Storage) CreateAlertDelivery(d AlertDelivery) (res AlertDelivery, err error) {
+	query := `INSERT INTO alert_deliveries (alr_id, dlv_event_id, dlv_event, dlv_payload, dlv_status)
+		VALUES (?, ?, ?, ?, ?) RETURNING ` + alertDeliveryColumns
+	_, err = p.db.QueryOne(&res, query, d.RuleID, d.EventID, d.Event, d.Payload, AlertDeliveryPending)
+	if err != nil {
+		return res, fmt.Errorf("insert delivery: %s", err)
+	}
+
+	return res, nil
+}
+
+// ClaimAlertDeliveries returns pending deliveries which are due and postpones them by lease,
+// so other instances don't send them until the attempt is saved
+func (p *Storage) ClaimAlertDeliveries(limit int, lease time.Duration) (deliveries []AlertDelivery, err error) {
+	query := `UPDATE alert_deliveries d
+		SET dlv_next_attempt_at = now() + ?::interval
+		FROM alert_rules r
+		WHERE r.alr_id = d.alr_id AND d.dlv_id IN (
+			SELECT dlv_id FROM alert_deliveries
+			WHERE dlv_status = ? AND dlv_next_attempt_at <= now()
+			ORDER BY dlv_next_attempt_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.dlv_id, d.alr_id, d.dlv_event_id, d.dlv_event, d.dlv_payload, d.dlv_status, d.dlv_attempts, d.dlv_response_status,
+			d.dlv_error, d.dlv_next_attempt_at, d.dlv_created_at, d.dlv_delivered_at, r.alr_webhook_url, r.alr_webhook_secret`
+	_, err = p.db.Query(&deliveries, query, fmt.Sprintf("%d milliseconds", lease.Milliseconds()), AlertDeliveryPending, limit)
+	if err != nil {
+		return nil, fmt.Errorf("update: %s", err)
+	}
+
+	return deliveries, nil
+}
+
+// SaveAlertDeliveryAttempt saves result of webhook request
+func (p *Storage) SaveAlertDeliveryAttempt(d AlertDelivery) error {
+	query := `UPDATE alert_deliveries
+		SET dlv_status = ?, dlv_attempts = ?, dlv_response_status = ?, dlv_error = ?, dlv_next_attempt_at = ?, dlv_delivered_at = ?
+		WHERE dlv_id = ?`
+	_, err := p.db.Exec(query, d.Status, d.Attempts, d.ResponseStatus, d.Error, d.NextAttemptAt, d.DeliveredAt, d.ID)
+	if err != nil {
+		return fmt.Errorf("update: %s", err)
+	}
+
+	return nil
+}
+
+// GetAlertDeliveries returns the latest deliveries of rule. isFound is false if rule doesn't belong to user
+func (p *Storage) GetAlertDeliveries(userID, ruleID int64, limit int) (deliveries []AlertDelivery, isFound bool, err error) {
+	var count int
+	_, err = p.db.QueryOne(pg.Scan(&count), `SELECT count(*) FROM alert_rules WHERE usr_id = ? AND alr_id = ?`, userID, ruleID)
+	if err != nil {
+		return nil, false, fmt.Errorf("select rule: %s", err)
+	}
+	if count == 0 {
+		return nil, false, nil
+	}
+
+	query := `SELECT ` + alertDeliveryColumns + ` FROM alert_deliveries WHERE alr_id = ? ORDER BY dlv_id DESC LIMIT ?`
+	_, err = p.db.Query(&deliveries, query, ruleID, limit)
+	if err != nil {
+		return nil, false, fmt.Errorf("select: %s", err)
+	}
+
+	return deliveries, true, nil
+}
@@ -0,0 +1,285 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// ApiKey is api token of user or organization. Revoked keys are kept, so their usage remains available
+type ApiKey struct {
+	ID int64 `pg:"key_id" json:"id"`
+	// one of owners is set
+	UserID     int64      `pg:"usr_id" json:"-"`
+	OrgID      int64      `pg:"org_id" json:"-"`
+	Name       string     `pg:"key_name" json:"name"`
+	Token      uuid.UUID  `pg:"key_token" json:"token"`
+	CreatedAt  time.Time  `pg:"key_created_at" json:"created_at"`
+	ExpiresAt  *time.Time `pg:"key_expires_at" json:"expires_at"`
+	RevokedAt  *time.Time `pg:"key_revoked_at" json:"revoked_at"`
+	LastUsedAt *time.Time `pg:"key_last_used_at" json:"last_used_at"`
+}
+
+const (
+	// tokens of revoked and rotated keys are sent to this channel, so caches are invalidated immediately
+	apiKeyRevokedChannel = "api_key_revoked"
+	DefaultApiKeyName    = "default"
+
+	apiKeyColumns = "key_id, usr_id, org_id, key_name, key_token, key_created_at, key_expires_at, key_revoked_at, key_last_used_at"
+	// key is active if it's neither revoked nor expired
+	activeApiKeyCondition = "key_revoked_at IS NULL AND (key_expires_at IS NULL OR key_expires_at > now())"
+)
+
+// ApiKeyOwner is user or organization, only one of ids is set
+type ApiKeyOwner struct {
+	UserID int64
+	OrgID  int64
+}
+
+// condition returns where clause selecting keys of owner
+func (o ApiKeyOwner) condition() (string, int64, error) {
+	switch {
+	case o.UserID != 0 && o.OrgID == 0:
+		return "usr_id = ?", o.UserID, nil
+	case o.OrgID != 0 && o.UserID == 0:
+		return "org_id = ?", o.OrgID, nil
+	}
+
+	return "", 0, fmt.Errorf("invalid owner: %+v", o)
+}
+
+// nullable returns NULL for empty id
+func nullable(id int64) interface{} {
+	if id == 0 {
+		return nil
+	}
+
+	return id
+}
+
+func (p *Storage) CreateApiKey(owner ApiKeyOwner, name string, expiresAt *time.Time) (k ApiKey, err error) {
+	_, _, err = owner.condition()
+	if err != nil {
+		return k, err
+	}
+
+	token, err := uuid.NewRandom()
+	if err != nil {
+		return k, fmt.Errorf("uuid.New: %s", err)
+	}
+
+	query := `INSERT INTO api_keys (usr_id, org_id, key_name, key_token, key_expires_at)
+		VALUES (?, ?, ?, ?, ?) RETURNING ` + apiKeyColumns
+	_, err = p.db.QueryOne(&k, query, nullable(owner.UserID), nullable(owner.OrgID), name, token, expiresAt)
+	if err != nil {
+		return k, fmt.Errorf("insert: %s", err)
+	}
+
+	return k, nil
+}
+
+// GetApiKeys returns all keys of owner including revoked and expired ones, oldest first
+func (p *Storage) GetApiKeys(owner ApiKeyOwner) (keys []ApiKey, err error) {
+	ownerCondition, ownerID, err := owner.condition()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE ` + ownerCondition + ` ORDER BY key_id`
+	_, err = p.db.Query(&keys, query, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("select: %s", err)
+	}
+
+	return keys, nil
+}
+
+// GetActiveApiKey returns the oldest active key of user. isFound is false if user has no active keys
+func (p *Storage) GetActiveApiKey(userID int64) (k ApiKey, isFound bool, err error) {
+	if userID == 0 {
+		return k, false, fmt.Errorf("empty userID")
+	}
+
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE usr_id = ? AND ` + activeApiKeyCondition + ` ORDER BY key_id LIMIT 1`
+	_, err = p.db.QueryOne(&k, query, userID)
+	if err == pg.ErrNoRows {
+		return k, false, nil
+	}
+	if err != nil {
+		return k, false, fmt.Errorf("select: %s", err)
+	}
+
+	return k, true, nil
+}
+
+// GetApiKey returns key of owner. isFound is false if owner has no such key
+func (p *Storage) GetApiKey(owner ApiKeyOwner, keyID int64) (k ApiKey, isFound bool, err error) {
+	ownerCondition, ownerID, err := owner.condition()
+	if err != nil {
+		return k, false, err
+	}
+
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE ` + ownerCondition + ` AND key_id = ?`
+	_, err = p.db.QueryOne(&k, query, ownerID, keyID)
+	if err == pg.ErrNoRows {
+		return k, false, nil
+	}
+	if err != nil {
+		return k, false, fmt.Errorf("select: %s", err)
+	}
+
+	return k, true, nil
+}
+
+func (p *Storage) CountActiveApiKeys(owner ApiKeyOwner) (count int, err error) {
+	ownerCondition, ownerID, err := owner.condition()
+	if err != nil {
+		return 0, err
+	}
+
+	query := `SELECT count(*) FROM api_keys WHERE ` + ownerCondition + ` AND ` + activeApiKeyCondition
+	_, err = p.db.QueryOne(pg.Scan(&count), query, ownerID)
+	if err != nil {
+		return 0, fmt.Errorf("select: %s", err)
+	}
+
+	return count, nil
+}
+
+// RevokeApiKey revokes active key of owner, its token stops working immediately. isFound is false if owner has no such active key
+func (p *Storage) RevokeApiKey(owner ApiKeyOwner, keyID int64) (k ApiKey, isFound bool, err error) {
+	s, err := p.BeginTx()
+	if err != nil {
+		return k, false, fmt.Errorf("beginTx: %s", err)
+	}
+	defer s.Rollback()
+
+	k, isFound, err = s.revokeApiKey(owner, keyID)
+	if err != nil || !isFound {
+		return k, isFound, err
+	}
+
+	err = s.Commit()
+	if err != nil {
+		return k, false, fmt.Errorf("commit: %s", err)
+	}
+
+	return k, true, nil
+}
+
+// RotateApiKey revokes active key and creates a new one with the same name, expiration and policy.
+// Revoked key is kept, so usage of the old token remains available. isFound is false if owner has no such active key
+func (p *Storage) RotateApiKey(owner ApiKeyOwner, keyID int64) (k ApiKey, isFound bool, err error) {
+	s, err := p.BeginTx()
+	if err != nil {
+		return k, false, fmt.Errorf("beginTx: %s", err)
+	}
+	defer s.Rollback()
+
+	old, isFound, err := s.revokeApiKey(owner, keyID)
+	if err != nil || !isFound {
+		return k, isFound, err
+	}
+
+	k, err = s.CreateApiKey(owner, old.Name, old.ExpiresAt)
+	if err != nil {
+		return k, false, fmt.Errorf("CreateApiKey: %s", err)
+	}
+	_, err = s.db.Exec(`INSERT INTO api_token_policies (key_id, pol_allowed_methods, pol_denied_methods, pol_allowed_program_ids, pol_denied_encodings, pol_max_data_slice_length)
+		SELECT ?, pol_allowed_methods, pol_denied_methods, pol_allowed_program_ids, pol_denied_encodings, pol_max_data_slice_length
+		FROM api_token_policies WHERE key_id = ?`, k.ID, old.ID)
+	if err != nil {
+		return k, false, fmt.Errorf("copy policy: %s", err)
+	}
+
+	err = s.Commit()
+	if err != nil {
+		return k, false, fmt.Errorf("commit: %s", err)
+	}
+
+	return k, true, nil
+}
+
+// revokeApiKey revokes active key in tx and notifies listeners about its token
+func (p *Storage) revokeApiKey(owner ApiKeyOwner, keyID int64) (k ApiKey, isFound bool, err error) {
+	ownerCondition, ownerID, err := owner.condition()
+	if err != nil {
+		return k, false, err
+	}
+
+	query := `UPDATE api_keys SET key_revoked_at = now()
+		WHERE ` + ownerCondition + ` AND key_id = ? AND ` + activeApiKeyCondition + `
+		RETURNING ` + apiKeyColumns
+	_, err = p.db.QueryOne(&k, query, ownerID, keyID)
+	if err == pg.ErrNoRows {
+		return k, false, nil
+	}
+	if err != nil {
+		return k, false, fmt.Errorf("update: %s", err)
+	}
+
+	// notification is delivered on commit
+	_, err = p.db.Exec(`SELECT pg_notify(?, ?)`, apiKeyRevokedChannel, k.Token.String())
+	if err != nil {
+		return k, false, fmt.Errorf("pg_notify: %s", err)
+	}
+
+	return k, true, nil
+}
+
+// UpdateApiKeysLastUsed sets last used time of keys by tokens. Time is never moved back
+func (p *Storage) UpdateApiKeysLastUsed(ctx context.Context, lastUsed map[uuid.UUID]time.Time) error {
+	if len(lastUsed) == 0 {
+		return nil
+	}
+
+	tokens := make([]string, 0, len(lastUsed))
+	times := make([]time.Time, 0, len(lastUsed))
+	for token, t := range lastUsed {
+		tokens = append(tokens, token.String())
+		times = append(times, t)
+	}
+
+	query := `UPDATE api_keys SET key_last_used_at = u.last_used_at
+		FROM unnest(?::uuid[], ?::timestamptz[]) AS u(key_token, last_used_at)
+		WHERE api_keys.key_token = u.key_token
+			AND (api_keys.key_last_used_at IS NULL OR api_keys.key_last_used_at < u.last_used_at)`
+	_, err := p.db.ExecContext(ctx, query, pg.Array(tokens), pg.Array(times))
+	if err != nil {
+		return fmt.Errorf("update: %s", err)
+	}
+
+	return nil
+}
+
+// ListenRevokedApiKeys calls fn with tokens of revoked and rotated keys until ctx is done.
+// Listener reconnects by itself, notifications sent while it's disconnected are lost
+func (p *Storage) ListenRevokedApiKeys(ctx context.Context, fn func(token uuid.UUID)) error {
+	db, ok := p.db.(*pg.DB)
+	if !ok {
+		return fmt.Errorf("listen is not supported in tx")
+	}
+
+	ln := db.Listen(ctx, apiKeyRevokedChannel)
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	go func() {
+		for n := range ln.Channel() {
+			token, err := uuid.Parse(n.Payload)
+			if err != nil {
+				log.Errorf("ListenRevokedApiKeys: uuid.Parse: %s", err)
+				continue
+			}
+			fn(token)
+		}
+	}()
+
+	return nil
+}
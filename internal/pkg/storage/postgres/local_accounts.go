@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// LocalAccount is user of local auth provider
+type LocalAccount struct {
+	ID              int64      `pg:"acc_id"`
+	Email           string     `pg:"acc_email"`
+	PasswordHash    string     `pg:"acc_password_hash"`
+	CreatedAt       time.Time  `pg:"acc_created_at"`
+	EmailVerifiedAt *time.Time `pg:"acc_email_verified_at"`
+}
+
+const localAccountColumns = "acc_id, acc_email, acc_password_hash, acc_created_at, acc_email_verified_at"
+
+// CreateLocalAccount creates account. isCreated is false if email is already used
+func (p *Storage) CreateLocalAccount(email, passwordHash string) (acc LocalAccount, isCreated bool, err error) {
+	if email == "" {
+		return acc, false, fmt.Errorf("empty email")
+	}
+
+	query := `INSERT INTO local_accounts (acc_email, acc_password_hash) VALUES (?, ?)
+		ON CONFLICT DO NOTHING
+		RETURNING ` + localAccountColumns
+	_, err = p.db.QueryOne(&acc, query, email, passwordHash)
+	if err == pg.ErrNoRows {
+		return acc, false, nil
+	}
+	if err != nil {
+		return acc, false, fmt.Errorf("insert: %s", err)
+	}
+
+	return acc, true, nil
+}
+
+// GetLocalAccountByEmail returns account by case insensitive email. isFound is false if there is no such account
+func (p *Storage) GetLocalAccountByEmail(email string) (acc LocalAccount, isFound bool, err error) {
+	query := `SELECT ` + localAccountColumns + ` FROM local_accounts WHERE lower(acc_email) = lower(?)`
+	_, err = p.db.QueryOne(&acc, query, email)
+	if err == pg.ErrNoRows {
+		return acc, false, nil
+	}
+	if err != nil {
+		return acc, false, fmt.Errorf("select: %s", err)
+	}
+
+	return acc, true, nil
+}
+
+// GetLocalAccount returns account by id. isFound is false if there is no such account
+func (p *Storage) GetLocalAccount(id int64) (acc LocalAccount, isFound bool, err error) {
+	query := `SELECT ` + localAccountColumns + ` FROM local_accounts WHERE acc_id = ?`
+	_, err = p.db.QueryOne(&acc, query, id)
+	if err == pg.ErrNoRows {
+		return acc, false, nil
+	}
+	if err != nil {
+		return acc, false, fmt.Errorf("select: %s", err)
+	}
+
+	return acc, true, nil
+}
+
+// MarkLocalAccountVerificationSent saves time of verification email. isMarked is false if the previous one is sent less than interval ago
+func (p *Storage) MarkLocalAccountVerificationSent(id int64, interval time.Duration) (isMarked bool, err error) {
+	query := `UPDATE local_accounts SET acc_verification_sent_at = now()
+		WHERE acc_id = ? AND (acc_verification_sent_at IS NULL OR acc_verification_sent_at < ?)`
+	res, err := p.db.Exec(query, id, time.Now().Add(-interval))
+	if err != nil {
+		return false, fmt.Errorf("update: %s", err)
+	}
+
+	return res.RowsAffected() != 0, nil
+}
+
+// VerifyLocalAccountEmail marks email of account as verified. isFound is false if account has another email now
+func (p *Storage) VerifyLocalAccountEmail(id int64, email string) (acc LocalAccount, isFound bool, err error) {
+	query := `UPDATE local_accounts SET acc_email_verified_at = coalesce(acc_email_verified_at, now())
+		WHERE acc_id = ? AND lower(acc_email) = lower(?)
+		RETURNING ` + localAccountColumns
+	_, err = p.db.QueryOne(&acc, query, id, email)
+	if err == pg.ErrNoRows {
+		return acc, false, nil
+	}
+	if err != nil {
+		return acc, false, fmt.Errorf("update: %s", err)
+	}
+
+	return acc, true, nil
+}
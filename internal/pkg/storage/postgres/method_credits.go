@@ -0,0 +1,29 @@
+package postgres
+
+import (
+	"fmt"
+)
+
+// DefaultCreditsMethod is method of credits charged for methods without own ones
+const DefaultCreditsMethod = "*"
+
+type methodCredits struct {
+	Method  string `pg:"mcr_method"`
+	Credits uint64 `pg:"mcr_credits"`
+}
+
+// GetMethodCredits returns credits of rpc methods, DefaultCreditsMethod key has credits of other methods
+func (p *Storage) GetMethodCredits() (map[string]uint64, error) {
+	var rows []methodCredits
+	_, err := p.db.Query(&rows, `SELECT mcr_method, mcr_credits FROM method_credits`)
+	if err != nil {
+		return nil, fmt.Errorf("select: %s", err)
+	}
+
+	res := make(map[string]uint64, len(rows))
+	for _, r := range rows {
+		res[r.Method] = r.Credits
+	}
+
+	return res, nil
+}
@@ -0,0 +1,298 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+type (
+	// Organization is loaded with role of the requesting user
+	Organization struct {
+		ID        int64     `pg:"org_id" json:"id"`
+		Name      string    `pg:"org_name" json:"name"`
+		CreatedAt time.Time `pg:"org_created_at" json:"created_at"`
+		Role      string    `pg:"mem_role" json:"role"`
+	}
+	OrganizationMember struct {
+		UserID    int64     `pg:"usr_id" json:"user_id"`
+		Email     string    `pg:"usr_email" json:"email"`
+		Role      string    `pg:"mem_role" json:"role"`
+		CreatedAt time.Time `pg:"mem_created_at" json:"created_at"`
+	}
+	OrganizationInvitation struct {
+		ID        int64     `pg:"inv_id" json:"id"`
+		OrgID     int64     `pg:"org_id" json:"org_id"`
+		OrgName   string    `pg:"org_name" json:"org_name"`
+		Email     string    `pg:"inv_email" json:"email"`
+		Role      string    `pg:"inv_role" json:"role"`
+		CreatedAt time.Time `pg:"inv_created_at" json:"created_at"`
+		ExpiresAt time.Time `pg:"inv_expires_at" json:"expires_at"`
+	}
+)
+
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleViewer = "viewer"
+
+	invitationColumns = "inv_id, org_id, org_name, inv_email, inv_role, inv_created_at, inv_expires_at"
+)
+
+// ErrLastOrganizationOwner is returned if the only owner is removed or demoted
+var ErrLastOrganizationOwner = errors.New("organization must have an owner")
+
+// CreateOrganization creates organization with the user as owner
+func (p *Storage) CreateOrganization(userID int64, name string) (o Organization, err error) {
+	if userID == 0 {
+		return o, fmt.Errorf("empty userID")
+	}
+
+	s, err := p.BeginTx()
+	if err != nil {
+		return o, fmt.Errorf("beginTx: %s", err)
+	}
+	defer s.Rollback()
+
+	query := `INSERT INTO organizations (org_name) VALUES (?) RETURNING org_id, org_name, org_created_at`
+	_, err = s.db.QueryOne(&o, query, name)
+	if err != nil {
+		return o, fmt.Errorf("insert organization: %s", err)
+	}
+
+	query = `INSERT INTO organization_members (org_id, usr_id, mem_role) VALUES (?, ?, ?)`
+	_, err = s.db.Exec(query, o.ID, userID, OrgRoleOwner)
+	if err != nil {
+		return o, fmt.Errorf("insert member: %s", err)
+	}
+	o.Role = OrgRoleOwner
+
+	err = s.Commit()
+	if err != nil {
+		return o, fmt.Errorf("commit: %s", err)
+	}
+
+	return o, nil
+}
+
+// GetUserOrganizations returns organizations where user is a member
+func (p *Storage) GetUserOrganizations(userID int64) (orgs []Organization, err error) {
+	query := `SELECT org_id, org_name, org_created_at, mem_role
+		FROM organization_members
+		JOIN organizations USING (org_id)
+		WHERE usr_id = ?
+		ORDER BY org_id`
+	_, err = p.db.Query(&orgs, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("select: %s", err)
+	}
+
+	return orgs, nil
+}
+
+// GetOrganizationRole returns role of user. isFound is false if user isn't a member of organization
+func (p *Storage) GetOrganizationRole(orgID, userID int64) (role string, isFound bool, err error) {
+	query := `SELECT mem_role FROM organization_members WHERE org_id = ? AND usr_id = ?`
+	_, err = p.db.QueryOne(pg.Scan(&role), query, orgID, userID)
+	if err == pg.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("select: %s", err)
+	}
+
+	return role, true, nil
+}
+
+func (p *Storage) GetOrganizationMembers(orgID int64) (members []OrganizationMember, err error) {
+	query := `SELECT usr_id, usr_email, mem_role, mem_created_at
+		FROM organization_members
+		JOIN users USING (usr_id)
+		WHERE org_id = ?
+		ORDER BY mem_created_at, usr_id`
+	_, err = p.db.Query(&members, query, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("select: %s", err)
+	}
+
+	return members, nil
+}
+
+// GetOrganizationAllowedOrigins returns origins from which browsers are allowed to use api tokens of organization
+func (p *Storage) GetOrganizationAllowedOrigins(orgID int64) (origins []string, err error) {
+	query := `SELECT org_allowed_origins FROM organizations WHERE org_id = ?`
+	_, err = p.db.QueryOne(pg.Scan(pg.Array(&origins)), query, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("select: %s", err)
+	}
+
+	return origins, nil
+}
+
+// UpdateOrganizationAllowedOrigins sets origins from which browsers are allowed to use api tokens of organization
+func (p *Storage) UpdateOrganizationAllowedOrigins(orgID int64, origins []string) error {
+	query := `UPDATE organizations SET org_allowed_origins = ? WHERE org_id = ?`
+	_, err := p.db.Exec(query, pg.Array(nonNilStrings(origins)), orgID)
+	if err != nil {
+		return fmt.Errorf("update: %s", err)
+	}
+
+	return nil
+}
+
+// UpdateOrganizationMemberRole changes role of member. isFound is false if user isn't a member of organization
+func (p *Storage) UpdateOrganizationMemberRole(orgID, userID int64, role string) (isFound bool, err error) {
+	return p.changeOrganizationMember(orgID, userID, `UPDATE organization_members SET mem_role = ? WHERE org_id = ? AND usr_id = ?`, role)
+}
+
+// DeleteOrganizationMember removes user from organization. isFound is false if user isn't a member of organization
+func (p *Storage) DeleteOrganizationMember(orgID, userID int64) (isFound bool, err error) {
+	return p.changeOrganizationMember(orgID, userID, `DELETE FROM organization_members WHERE org_id = ? AND usr_id = ?`)
+}
+
+// changeOrganizationMember executes query for member and checks that organization still has an owner
+func (p *Storage) changeOrganizationMember(orgID, userID int64, query string, args ...interface{}) (isFound bool, err error) {
+	s, err := p.BeginTx()
+	if err != nil {
+		return false, fmt.Errorf("beginTx: %s", err)
+	}
+	defer s.Rollback()
+
+	// concurrent changes of members are serialized by organization lock, so the last owner can't be removed twice
+	_, err = s.db.Exec(`SELECT 1 FROM organizations WHERE org_id = ? FOR UPDATE`, orgID)
+	if err != nil {
+		return false, fmt.Errorf("lock: %s", err)
+	}
+
+	res, err := s.db.Exec(query, append(args, orgID, userID)...)
+	if err != nil {
+		return false, fmt.Errorf("exec: %s", err)
+	}
+	if res.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	var owners int
+	query = `SELECT count(*) FROM organization_members WHERE org_id = ? AND mem_role = ?`
+	_, err = s.db.QueryOne(pg.Scan(&owners), query, orgID, OrgRoleOwner)
+	if err != nil {
+		return false, fmt.Errorf("select owners: %s", err)
+	}
+	if owners == 0 {
+		return true, ErrLastOrganizationOwner
+	}
+
+	err = s.Commit()
+	if err != nil {
+		return false, fmt.Errorf("commit: %s", err)
+	}
+
+	return true, nil
+}
+
+// CreateOrganizationInvitation invites email to organization. Existing invitation of the email is replaced
+func (p *Storage) CreateOrganizationInvitation(orgID, createdBy int64, email, role string, expiresAt time.Time) (inv OrganizationInvitation, err error) {
+	query := `WITH inv AS (
+			INSERT INTO organization_invitations (org_id, inv_email, inv_role, inv_created_by, inv_expires_at)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (org_id, lower(inv_email)) DO UPDATE SET inv_email = EXCLUDED.inv_email,
+				inv_role = EXCLUDED.inv_role,
+				inv_created_by = EXCLUDED.inv_created_by,
+				inv_created_at = now(),
+				inv_expires_at = EXCLUDED.inv_expires_at
+			RETURNING *
+		)
+		SELECT ` + invitationColumns + ` FROM inv JOIN organizations USING (org_id)`
+	_, err = p.db.QueryOne(&inv, query, orgID, email, role, createdBy, expiresAt)
+	if err != nil {
+		return inv, fmt.Errorf("insert: %s", err)
+	}
+
+	return inv, nil
+}
+
+// GetOrganizationInvitations returns invitations of organization including expired ones
+func (p *Storage) GetOrganizationInvitations(orgID int64) (invs []OrganizationInvitation, err error) {
+	query := `SELECT ` + invitationColumns + `
+		FROM organization_invitations
+		JOIN organizations USING (org_id)
+		WHERE org_id = ?
+		ORDER BY inv_id`
+	_, err = p.db.Query(&invs, query, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("select: %s", err)
+	}
+
+	return invs, nil
+}
+
+// GetInvitationsByEmail returns not expired invitations of email
+func (p *Storage) GetInvitationsByEmail(email string) (invs []OrganizationInvitation, err error) {
+	query := `SELECT ` + invitationColumns + `
+		FROM organization_invitations
+		JOIN organizations USING (org_id)
+		WHERE lower(inv_email) = lower(?) AND inv_expires_at > now()
+		ORDER BY inv_id`
+	_, err = p.db.Query(&invs, query, email)
+	if err != nil {
+		return nil, fmt.Errorf("select: %s", err)
+	}
+
+	return invs, nil
+}
+
+// DeleteOrganizationInvitation cancels invitation. isFound is false if organization has no such invitation
+func (p *Storage) DeleteOrganizationInvitation(orgID, invID int64) (isFound bool, err error) {
+	res, err := p.db.Exec(`DELETE FROM organization_invitations WHERE org_id = ? AND inv_id = ?`, orgID, invID)
+	if err != nil {
+		return false, fmt.Errorf("delete: %s", err)
+	}
+
+	return res.RowsAffected() != 0, nil
+}
+
+// AcceptOrganizationInvitation adds user to organization by not expired invitation of the email.
+// Role of existing member is not changed. isFound is false if email has no such invitation
+func (p *Storage) AcceptOrganizationInvitation(invID, userID int64, email string) (o Organization, isFound bool, err error) {
+	s, err := p.BeginTx()
+	if err != nil {
+		return o, false, fmt.Errorf("beginTx: %s", err)
+	}
+	defer s.Rollback()
+
+	var inv OrganizationInvitation
+	query := `DELETE FROM organization_invitations
+		WHERE inv_id = ? AND lower(inv_email) = lower(?) AND inv_expires_at > now()
+		RETURNING org_id, inv_role`
+	_, err = s.db.QueryOne(&inv, query, invID, email)
+	if err == pg.ErrNoRows {
+		return o, false, nil
+	}
+	if err != nil {
+		return o, false, fmt.Errorf("delete invitation: %s", err)
+	}
+
+	query = `INSERT INTO organization_members (org_id, usr_id, mem_role) VALUES (?, ?, ?) ON CONFLICT DO NOTHING`
+	_, err = s.db.Exec(query, inv.OrgID, userID, inv.Role)
+	if err != nil {
+		return o, false, fmt.Errorf("insert member: %s", err)
+	}
+
+	query = `SELECT org_id, org_name, org_created_at, mem_role
+		FROM organization_members
+		JOIN organizations USING (org_id)
+		WHERE org_id = ? AND usr_id = ?`
+	_, err = s.db.QueryOne(&o, query, inv.OrgID, userID)
+	if err != nil {
+		return o, false, fmt.Errorf("select: %s", err)
+	}
+
+	err = s.Commit()
+	if err != nil {
+		return o, false, fmt.Errorf("commit: %s", err)
+	}
+
+	return o, true, nil
+}
@@ -0,0 +1,43 @@
+package postgres
+
+import (
+	"fmt"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// Plan sets monthly price and credits of user or organization. Credits above monthly ones are overage
+type Plan struct {
+	ID                     int64  `pg:"pln_id" json:"id"`
+	Name                   string `pg:"pln_name" json:"name"`
+	MonthlyCredits         uint64 `pg:"pln_monthly_credits" json:"monthly_credits"`
+	PriceCents             uint64 `pg:"pln_price_cents" json:"price_cents"`
+	OverageCentsPerMillion uint64 `pg:"pln_overage_cents_per_million" json:"overage_cents_per_million"`
+	// requests of plan keys are not checked by method guards of proxy
+	LiftMethodGuards bool `pg:"pln_lift_method_guards" json:"lift_method_guards"`
+}
+
+// GetPlan returns plan assigned to owner or the default one. isFound is false if neither is set
+func (p *Storage) GetPlan(owner ApiKeyOwner) (plan Plan, isFound bool, err error) {
+	condition, id, err := owner.condition()
+	if err != nil {
+		return plan, false, err
+	}
+	table := userTable
+	if owner.OrgID != 0 {
+		table = "organizations"
+	}
+
+	query := fmt.Sprintf(`SELECT pln_id, pln_name, pln_monthly_credits, pln_price_cents, pln_overage_cents_per_million, pln_lift_method_guards
+		FROM plans
+		WHERE pln_id = coalesce((SELECT pln_id FROM %s WHERE %s), (SELECT pln_id FROM plans WHERE pln_is_default))`, table, condition)
+	_, err = p.db.QueryOne(&plan, query, id)
+	if err == pg.ErrNoRows {
+		return plan, false, nil
+	}
+	if err != nil {
+		return plan, false, fmt.Errorf("select: %s", err)
+	}
+
+	return plan, true, nil
+}
@@ -0,0 +1,149 @@
+package postgres
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+)
+
+// Policy restricts requests made with api token. Empty lists mean no restriction.
+// Policy of user or organization is default for its keys, policy of key replaces it
+type Policy struct {
+	// one of owners is set
+	UserID             int64    `pg:"usr_id" json:"-"`
+	OrgID              int64    `pg:"org_id" json:"-"`
+	KeyID              int64    `pg:"key_id" json:"key_id,omitempty"`
+	AllowedMethods     []string `pg:"pol_allowed_methods,array" json:"allowed_methods"`
+	DeniedMethods      []string `pg:"pol_denied_methods,array" json:"denied_methods"`
+	AllowedProgramIDs  []string `pg:"pol_allowed_program_ids,array" json:"allowed_program_ids"`
+	DeniedEncodings    []string `pg:"pol_denied_encodings,array" json:"denied_encodings"`
+	MaxDataSliceLength uint64   `pg:"pol_max_data_slice_length" json:"max_data_slice_length"`
+	// stored in users or organizations table, loaded only by GetPolicyByApiToken
+	AllowedOrigins []string `pg:"allowed_origins,array" json:"-"`
+	// keys of organization are not allowed in browsers until allowed origins are set, loaded only by GetPolicyByApiToken
+	IsOrgKey bool `pg:"is_org_key" json:"-"`
+	// expiration of api key, loaded only by GetPolicyByApiToken
+	ExpiresAt *time.Time `pg:"key_expires_at" json:"-"`
+	// set by plan of key owner, loaded only by GetPolicyByApiToken
+	LiftMethodGuards bool `pg:"pln_lift_method_guards" json:"-"`
+}
+
+const policyColumns = "usr_id, org_id, key_id, pol_allowed_methods, pol_denied_methods, pol_allowed_program_ids, pol_denied_encodings, pol_max_data_slice_length"
+
+// GetPolicyByOwner returns default policy of user or organization keys
+func (p *Storage) GetPolicyByOwner(owner ApiKeyOwner) (policy Policy, err error) {
+	ownerCondition, ownerID, err := owner.condition()
+	if err != nil {
+		return policy, err
+	}
+
+	query := `SELECT ` + policyColumns + ` FROM api_token_policies WHERE ` + ownerCondition
+	_, err = p.db.QueryOne(&policy, query, ownerID)
+	if err == pg.ErrNoRows {
+		return Policy{UserID: owner.UserID, OrgID: owner.OrgID}, nil
+	}
+	if err != nil {
+		return policy, fmt.Errorf("select: %s", err)
+	}
+
+	return policy, nil
+}
+
+// GetPolicyByKeyID returns own policy of key. isFound is false if key uses default policy of its owner
+func (p *Storage) GetPolicyByKeyID(keyID int64) (policy Policy, isFound bool, err error) {
+	if keyID == 0 {
+		return policy, false, fmt.Errorf("empty keyID")
+	}
+
+	query := `SELECT ` + policyColumns + ` FROM api_token_policies WHERE key_id = ?`
+	_, err = p.db.QueryOne(&policy, query, keyID)
+	if err == pg.ErrNoRows {
+		return policy, false, nil
+	}
+	if err != nil {
+		return policy, false, fmt.Errorf("select: %s", err)
+	}
+
+	return policy, true, nil
+}
+
+// DeleteKeyPolicy deletes own policy of key, so default policy of its owner is applied. isFound is false if key has no own policy
+func (p *Storage) DeleteKeyPolicy(keyID int64) (isFound bool, err error) {
+	res, err := p.db.Exec(`DELETE FROM api_token_policies WHERE key_id = ?`, keyID)
+	if err != nil {
+		return false, fmt.Errorf("delete: %s", err)
+	}
+
+	return res.RowsAffected() != 0, nil
+}
+
+// GetPolicyByApiToken returns own policy of the key or default policy of its owner. isFound is false if token doesn't belong to any active key.
+// Method guards aren't lifted for keys of organization without policy
+func (p *Storage) GetPolicyByApiToken(apiToken uuid.UUID) (policy Policy, isFound bool, err error) {
+	query := `SELECT api_keys.usr_id, api_keys.org_id, api_keys.key_id, pol_allowed_methods, pol_denied_methods, pol_allowed_program_ids,
+			pol_denied_encodings, pol_max_data_slice_length, coalesce(usr_allowed_origins, org_allowed_origins) AS allowed_origins,
+			api_keys.org_id IS NOT NULL AS is_org_key, key_expires_at,
+			(SELECT pln_lift_method_guards FROM plans
+				WHERE pln_id = coalesce(users.pln_id, organizations.pln_id, (SELECT pln_id FROM plans WHERE pln_is_default)))
+				AND (api_keys.org_id IS NULL OR pol.pol_id IS NOT NULL) AS pln_lift_method_guards
+		FROM api_keys
+		LEFT JOIN users USING (usr_id)
+		LEFT JOIN organizations USING (org_id)
+		LEFT JOIN LATERAL (SELECT * FROM api_token_policies
+			WHERE api_token_policies.key_id = api_keys.key_id OR api_token_policies.usr_id = api_keys.usr_id
+				OR api_token_policies.org_id = api_keys.org_id
+			ORDER BY api_token_policies.key_id NULLS LAST
+			LIMIT 1) pol ON true
+		WHERE key_token = ? AND ` + activeApiKeyCondition
+	_, err = p.db.QueryOne(&policy, query, apiToken)
+	if err == pg.ErrNoRows {
+		return policy, false, nil
+	}
+	if err != nil {
+		return policy, false, fmt.Errorf("select: %s", err)
+	}
+
+	return policy, true, nil
+}
+
+// UpsertPolicy saves default policy of user or organization or own policy of key, one of them must be set
+func (p *Storage) UpsertPolicy(policy Policy) error {
+	var conflictColumn string
+	switch {
+	case policy.UserID != 0 && policy.OrgID == 0 && policy.KeyID == 0:
+		conflictColumn = "usr_id"
+	case policy.OrgID != 0 && policy.UserID == 0 && policy.KeyID == 0:
+		conflictColumn = "org_id"
+	case policy.KeyID != 0 && policy.UserID == 0 && policy.OrgID == 0:
+		conflictColumn = "key_id"
+	default:
+		return fmt.Errorf("invalid owner of policy")
+	}
+
+	query := `INSERT INTO api_token_policies (usr_id, org_id, key_id, pol_allowed_methods, pol_denied_methods, pol_allowed_program_ids, pol_denied_encodings,
+			pol_max_data_slice_length)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (` + conflictColumn + `) DO UPDATE SET pol_allowed_methods = EXCLUDED.pol_allowed_methods,
+			pol_denied_methods = EXCLUDED.pol_denied_methods,
+			pol_allowed_program_ids = EXCLUDED.pol_allowed_program_ids,
+			pol_denied_encodings = EXCLUDED.pol_denied_encodings,
+			pol_max_data_slice_length = EXCLUDED.pol_max_data_slice_length`
+	_, err := p.db.Exec(query, nullable(policy.UserID), nullable(policy.OrgID), nullable(policy.KeyID), pg.Array(nonNilStrings(policy.AllowedMethods)), pg.Array(nonNilStrings(policy.DeniedMethods)),
+		pg.Array(nonNilStrings(policy.AllowedProgramIDs)), pg.Array(nonNilStrings(policy.DeniedEncodings)), policy.MaxDataSliceLength)
+	if err != nil {
+		return fmt.Errorf("upsert: %s", err)
+	}
+
+	return nil
+}
+
+// nil slice is stored as NULL, columns are not nullable
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+
+	return s
+}
@@ -74,6 +74,11 @@ func New(ctx context.Context, cfg config_types.PostgresConfig) (s Storage, err e
 	}, nil
 }
 
+func (p *Storage) Ping(ctx context.Context) error {
+	_, err := p.db.ExecContext(ctx, "SELECT 1")
+	return err
+}
+
 func (p *Storage) BeginTx() (s Storage, err error) {
 	if p.isTx {
 		return s, fmt.Errorf("already tx")
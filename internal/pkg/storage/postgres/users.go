@@ -5,59 +5,91 @@ import (
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/go-pg/pg/v10"
-	"github.com/google/uuid"
 )
 
 type User struct {
-	ID         int64     `pg:"usr_id"`
-	ProviderID string    `pg:"usr_provider_id"`
-	ApiToken   uuid.UUID `pg:"usr_api_token"`
+	ID             int64    `pg:"usr_id"`
+	ProviderID     string   `pg:"usr_provider_id"`
+	Email          string   `pg:"usr_email"`
+	AllowedOrigins []string `pg:"usr_allowed_origins,array"`
 }
 
 const userTable = "users"
 
-func (p *Storage) GetOrCreateUser(providerId string) (u User, err error) {
+// GetOrCreateUser returns user by provider id. Email is updated if it's changed in provider
+func (p *Storage) GetOrCreateUser(providerId, email string) (u User, err error) {
+	s, err := p.BeginTx()
+	if err != nil {
+		return u, fmt.Errorf("beginTx: %s", err)
+	}
+	defer s.Rollback()
+
+	u, err = s.getOrCreateUser(providerId, email)
+	if err != nil {
+		return u, err
+	}
+
+	err = s.Commit()
+	if err != nil {
+		return u, fmt.Errorf("commit: %s", err)
+	}
+
+	return u, nil
+}
+
+// getOrCreateUser is called in tx. New user gets default api key
+func (p *Storage) getOrCreateUser(providerId, email string) (u User, err error) {
 	if providerId == "" {
 		return u, fmt.Errorf("empty providerId")
 	}
 
-	query, args, err := sq.Select("usr_id, usr_provider_id, usr_api_token").
+	query, args, err := sq.Select("usr_id, usr_provider_id, usr_email, usr_allowed_origins").
 		From(userTable).
 		Where("usr_provider_id = ?", providerId).ToSql()
 	if err != nil {
 		return u, err
 	}
 
-	s, err := p.BeginTx()
-	if err != nil {
-		return u, fmt.Errorf("beginTx: %s", err)
-	}
-	defer s.Rollback()
-
-	_, err = s.db.QueryOne(&u, query, args...)
+	_, err = p.db.QueryOne(&u, query, args...)
 	if err != nil && err != pg.ErrNoRows {
 		return u, fmt.Errorf("select: %s", err)
 	}
 
 	if err == pg.ErrNoRows {
-		apiToken, err := uuid.NewRandom()
+		query = `INSERT INTO users (usr_provider_id, usr_email)
+			VALUES (?, ?) RETURNING usr_id, usr_provider_id, usr_email, usr_allowed_origins`
+
+		_, err = p.db.QueryOne(&u, query, providerId, email)
 		if err != nil {
-			return u, fmt.Errorf("uuid.New: %s", err)
+			return u, fmt.Errorf("insert: %s", err)
 		}
 
-		query = `INSERT INTO users (usr_provider_id, usr_api_token)
-			VALUES (?, ?) RETURNING usr_id, usr_provider_id, usr_api_token`
-
-		_, err = p.db.QueryOne(&u, query, providerId, apiToken)
+		_, err = p.CreateApiKey(ApiKeyOwner{UserID: u.ID}, DefaultApiKeyName, nil)
 		if err != nil {
-			return u, fmt.Errorf("insert: %s", err)
+			return u, fmt.Errorf("CreateApiKey: %s", err)
 		}
+	} else if u.Email != email {
+		_, err = p.db.Exec(`UPDATE users SET usr_email = ? WHERE usr_id = ?`, email, u.ID)
+		if err != nil {
+			return u, fmt.Errorf("update: %s", err)
+		}
+		u.Email = email
 	}
 
-	err = s.Commit()
+	return u, nil
+}
+
+// UpdateUserAllowedOrigins sets origins from which browsers are allowed to use user api token
+func (p *Storage) UpdateUserAllowedOrigins(userID int64, origins []string) error {
+	if userID == 0 {
+		return fmt.Errorf("empty userID")
+	}
+
+	query := `UPDATE users SET usr_allowed_origins = ? WHERE usr_id = ?`
+	_, err := p.db.Exec(query, pg.Array(nonNilStrings(origins)), userID)
 	if err != nil {
-		return u, fmt.Errorf("commit: %s", err)
+		return fmt.Errorf("update: %s", err)
 	}
 
-	return u, nil
+	return nil
 }
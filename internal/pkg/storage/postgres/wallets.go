@@ -0,0 +1,118 @@
+package postgres
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// Wallet is solana wallet linked to user, it's used to sign in
+type Wallet struct {
+	Pubkey    string    `pg:"wlt_pubkey" json:"pubkey"`
+	UserID    int64     `pg:"usr_id" json:"-"`
+	CreatedAt time.Time `pg:"wlt_created_at" json:"created_at"`
+}
+
+// CreateWalletNonce saves nonce of message which must be signed by wallet. userID is set for linking and empty for sign in.
+// Expired nonces are deleted
+func (p *Storage) CreateWalletNonce(nonce, pubkey string, userID int64, message string, expiresAt time.Time) error {
+	_, err := p.db.Exec(`DELETE FROM wallet_nonces WHERE wnc_expires_at <= now()`)
+	if err != nil {
+		return fmt.Errorf("delete expired: %s", err)
+	}
+
+	query := `INSERT INTO wallet_nonces (wnc_nonce, wnc_pubkey, usr_id, wnc_message, wnc_expires_at) VALUES (?, ?, ?, ?, ?)`
+	_, err = p.db.Exec(query, nonce, pubkey, nullable(userID), message, expiresAt)
+	if err != nil {
+		return fmt.Errorf("insert: %s", err)
+	}
+
+	return nil
+}
+
+// UseWalletNonce deletes not expired nonce and returns its message. isFound is false if nonce isn't issued for the wallet and user
+func (p *Storage) UseWalletNonce(nonce, pubkey string, userID int64) (message string, isFound bool, err error) {
+	query := `DELETE FROM wallet_nonces
+		WHERE wnc_nonce = ? AND wnc_pubkey = ? AND usr_id IS NOT DISTINCT FROM ? AND wnc_expires_at > now()
+		RETURNING wnc_message`
+	_, err = p.db.QueryOne(pg.Scan(&message), query, nonce, pubkey, nullable(userID))
+	if err == pg.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("delete: %s", err)
+	}
+
+	return message, true, nil
+}
+
+// GetOrCreateWalletUser returns user linked to wallet. Unknown wallet is linked to new user with the provider id
+func (p *Storage) GetOrCreateWalletUser(pubkey, providerId string) (u User, err error) {
+	s, err := p.BeginTx()
+	if err != nil {
+		return u, fmt.Errorf("beginTx: %s", err)
+	}
+	defer s.Rollback()
+
+	query := `SELECT usr_id, usr_provider_id, usr_email, usr_allowed_origins
+		FROM user_wallets
+		JOIN users USING (usr_id)
+		WHERE wlt_pubkey = ?`
+	_, err = s.db.QueryOne(&u, query, pubkey)
+	if err != nil && err != pg.ErrNoRows {
+		return u, fmt.Errorf("select: %s", err)
+	}
+
+	if err == pg.ErrNoRows {
+		u, err = s.getOrCreateUser(providerId, "")
+		if err != nil {
+			return u, err
+		}
+
+		_, err = s.db.Exec(`INSERT INTO user_wallets (wlt_pubkey, usr_id) VALUES (?, ?)`, pubkey, u.ID)
+		if err != nil {
+			return u, fmt.Errorf("insert wallet: %s", err)
+		}
+	}
+
+	err = s.Commit()
+	if err != nil {
+		return u, fmt.Errorf("commit: %s", err)
+	}
+
+	return u, nil
+}
+
+func (p *Storage) GetUserWallets(userID int64) (wallets []Wallet, err error) {
+	query := `SELECT wlt_pubkey, usr_id, wlt_created_at FROM user_wallets WHERE usr_id = ? ORDER BY wlt_created_at`
+	_, err = p.db.Query(&wallets, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("select: %s", err)
+	}
+
+	return wallets, nil
+}
+
+// LinkWallet links wallet to user. isLinked is false if wallet is linked to another user
+func (p *Storage) LinkWallet(userID int64, pubkey string) (w Wallet, isLinked bool, err error) {
+	query := `INSERT INTO user_wallets (wlt_pubkey, usr_id) VALUES (?, ?)
+		ON CONFLICT (wlt_pubkey) DO UPDATE SET usr_id = user_wallets.usr_id
+		RETURNING wlt_pubkey, usr_id, wlt_created_at`
+	_, err = p.db.QueryOne(&w, query, pubkey, userID)
+	if err != nil {
+		return w, false, fmt.Errorf("insert: %s", err)
+	}
+
+	return w, w.UserID == userID, nil
+}
+
+// UnlinkWallet removes wallet of user. isFound is false if wallet isn't linked to the user
+func (p *Storage) UnlinkWallet(userID int64, pubkey string) (isFound bool, err error) {
+	res, err := p.db.Exec(`DELETE FROM user_wallets WHERE usr_id = ? AND wlt_pubkey = ?`, userID, pubkey)
+	if err != nil {
+		return false, fmt.Errorf("delete: %s", err)
+	}
+
+	return res.RowsAffected() != 0, nil
+}
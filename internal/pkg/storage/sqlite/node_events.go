@@ -0,0 +1,363 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+type (
+	// NodeEvent is state change of peer detected by scanner. Events are append-only history of peer
+	NodeEvent struct {
+		ID         int64  `json:"-"`
+		UUID       string `json:"id"`
+		PeerID     int    `json:"-"`
+		Endpoint   string `json:"endpoint"`
+		NodePubkey string `json:"node_pubkey"`
+		Event      string `json:"event"`
+		Method     string `json:"method,omitempty"`
+		// values of version and node pubkey changes
+		OldValue string `json:"old_value,omitempty"`
+		NewValue string `json:"new_value,omitempty"`
+		// hostname of scanner which detected the change
+		ServerID  string    `json:"server_id"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	// NodeSubscription sends events of peer with node pubkey or endpoint to webhook
+	NodeSubscription struct {
+		ID            int64     `json:"id"`
+		NodePubkey    string    `json:"node_pubkey"`
+		Endpoint      string    `json:"endpoint"`
+		WebhookURL    string    `json:"webhook_url"`
+		WebhookSecret string    `json:"webhook_secret"`
+		Token         string    `json:"token,omitempty"`
+		CreatedAt     time.Time `json:"created_at"`
+	}
+	// NodeEventDelivery is webhook request of event to subscription, it's kept as delivery log
+	NodeEventDelivery struct {
+		ID             int64      `json:"id"`
+		SubscriptionID int64      `json:"subscription_id"`
+		Event          NodeEvent  `json:"event"`
+		Status         string     `json:"status"`
+		Attempts       int        `json:"attempts"`
+		ResponseStatus *int       `json:"response_status"`
+		Error          *string    `json:"error"`
+		NextAttemptAt  time.Time  `json:"next_attempt_at"`
+		CreatedAt      time.Time  `json:"created_at"`
+		DeliveredAt    *time.Time `json:"delivered_at"`
+		// webhook of subscription is loaded with due deliveries
+		WebhookURL    string `json:"-"`
+		WebhookSecret string `json:"-"`
+	}
+)
+
+const (
+	NodeEventDown              = "down"
+	NodeEventUp                = "up"
+	NodeEventRpcDisabled       = "rpc_disabled"
+	NodeEventRpcEnabled        = "rpc_enabled"
+	NodeEventMethodUnsupported = "method_unsupported"
+	NodeEventMethodSupported   = "method_supported"
+	NodeEventOutdated          = "outdated"
+	NodeEventSynced            = "synced"
+	NodeEventSSLEnabled        = "ssl_enabled"
+	NodeEventSSLDisabled       = "ssl_disabled"
+	NodeEventValidatorEnabled  = "validator_enabled"
+	NodeEventValidatorDisabled = "validator_disabled"
+	NodeEventVersionChanged    = "version_changed"
+	NodeEventPubkeyChanged     = "node_pubkey_changed"
+
+	NodeEventDeliveryPending   = "pending"
+	NodeEventDeliveryDelivered = "delivered"
+	NodeEventDeliveryFailed    = "failed"
+
+	nodeEventsTable  = "node_events"
+	nodeEventColumns = `nev_id, nev_uuid, prs_id, nev_endpoint, nev_node_pubkey, nev_event, nev_method, nev_old_value, nev_new_value,
+		nev_server_id, nev_created_at`
+	nodeSubscriptionColumns = `nsb_id, nsb_node_pubkey, nsb_endpoint, nsb_webhook_url, nsb_webhook_secret, nsb_created_at`
+)
+
+// AddNodeEvent saves event and adds pending deliveries to subscriptions of the peer
+func (s *Storage) AddNodeEvent(e NodeEvent) error {
+	if e.PeerID == 0 {
+		return fmt.Errorf("empty peerID")
+	}
+
+	tx, err := s.db.BeginTx(s.ctx, nil)
+	if err != nil {
+		return fmt.Errorf("tx begin error: %s", err)
+	}
+	defer tx.Rollback()
+
+	now := statsTime(time.Now())
+	query := `INSERT INTO node_events (nev_uuid, prs_id, nev_endpoint, nev_node_pubkey, nev_event, nev_method, nev_old_value, nev_new_value,
+			nev_server_id, nev_created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING nev_id`
+	err = tx.QueryRowContext(s.ctx, query, e.UUID, e.PeerID, e.Endpoint, e.NodePubkey, e.Event, e.Method, e.OldValue, e.NewValue,
+		e.ServerID, now).Scan(&e.ID)
+	if err != nil {
+		return fmt.Errorf("insert event: %s", err)
+	}
+
+	query = `INSERT INTO node_event_deliveries (nev_id, nsb_id, ndl_status, ndl_next_attempt_at, ndl_created_at)
+		SELECT ?, nsb_id, ?, ?, ? FROM node_subscriptions
+		WHERE nsb_endpoint = ? OR (nsb_node_pubkey != '' AND nsb_node_pubkey = ?)`
+	_, err = tx.ExecContext(s.ctx, query, e.ID, NodeEventDeliveryPending, now, now, e.Endpoint, e.NodePubkey)
+	if err != nil {
+		return fmt.Errorf("insert deliveries: %s", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("tx commit error: %s", err)
+	}
+
+	return nil
+}
+
+// NodeEventsFilter selects events of peers with node pubkey or endpoint. Empty fields aren't applied
+type NodeEventsFilter struct {
+	NodePubkey string
+	Endpoint   string
+	Events     []string
+	From       *time.Time
+	To         *time.Time
+	Limit      uint64
+}
+
+// GetNodeEvents returns the latest events by filter
+func (s *Storage) GetNodeEvents(f NodeEventsFilter) (res []NodeEvent, err error) {
+	q := sq.Select(nodeEventColumns).
+		From(nodeEventsTable).
+		Where(sq.Or{
+			sq.And{sq.Expr("? != ''", f.NodePubkey), sq.Eq{"nev_node_pubkey": f.NodePubkey}},
+			sq.And{sq.Expr("? != ''", f.Endpoint), sq.Eq{"nev_endpoint": f.Endpoint}},
+		}).
+		OrderBy("nev_id DESC").
+		Limit(f.Limit)
+	if len(f.Events) != 0 {
+		q = q.Where(sq.Eq{"nev_event": f.Events})
+	}
+	if f.From != nil {
+		q = q.Where(sq.GtOrEq{"nev_created_at": statsTime(*f.From)})
+	}
+	if f.To != nil {
+		q = q.Where(sq.Lt{"nev_created_at": statsTime(*f.To)})
+	}
+	query, args, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(s.ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select: %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			e         NodeEvent
+			createdAt string
+		)
+		err = rows.Scan(&e.ID, &e.UUID, &e.PeerID, &e.Endpoint, &e.NodePubkey, &e.Event, &e.Method, &e.OldValue, &e.NewValue,
+			&e.ServerID, &createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %s", err)
+		}
+		e.CreatedAt, err = parseStatsTime(createdAt)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+
+	return res, rows.Err()
+}
+
+// DeleteNodeEventDeliveries deletes finished deliveries created before time. Events are kept as history of nodes
+func (s *Storage) DeleteNodeEventDeliveries(before time.Time) (count int64, err error) {
+	res, err := s.db.ExecContext(s.ctx, `DELETE FROM node_event_deliveries WHERE ndl_status != ? AND ndl_created_at < ?`,
+		NodeEventDeliveryPending, statsTime(before))
+	if err != nil {
+		return 0, fmt.Errorf("delete: %s", err)
+	}
+
+	return res.RowsAffected()
+}
+
+// GetNodePeerPubkeys returns identity pubkeys of peers with node pubkey or endpoint. isFound is false if there is no such peer,
+// pubkeys are empty if identity of peer is unknown
+func (s *Storage) GetNodePeerPubkeys(nodePubkey, endpoint string) (pubkeys []string, isFound bool, err error) {
+	query := `SELECT prs_node_pubkey FROM peers JOIN ips ON ips.ip_id = peers.ip_id
+		WHERE (? != '' AND prs_node_pubkey = ?) OR (? != '' AND ip_addr || ':' || prs_port = ?)`
+	rows, err := s.db.QueryContext(s.ctx, query, nodePubkey, nodePubkey, endpoint, endpoint)
+	if err != nil {
+		return nil, false, fmt.Errorf("select: %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pubkey string
+		err = rows.Scan(&pubkey)
+		if err != nil {
+			return nil, false, fmt.Errorf("scan: %s", err)
+		}
+		isFound = true
+		if pubkey != "" {
+			pubkeys = append(pubkeys, pubkey)
+		}
+	}
+
+	return pubkeys, isFound, rows.Err()
+}
+
+func (s *Storage) CreateNodeSubscription(sub NodeSubscription) (res NodeSubscription, err error) {
+	sub.CreatedAt = time.Now().UTC()
+	query := `INSERT INTO node_subscriptions (nsb_node_pubkey, nsb_endpoint, nsb_webhook_url, nsb_webhook_secret, nsb_token, nsb_created_at)
+		VALUES (?, ?, ?, ?, ?, ?) RETURNING nsb_id`
+	err = s.db.QueryRowContext(s.ctx, query, sub.NodePubkey, sub.Endpoint, sub.WebhookURL, sub.WebhookSecret, sub.Token,
+		statsTime(sub.CreatedAt)).Scan(&sub.ID)
+	if err != nil {
+		return res, fmt.Errorf("insert: %s", err)
+	}
+
+	return sub, nil
+}
+
+// CountNodeSubscriptions returns number of subscriptions to node pubkey or endpoint
+func (s *Storage) CountNodeSubscriptions(nodePubkey, endpoint string) (count int, err error) {
+	query := `SELECT count(*) FROM node_subscriptions WHERE nsb_node_pubkey = ? AND nsb_endpoint = ?`
+	err = s.db.QueryRowContext(s.ctx, query, nodePubkey, endpoint).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("select: %s", err)
+	}
+
+	return count, nil
+}
+
+// HasNodeSubscription checks if webhook is already subscribed to node pubkey or endpoint
+func (s *Storage) HasNodeSubscription(nodePubkey, endpoint, webhookURL string) (bool, error) {
+	query := `SELECT count(*) FROM node_subscriptions WHERE nsb_node_pubkey = ? AND nsb_endpoint = ? AND nsb_webhook_url = ?`
+	var count int
+	err := s.db.QueryRowContext(s.ctx, query, nodePubkey, endpoint, webhookURL).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("select: %s", err)
+	}
+
+	return count != 0, nil
+}
+
+// GetNodeSubscription returns subscription if token matches
+func (s *Storage) GetNodeSubscription(id int64, token string) (res NodeSubscription, isFound bool, err error) {
+	var createdAt string
+	query := `SELECT ` + nodeSubscriptionColumns + ` FROM node_subscriptions WHERE nsb_id = ? AND nsb_token = ?`
+	err = s.db.QueryRowContext(s.ctx, query, id, token).
+		Scan(&res.ID, &res.NodePubkey, &res.Endpoint, &res.WebhookURL, &res.WebhookSecret, &createdAt)
+	if err == sql.ErrNoRows {
+		return res, false, nil
+	}
+	if err != nil {
+		return res, false, fmt.Errorf("select: %s", err)
+	}
+	res.CreatedAt, err = parseStatsTime(createdAt)
+	if err != nil {
+		return res, false, err
+	}
+
+	return res, true, nil
+}
+
+// DeleteNodeSubscription deletes subscription with its delivery log if token matches
+func (s *Storage) DeleteNodeSubscription(id int64, token string) (isFound bool, err error) {
+	res, err := s.db.ExecContext(s.ctx, `DELETE FROM node_subscriptions WHERE nsb_id = ? AND nsb_token = ?`, id, token)
+	if err != nil {
+		return false, fmt.Errorf("delete: %s", err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("RowsAffected: %s", err)
+	}
+
+	return count != 0, nil
+}
+
+// GetNodeEventDeliveries returns the latest deliveries of subscription
+func (s *Storage) GetNodeEventDeliveries(subscriptionID int64, limit int) ([]NodeEventDelivery, error) {
+	return s.selectNodeEventDeliveries(`WHERE d.nsb_id = ? ORDER BY d.ndl_id DESC LIMIT ?`, subscriptionID, limit)
+}
+
+// GetDueNodeEventDeliveries returns pending deliveries which are due with webhooks of their subscriptions
+func (s *Storage) GetDueNodeEventDeliveries(limit int) ([]NodeEventDelivery, error) {
+	return s.selectNodeEventDeliveries(`WHERE d.ndl_status = ? AND d.ndl_next_attempt_at <= ? ORDER BY d.ndl_next_attempt_at LIMIT ?`,
+		NodeEventDeliveryPending, statsTime(time.Now()), limit)
+}
+
+// SaveNodeEventDeliveryAttempt saves result of webhook request
+func (s *Storage) SaveNodeEventDeliveryAttempt(d NodeEventDelivery) error {
+	var deliveredAt *string
+	if d.DeliveredAt != nil {
+		t := statsTime(*d.DeliveredAt)
+		deliveredAt = &t
+	}
+
+	query := `UPDATE node_event_deliveries
+		SET ndl_status = ?, ndl_attempts = ?, ndl_response_status = ?, ndl_error = ?, ndl_next_attempt_at = ?, ndl_delivered_at = ?
+		WHERE ndl_id = ?`
+	_, err := s.db.ExecContext(s.ctx, query, d.Status, d.Attempts, d.ResponseStatus, d.Error, statsTime(d.NextAttemptAt), deliveredAt, d.ID)
+	if err != nil {
+		return fmt.Errorf("update: %s", err)
+	}
+
+	return nil
+}
+
+func (s *Storage) selectNodeEventDeliveries(where string, args ...interface{}) (res []NodeEventDelivery, err error) {
+	query := `SELECT d.ndl_id, d.nsb_id, d.ndl_status, d.ndl_attempts, d.ndl_response_status, d.ndl_error, d.ndl_next_attempt_at,
+			d.ndl_created_at, d.ndl_delivered_at, e.nev_id, e.nev_uuid, e.prs_id, e.nev_endpoint, e.nev_node_pubkey, e.nev_event,
+			e.nev_method, e.nev_old_value, e.nev_new_value, e.nev_server_id, e.nev_created_at, sb.nsb_webhook_url, sb.nsb_webhook_secret
+		FROM node_event_deliveries d
+			JOIN node_events e ON e.nev_id = d.nev_id
+			JOIN node_subscriptions sb ON sb.nsb_id = d.nsb_id ` + where
+	rows, err := s.db.QueryContext(s.ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select: %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			d                                        NodeEventDelivery
+			nextAttemptAt, createdAt, eventCreatedAt string
+			deliveredAt                              sql.NullString
+		)
+		err = rows.Scan(&d.ID, &d.SubscriptionID, &d.Status, &d.Attempts, &d.ResponseStatus, &d.Error, &nextAttemptAt,
+			&createdAt, &deliveredAt, &d.Event.ID, &d.Event.UUID, &d.Event.PeerID, &d.Event.Endpoint, &d.Event.NodePubkey,
+			&d.Event.Event, &d.Event.Method, &d.Event.OldValue, &d.Event.NewValue, &d.Event.ServerID, &eventCreatedAt,
+			&d.WebhookURL, &d.WebhookSecret)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %s", err)
+		}
+		if d.NextAttemptAt, err = parseStatsTime(nextAttemptAt); err != nil {
+			return nil, err
+		}
+		if d.CreatedAt, err = parseStatsTime(createdAt); err != nil {
+			return nil, err
+		}
+		if d.Event.CreatedAt, err = parseStatsTime(eventCreatedAt); err != nil {
+			return nil, err
+		}
+		if deliveredAt.Valid {
+			t, err := parseStatsTime(deliveredAt.String)
+			if err != nil {
+				return nil, err
+			}
+			d.DeliveredAt = &t
+		}
+		res = append(res, d)
+	}
+
+	return res, rows.Err()
+}
@@ -15,30 +15,45 @@ type RpcPeerMethod struct {
 
 const rpcPeersMethodsTable = "rpc_peers_methods"
 
-func (s *Storage) UpsertRpcPeerMethod(peerID, rpcMethodID int, responseTime time.Duration) error {
+// UpsertRpcPeerMethod saves response time of method supported by peer. isCreated is true if method wasn't supported before
+func (s *Storage) UpsertRpcPeerMethod(peerID, rpcMethodID int, responseTime time.Duration) (isCreated bool, err error) {
 	if peerID == 0 {
-		return fmt.Errorf("empty peerID")
+		return false, fmt.Errorf("empty peerID")
 	}
 	if rpcMethodID == 0 {
-		return fmt.Errorf("empty rpcMethodID")
+		return false, fmt.Errorf("empty rpcMethodID")
 	}
 
-	query := `INSERT INTO rpc_peers_methods (prs_id, mtd_id, pmd_response_time_ms)
+	query := `UPDATE rpc_peers_methods SET pmd_response_time_ms = ? WHERE prs_id = ? AND mtd_id = ?`
+	res, err := s.db.ExecContext(s.ctx, query, responseTime.Milliseconds(), peerID, rpcMethodID)
+	if err != nil {
+		return false, fmt.Errorf("update: %s", err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("RowsAffected: %s", err)
+	}
+	if count != 0 {
+		return false, nil
+	}
+
+	query = `INSERT INTO rpc_peers_methods (prs_id, mtd_id, pmd_response_time_ms)
 			VALUES (?, ?, ?) ON CONFLICT DO UPDATE SET pmd_response_time_ms = ?`
-	_, err := s.db.ExecContext(s.ctx, query, peerID, rpcMethodID, responseTime.Milliseconds(), responseTime.Milliseconds())
+	_, err = s.db.ExecContext(s.ctx, query, peerID, rpcMethodID, responseTime.Milliseconds(), responseTime.Milliseconds())
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	return nil
+	return true, nil
 }
 
-func (s *Storage) DeleteRpcPeerMethod(peerID int, rpcMethodID *int) error {
+// DeleteRpcPeerMethod deletes method of peer or all its methods if method is nil. isDeleted is false if they weren't supported
+func (s *Storage) DeleteRpcPeerMethod(peerID int, rpcMethodID *int) (isDeleted bool, err error) {
 	if peerID == 0 {
-		return fmt.Errorf("empty peerID")
+		return false, fmt.Errorf("empty peerID")
 	}
 	if rpcMethodID != nil && *rpcMethodID == 0 {
-		return fmt.Errorf("empty rpcMethodID")
+		return false, fmt.Errorf("empty rpcMethodID")
 	}
 
 	request := sq.Delete(rpcPeersMethodsTable).
@@ -49,13 +64,17 @@ func (s *Storage) DeleteRpcPeerMethod(peerID int, rpcMethodID *int) error {
 	}
 	query, args, err := request.ToSql()
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	_, err = s.db.ExecContext(s.ctx, query, args...)
+	res, err := s.db.ExecContext(s.ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("delete: %s", err)
+	}
+	count, err := res.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("delete: %s", err)
+		return false, fmt.Errorf("RowsAffected: %s", err)
 	}
 
-	return nil
+	return count != 0, nil
 }
@@ -0,0 +1,190 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"extrnode-be/internal/pkg/stats_types"
+)
+
+// timestamps are saved as utc text, so sqlite date functions can be used
+const statsTimeLayout = "2006-01-02 15:04:05.000"
+
+func statsTime(t time.Time) string {
+	return t.UTC().Format(statsTimeLayout)
+}
+
+func parseStatsTime(value string) (time.Time, error) {
+	t, err := time.Parse(statsTimeLayout, value)
+	if err != nil {
+		return t, fmt.Errorf("parse time %s: %s", value, err)
+	}
+
+	return t, nil
+}
+
+func (s *Storage) BatchInsertStats(stats []stats_types.Stat) error {
+	rows := make([][]interface{}, 0, len(stats))
+	for _, e := range stats {
+		rows = append(rows, []interface{}{e.UserUUID, e.RequestID, e.Status, e.ExecutionTime, e.Endpoint, e.Attempts,
+			e.ResponseTime, e.RpcErrorCode, e.UserAgent, e.RpcMethod, e.RpcRequestData, statsTime(e.Timestamp), e.Credits})
+	}
+
+	return s.batchInsert("stats", []string{"user_uuid", "request_id", "status", "execution_time_ms", "endpoint", "attempts",
+		"response_time_ms", "rpc_error_code", "user_agent", "rpc_method", "rpc_request_data", "timestamp", "credits"}, rows)
+}
+
+func (s *Storage) BatchInsertScannerMethods(sms []stats_types.ScannerMethod) error {
+	rows := make([][]interface{}, 0, len(sms))
+	for _, e := range sms {
+		rows = append(rows, []interface{}{e.ServerId, statsTime(e.Time), e.Peer, e.Method, e.TimeConnectMs, e.TimeResponseMs,
+			e.ResponseCode, e.ResponseValid})
+	}
+
+	return s.batchInsert("scanner_methods", []string{"server_id", "time", "peer", "method", "time_connect_ms", "time_response_ms",
+		"response_code", "response_valid"}, rows)
+}
+
+func (s *Storage) BatchInsertScannerPeers(sps []stats_types.ScannerPeer) error {
+	rows := make([][]interface{}, 0, len(sps))
+	for _, e := range sps {
+		rows = append(rows, []interface{}{e.ServerId, statsTime(e.Time), e.Peer, e.TimeConnectMs, e.IsAlive})
+	}
+
+	return s.batchInsert("scanner_peers", []string{"server_id", "time", "peer", "time_connect_ms", "is_alive"}, rows)
+}
+
+// batchInsert inserts rows in one transaction by prepared statement
+func (s *Storage) batchInsert(table string, columns []string, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(s.ctx, nil)
+	if err != nil {
+		return fmt.Errorf("tx begin error: %s", err)
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(columns, ", "),
+		strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "))
+	stmt, err := tx.PrepareContext(s.ctx, query)
+	if err != nil {
+		return fmt.Errorf("prepare: %s", err)
+	}
+	defer stmt.Close()
+
+	for _, row := range rows {
+		_, err = stmt.ExecContext(s.ctx, row...)
+		if err != nil {
+			return fmt.Errorf("insert: %s", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("tx commit error: %s", err)
+	}
+
+	return nil
+}
+
+// Aggregate aggregates finished days and deletes their raw stats. Unlike clickhouse, sqlite aggregates all remaining days
+// on each run, because they are deleted after aggregation. Late stats of aggregated days are added to existing totals
+func (s *Storage) Aggregate() error {
+	// stats inserted during aggregation are not deleted before they are aggregated
+	tx, err := s.db.BeginTx(s.ctx, nil)
+	if err != nil {
+		return fmt.Errorf("tx begin error: %s", err)
+	}
+	defer tx.Rollback()
+
+	today := time.Now().UTC().Format("2006-01-02")
+	err = s.InsertAggregateUserData(tx, today)
+	if err != nil {
+		return fmt.Errorf("InsertAggregateUserData: %s", err)
+	}
+	err = s.InsertAggregateAnalysisStats(tx, today)
+	if err != nil {
+		return fmt.Errorf("InsertAggregateAnalysisStats: %s", err)
+	}
+	err = s.DeleteOutdatedStats(tx, today)
+	if err != nil {
+		return fmt.Errorf("DeleteOutdatedStats: %s", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("tx commit error: %s", err)
+	}
+
+	return nil
+}
+
+func (s *Storage) InsertAggregateUserData(tx *sql.Tx, today string) error {
+	query := `INSERT INTO aggregated_user_data (user_uuid, rpc_method, total_req, success_req, http_err, rpc_err, credits, day)
+	SELECT user_uuid,
+		rpc_method,
+		count(rpc_method),
+		count(CASE WHEN rpc_error_code = '' AND status = 200 AND rpc_method != '' THEN 1 END),
+		count(CASE WHEN status != 200 THEN 1 END),
+		count(CASE WHEN rpc_error_code != '' THEN 1 END),
+		sum(credits),
+		date(timestamp) as day
+	FROM stats
+	WHERE day < ?
+	GROUP BY rpc_method, user_uuid, day
+	ON CONFLICT (user_uuid, rpc_method, day) DO UPDATE SET
+		total_req = total_req + excluded.total_req,
+		success_req = success_req + excluded.success_req,
+		http_err = http_err + excluded.http_err,
+		rpc_err = rpc_err + excluded.rpc_err,
+		credits = credits + excluded.credits`
+	_, err := tx.ExecContext(s.ctx, query, today)
+	if err != nil {
+		return fmt.Errorf("exec: %s", err)
+	}
+
+	return nil
+}
+
+// InsertAggregateAnalysisStats keeps 100 most requested rpc_request_data of each method by day.
+// Late stats are merged with existing rows, their new rpc_request_data may exceed the limit
+func (s *Storage) InsertAggregateAnalysisStats(tx *sql.Tx, today string) error {
+	query := `INSERT INTO aggregated_analysis_data (rpc_method, rpc_request_data, execution_time_ms, response_time_ms, total_req, day)
+	SELECT rpc_method, rpc_request_data, execution_time_ms, response_time_ms, c, day
+	FROM (
+		SELECT rpc_method,
+			rpc_request_data,
+			avg(execution_time_ms) as execution_time_ms,
+			avg(response_time_ms) as response_time_ms,
+			count(rpc_method) as c,
+			date(timestamp) as day,
+			ROW_NUMBER() OVER (PARTITION BY rpc_method, date(timestamp) ORDER BY count(rpc_method) DESC) as n
+		FROM stats
+		WHERE day < ?
+		GROUP BY rpc_method, rpc_request_data, day
+	)
+	WHERE n <= 100
+	ON CONFLICT (rpc_method, rpc_request_data, day) DO UPDATE SET
+		execution_time_ms = (execution_time_ms * total_req + excluded.execution_time_ms * excluded.total_req) / (total_req + excluded.total_req),
+		response_time_ms = (response_time_ms * total_req + excluded.response_time_ms * excluded.total_req) / (total_req + excluded.total_req),
+		total_req = total_req + excluded.total_req`
+	_, err := tx.ExecContext(s.ctx, query, today)
+	if err != nil {
+		return fmt.Errorf("exec: %s", err)
+	}
+
+	return nil
+}
+
+func (s *Storage) DeleteOutdatedStats(tx *sql.Tx, today string) error {
+	_, err := tx.ExecContext(s.ctx, `DELETE FROM stats WHERE date(timestamp) < ?`, today)
+	if err != nil {
+		return fmt.Errorf("exec: %s", err)
+	}
+
+	return nil
+}
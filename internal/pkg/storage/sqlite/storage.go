@@ -48,3 +48,13 @@ func New(ctx context.Context, cfg config_types.SQLiteConfig) (s Storage, err err
 		db:  db,
 	}, nil
 }
+
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// WithContext returns storage which runs queries with ctx
+func (s Storage) WithContext(ctx context.Context) Storage {
+	s.ctx = ctx
+	return s
+}
@@ -0,0 +1,81 @@
+package stats_sink
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"extrnode-be/internal/pkg/config_types"
+	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/pkg/stats_types"
+	"extrnode-be/internal/pkg/storage/clickhouse"
+	"extrnode-be/internal/pkg/storage/ndjson"
+	"extrnode-be/internal/pkg/storage/sqlite"
+)
+
+type (
+	// StatsSink saves stats collected by proxy and scanner
+	StatsSink interface {
+		Name() string
+		BatchInsertStats(stats []stats_types.Stat) error
+		BatchInsertScannerMethods(sms []stats_types.ScannerMethod) error
+		BatchInsertScannerPeers(sps []stats_types.ScannerPeer) error
+		Ping(ctx context.Context) error
+	}
+	// AggregatingSink is implemented by sinks which are able to aggregate stats
+	AggregatingSink interface {
+		StatsSink
+		Aggregate() error
+	}
+	// BackfillingSink is able to aggregate stats of already processed period again
+	BackfillingSink interface {
+		AggregatingSink
+		// ValidateBackfill returns error if the period can't be aggregated again
+		ValidateBackfill(from, to time.Time) error
+		Backfill(from, to time.Time) error
+	}
+
+	clickhouseSink struct {
+		*clickhouse.Storage
+	}
+	sqliteSink struct {
+		*sqlite.Storage
+	}
+	fileSink struct {
+		*ndjson.Storage
+	}
+)
+
+// New returns sink selected by config, nil if stats are not saved
+func New(cfg config_types.StatsConfig, chCfg config_types.ClickhouseConfig, slStorage sqlite.Storage) (StatsSink, error) {
+	switch cfg.Sink {
+	case config_types.StatsSinkClickhouse:
+		chStorage, err := clickhouse.New(chCfg)
+		if err != nil {
+			return nil, fmt.Errorf("CH storage init: %s", err)
+		}
+		if chStorage == nil {
+			return nil, nil
+		}
+		return clickhouseSink{chStorage}, nil
+	case config_types.StatsSinkSQLite:
+		// stats are flushed on stop after service context is canceled
+		storage := slStorage.WithContext(context.Background())
+		return sqliteSink{&storage}, nil
+	case config_types.StatsSinkFile:
+		storage, err := ndjson.New(cfg.FileDir, cfg.FileMaxSize, cfg.FileMaxFiles)
+		if err != nil {
+			return nil, fmt.Errorf("file storage init: %s", err)
+		}
+		return fileSink{storage}, nil
+	case config_types.StatsSinkNone:
+		log.Logger.General.Infof("start without stats sink")
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unknown sink: %s", cfg.Sink)
+}
+
+func (clickhouseSink) Name() string { return config_types.StatsSinkClickhouse }
+func (sqliteSink) Name() string     { return config_types.StatsSinkSQLite }
+func (fileSink) Name() string       { return config_types.StatsSinkFile }
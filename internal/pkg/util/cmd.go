@@ -10,6 +10,7 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// GracefulStop calls stopFunc on SIGTERM or SIGINT and waits for waitGroup. Zero waitTimeout means waiting without limit
 func GracefulStop(waitGroup *sync.WaitGroup, waitTimeout time.Duration, stopFunc func()) {
 	var gracefulStop = make(chan os.Signal, 1)
 	signal.Notify(gracefulStop, syscall.SIGTERM, syscall.SIGINT)
@@ -27,10 +28,16 @@ func GracefulStop(waitGroup *sync.WaitGroup, waitTimeout time.Duration, stopFunc
 			waitGroup.Wait()
 		}()
 
+		// nil channel blocks forever
+		var timeout <-chan time.Time
+		if waitTimeout > 0 {
+			timeout = time.After(waitTimeout)
+		}
+
 		select {
 		case <-closeChan:
 			log.Info("Service stopped")
-		case <-time.After(waitTimeout):
+		case <-timeout:
 			log.Warnf("Service stopped after timeout")
 		}
 	}
@@ -3,9 +3,10 @@ package echo
 import (
 	"time"
 
-	"firebase.google.com/go/v4/auth"
 	"github.com/labstack/echo/v4"
 
+	"extrnode-be/internal/pkg/auth_providers"
+	"extrnode-be/internal/pkg/storage/postgres"
 	"extrnode-be/internal/pkg/util/solana"
 )
 
@@ -22,7 +23,9 @@ type CustomContext struct {
 	proxyUserError    bool
 	proxyHasError     bool
 	reqDuration       time.Time
-	user              *auth.UserRecord
+	user              *auth_providers.User
+	apiTokenPolicy    *postgres.Policy
+	credits           uint64
 }
 
 func (c *CustomContext) SetReqMethods(reqMethods []string) {
@@ -51,6 +54,10 @@ func (c *CustomContext) GetReqBody() string {
 	return string(c.reqBody)
 }
 
+func (c *CustomContext) GetReqBodyLen() int {
+	return len(c.reqBody)
+}
+
 func (c *CustomContext) SetResBody(resBody string) {
 	c.resBody = resBody
 }
@@ -115,10 +122,26 @@ func (c *CustomContext) GetReqDuration() time.Time {
 	return c.reqDuration
 }
 
-func (c *CustomContext) SetUser(u *auth.UserRecord) {
+func (c *CustomContext) SetUser(u *auth_providers.User) {
 	c.user = u
 }
 
-func (c *CustomContext) GetUser() *auth.UserRecord {
+func (c *CustomContext) GetUser() *auth_providers.User {
 	return c.user
 }
+
+func (c *CustomContext) SetApiTokenPolicy(p *postgres.Policy) {
+	c.apiTokenPolicy = p
+}
+
+func (c *CustomContext) GetApiTokenPolicy() *postgres.Policy {
+	return c.apiTokenPolicy
+}
+
+func (c *CustomContext) SetCredits(credits uint64) {
+	c.credits = credits
+}
+
+func (c *CustomContext) GetCredits() uint64 {
+	return c.credits
+}
@@ -1,12 +1,15 @@
 package echo
 
 import (
+	"context"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	log2 "github.com/labstack/gommon/log"
+	"golang.org/x/time/rate"
 
 	"extrnode-be/internal/pkg/log"
 )
@@ -16,7 +19,19 @@ const (
 	apiWriteTimeout = 30 * time.Second
 )
 
+const defaultRateLimit = 20 // req per second
+
 func InitHandlersStart(router *echo.Echo) {
+	initHandlersStart(router, true, middleware.NewRateLimiterMemoryStore(defaultRateLimit))
+}
+
+// InitStreamingHandlersStart is used by handlers which relay large bodies.
+// Timeout middleware buffers the whole response, so only request context deadline is set here
+func InitStreamingHandlersStart(router *echo.Echo, rateLimiterStore middleware.RateLimiterStore) {
+	initHandlersStart(router, false, rateLimiterStore)
+}
+
+func initHandlersStart(router *echo.Echo, withTimeoutHandler bool, rateLimiterStore middleware.RateLimiterStore) {
 	router.Use(middleware.RecoverWithConfig(middleware.RecoverConfig{
 		DisableStackAll: true,
 		LogErrorFunc:    LogPanic,
@@ -28,13 +43,50 @@ func InitHandlersStart(router *echo.Echo) {
 			})
 		}
 	})
-	router.Use(middleware.TimeoutWithConfig(middleware.TimeoutConfig{
-		ErrorMessage: "Request Timeout",
-		Timeout:      apiWriteTimeout,
-	}))
+	if withTimeoutHandler {
+		router.Use(middleware.TimeoutWithConfig(middleware.TimeoutConfig{
+			ErrorMessage: "Request Timeout",
+			Timeout:      apiWriteTimeout,
+		}))
+	} else {
+		router.Use(requestTimeout(apiWriteTimeout))
+	}
 
 	// general rate limit
-	router.Use(middleware.RateLimiter(middleware.NewRateLimiterMemoryStore(20))) // req per second
+	router.Use(middleware.RateLimiter(rateLimiterStore))
+}
+
+// ReloadableRateLimiterStore allows to change rate limit of the running server
+type ReloadableRateLimiterStore struct {
+	store atomic.Value
+}
+
+func NewReloadableRateLimiterStore(rateLimit float64) *ReloadableRateLimiterStore {
+	s := &ReloadableRateLimiterStore{}
+	s.SetRateLimit(rateLimit)
+
+	return s
+}
+
+// SetRateLimit replaces the store, so visitors counters are reset
+func (s *ReloadableRateLimiterStore) SetRateLimit(rateLimit float64) {
+	s.store.Store(middleware.NewRateLimiterMemoryStore(rate.Limit(rateLimit)))
+}
+
+func (s *ReloadableRateLimiterStore) Allow(identifier string) (bool, error) {
+	return s.store.Load().(*middleware.RateLimiterMemoryStore).Allow(identifier)
+}
+
+func requestTimeout(timeout time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			timeoutCtx, cancel := context.WithTimeout(c.Request().Context(), timeout)
+			defer cancel()
+			c.SetRequest(c.Request().WithContext(timeoutCtx))
+
+			return next(c)
+		}
+	}
 }
 
 func SetupServer(router *echo.Echo) {
@@ -104,3 +104,12 @@ const (
 	GetTokenAccountsByDelegate        = "getTokenAccountsByDelegate"
 	GetTokenSupply                    = "getTokenSupply"
 )
+
+// account data encodings accepted in 'encoding' field of request config
+var EncodingList = map[string]struct{}{
+	"base58":      {},
+	"base64":      {},
+	"base64+zstd": {},
+	"json":        {},
+	"jsonParsed":  {},
+}
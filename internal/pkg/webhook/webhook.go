@@ -0,0 +1,184 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+const (
+	HeaderEvent     = "X-Extrnode-Event"
+	HeaderEventID   = "X-Extrnode-Event-Id"
+	HeaderSignature = "X-Extrnode-Signature"
+
+	// MaxErrorLen limits error of failed request saved to delivery log
+	MaxErrorLen = 1000
+
+	secretLen         = 32
+	retryMinDelay     = time.Minute
+	retryMaxDelay     = time.Hour
+	responseBodyLimit = 1 << 10
+)
+
+var (
+	ErrInvalidURL       = errors.New("webhook url must be https url")
+	ErrForbiddenAddress = errors.New("webhook address is not public")
+
+	// reserved ranges which are not covered by net.IP methods
+	forbiddenNets = mustParseCIDRs("0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15", "240.0.0.0/4")
+)
+
+// Client posts signed json events. Urls are set by users, so it connects only to public addresses
+type Client struct {
+	client *http.Client
+}
+
+func NewClient(timeout time.Duration) Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		// address is checked after resolving, so host can't be resolved to another ip after validation
+		Control: dialControl,
+	}
+
+	return Client{client: &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// proxy from environment would be dialed instead of the webhook address
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConnsPerHost: 2,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}}
+}
+
+func (c Client) Timeout() time.Duration {
+	return c.client.Timeout
+}
+
+// Post sends event body signed by secret. Error is returned for non 2xx response too, statusCode is 0 if there is no response
+func (c Client) Post(ctx context.Context, url, secret, event, eventID string, body []byte) (statusCode int, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("NewRequest: %s", err)
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderEventID, eventID)
+	req.Header.Set(HeaderSignature, fmt.Sprintf("t=%d,v1=%s", timestamp, Sign(secret, timestamp, body)))
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	// body is read, so connection is reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, responseBodyLimit))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("response status %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
+
+// ValidateURL checks that webhook url is https url. Host given by ip must be public, resolved hosts are checked on dial
+func ValidateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+		return ErrInvalidURL
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !isPublicIP(ip) {
+		return ErrForbiddenAddress
+	}
+
+	return nil
+}
+
+func dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("SplitHostPort: %s", err)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return ErrForbiddenAddress
+	}
+
+	return nil
+}
+
+// isPublicIP rejects loopback, private, link-local and other non routable addresses
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, n := range forbiddenNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	res := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		res = append(res, n)
+	}
+
+	return res
+}
+
+// NewSecret returns random secret signing webhooks
+func NewSecret() (string, error) {
+	b := make([]byte, secretLen)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("rand.Read: %s", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// Sign returns hex hmac-sha256 of "<timestamp>.<body>" by secret. Receiver checks it and the timestamp
+// to reject forged and replayed requests
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%d.", timestamp)))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// RetryDelay returns delay before the next attempt, it doubles after each attempt
+func RetryDelay(attempts int) time.Duration {
+	delay := retryMinDelay
+	for i := 1; i < attempts && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+
+	return delay
+}
@@ -0,0 +1,211 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+
+	"extrnode-be/internal/pkg/config_types"
+	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/pkg/storage/delayed_insertion"
+	"extrnode-be/internal/pkg/util/solana"
+	"extrnode-be/internal/proxy/middlewares"
+)
+
+type (
+	targetUrlReq struct {
+		Url string `json:"url"`
+	}
+	pinnedTargetReq struct {
+		Url              string   `json:"url"`
+		SupportedMethods []string `json:"supported_methods"`
+		// duration string, e.g. 1h30m. Empty means no expiration
+		Ttl string `json:"ttl"`
+	}
+	backfillReq struct {
+		// RFC3339 times, stats of [from, to) are aggregated again
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	targetsResp struct {
+		Targets         []middlewares.TargetInfo `json:"targets"`
+		FailoverTargets []middlewares.TargetInfo `json:"failover_targets"`
+	}
+)
+
+// initAdminHandlers registers target management api on the metrics server. Api is disabled without admin token
+func (p *proxy) initAdminHandlers(transport *middlewares.ProxyTransport) {
+	if p.adminToken == "" {
+		return
+	}
+
+	adminGroup := p.metricsServer.Group("/admin", middleware.KeyAuth(func(key string, c echo.Context) (bool, error) {
+		return subtle.ConstantTimeCompare([]byte(key), []byte(p.adminToken)) == 1, nil
+	}))
+
+	adminGroup.GET("/targets", func(c echo.Context) error {
+		targets, failoverTargets := transport.Targets()
+		return c.JSON(http.StatusOK, targetsResp{Targets: targets, FailoverTargets: failoverTargets})
+	})
+	adminGroup.POST("/targets/drain", targetStateHandler(transport.DrainTarget))
+	adminGroup.POST("/targets/ban", targetStateHandler(transport.BanTarget))
+	adminGroup.POST("/targets/unban", targetStateHandler(transport.UnbanTarget))
+	adminGroup.POST("/targets/pinned", func(c echo.Context) error {
+		var req pinnedTargetReq
+		err := c.Bind(&req)
+		if err != nil {
+			return err
+		}
+
+		targetUrl, err := parseTargetUrl(req.Url)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		var ttl time.Duration
+		if req.Ttl != "" {
+			ttl, err = time.ParseDuration(req.Ttl)
+			if err != nil || ttl < 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid ttl")
+			}
+		}
+		supportedMethods := make(map[string]struct{}, len(req.SupportedMethods))
+		for _, m := range req.SupportedMethods {
+			if _, ok := solana.FullMethodList[m]; !ok {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown method: %s", m))
+			}
+			supportedMethods[m] = struct{}{}
+		}
+
+		transport.AddPinnedTarget(middlewares.UrlWithMethods{Url: targetUrl, SupportedMethods: supportedMethods}, ttl)
+
+		return c.NoContent(http.StatusNoContent)
+	})
+	adminGroup.DELETE("/targets/pinned", func(c echo.Context) error {
+		targetUrl, err := parseTargetUrl(c.QueryParam("url"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		err = transport.RemovePinnedTarget(targetUrl)
+		if errors.Is(err, middlewares.ErrTargetNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	})
+	adminGroup.POST("/targets/reload", func(c echo.Context) error {
+		select {
+		case p.reloadEndpoints <- struct{}{}:
+		default:
+			// reload is already scheduled
+		}
+
+		return c.NoContent(http.StatusAccepted)
+	})
+	// with config watch the file is the source of failover targets, admin changes would be lost on the next reload
+	configWatch := p.cfg.Proxy.ConfigWatchInterval > 0
+	adminGroup.PUT("/failover_targets", func(c echo.Context) error {
+		if configWatch {
+			return echo.NewHTTPError(http.StatusConflict, "failover targets are managed by config file while config watch is enabled")
+		}
+
+		var failoverTargets config_types.FailoverTargets
+		err := c.Bind(&failoverTargets)
+		if err != nil {
+			return err
+		}
+		for _, ft := range failoverTargets {
+			_, err = parseTargetUrl(ft.Url)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+		}
+
+		err = transport.SetFailoverTargets(failoverTargets)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		log.Logger.Proxy.Infof("Admin: failover targets replaced, %d targets", len(failoverTargets))
+
+		return c.NoContent(http.StatusNoContent)
+	})
+	adminGroup.POST("/stats/backfill", func(c echo.Context) error {
+		if !p.aggregator.BackfillSupported() {
+			return echo.NewHTTPError(http.StatusNotImplemented, delayed_insertion.ErrBackfillUnsupported.Error())
+		}
+
+		var req backfillReq
+		err := c.Bind(&req)
+		if err != nil {
+			return err
+		}
+
+		from, err := time.Parse(time.RFC3339, req.From)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid from")
+		}
+		to, err := time.Parse(time.RFC3339, req.To)
+		if err != nil || !to.After(from) {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid to")
+		}
+		err = p.aggregator.ValidateBackfill(from, to)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		// backfill may take long, result is logged
+		go func() {
+			err := p.aggregator.Backfill(from, to)
+			if err != nil {
+				log.Logger.Proxy.Errorf("Admin: backfill from %s to %s: %s", req.From, req.To, err)
+				return
+			}
+			log.Logger.Proxy.Infof("Admin: backfill from %s to %s is finished", req.From, req.To)
+		}()
+
+		return c.NoContent(http.StatusAccepted)
+	})
+}
+
+func targetStateHandler(setState func(u *url.URL) error) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req targetUrlReq
+		err := c.Bind(&req)
+		if err != nil {
+			return err
+		}
+
+		targetUrl, err := parseTargetUrl(req.Url)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		err = setState(targetUrl)
+		if errors.Is(err, middlewares.ErrTargetNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		if err != nil {
+			return err
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func parseTargetUrl(rawUrl string) (*url.URL, error) {
+	parsedUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %s", err)
+	}
+	if parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https" || parsedUrl.Host == "" {
+		return nil, fmt.Errorf("invalid url: %s", rawUrl)
+	}
+
+	return parsedUrl, nil
+}
@@ -10,6 +10,9 @@ type Config struct {
 	Proxy config_types.ProxyConfig
 	SL    config_types.SQLiteConfig
 	CH    config_types.ClickhouseConfig
+	Stats config_types.StatsConfig
+	// optional, api token policies are not enforced without it
+	PG config_types.PostgresConfig
 }
 
 func (c Config) Validate() error {
@@ -19,6 +22,17 @@ func (c Config) Validate() error {
 	if err := c.SL.Validate(); err != nil {
 		return fmt.Errorf("sqlite: %s", err)
 	}
+	if err := c.CH.Validate(); err != nil {
+		return fmt.Errorf("clickhouse: %s", err)
+	}
+	if err := c.Stats.Validate(); err != nil {
+		return fmt.Errorf("stats: %s", err)
+	}
+	if c.PG.Host != "" {
+		if err := c.PG.Validate(); err != nil {
+			return fmt.Errorf("postgres: %s", err)
+		}
+	}
 
 	return nil
 }
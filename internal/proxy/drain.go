@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"extrnode-be/internal/pkg/log"
+)
+
+// listen creates listener, with SO_REUSEPORT another process is able to listen the same port
+func (p *proxy) listen(port uint64) (net.Listener, error) {
+	addr := fmt.Sprintf(":%d", port)
+	if !p.reusePort {
+		return net.Listen("tcp", addr)
+	}
+
+	lc := net.ListenConfig{Control: reusePortControl}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
+
+// drain stops proxy server gracefully: readiness check fails, requests are still served during drain delay,
+// then listener is closed and in-flight requests are given drain timeout to finish
+func (p *proxy) drain() {
+	// readiness fails as soon as drain is started, so load balancers stop sending new requests
+	p.health.SetDraining()
+	// clients reconnect after current request, new connections go to other instances
+	p.router.Server.SetKeepAlivesEnabled(false)
+	p.router.TLSServer.SetKeepAlivesEnabled(false)
+
+	if p.drainDelay > 0 {
+		log.Logger.Proxy.Infof("Drain: waiting %s before closing listener", p.drainDelay)
+		time.Sleep(p.drainDelay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.drainTimeout)
+	defer cancel()
+	err := p.router.Shutdown(ctx)
+	if err != nil {
+		log.Logger.Proxy.Errorf("Drain: router.Shutdown: %s", err)
+	}
+	log.Logger.Proxy.Info("Drain: proxy server stopped")
+}
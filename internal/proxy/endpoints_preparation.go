@@ -77,6 +77,15 @@ func (p *proxy) updateProxyEndpoints(transport *middlewares.ProxyTransport) {
 		transport.UpdateTargets(urlsWithMethods)
 		metrics.ObserveAvailableEndpoints(len(urlsWithMethods))
 
-		time.Sleep(endpointsReloadInterval)
+		timer := time.NewTimer(endpointsReloadInterval)
+		select {
+		case <-p.ctx.Done():
+			timer.Stop()
+			return
+		case <-p.reloadEndpoints:
+			timer.Stop()
+			log.Logger.Proxy.Info("Endpoints reload is forced")
+		case <-timer.C:
+		}
 	}
 }
@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+
+	"extrnode-be/internal/pkg/storage/postgres"
+	"extrnode-be/internal/pkg/storage/stats_sink"
+)
+
+type (
+	targetsHealthInfo struct {
+		Targets         int `json:"targets"`
+		FailoverTargets int `json:"failover_targets"`
+	}
+	collectorHealthInfo struct {
+		Backlog int `json:"backlog"`
+	}
+	sinkHealthInfo struct {
+		Sink string `json:"sink"`
+	}
+)
+
+// initHealthChecks registers dependencies checks. Nil storages are not configured and not checked
+func (p *proxy) initHealthChecks(sink stats_sink.StatsSink, pgStorage *postgres.Storage) {
+	p.health.AddCheck("sqlite", true, func(ctx context.Context) (interface{}, error) {
+		return nil, p.slStorage.Ping(ctx)
+	})
+	if pgStorage != nil {
+		// api token policies are loaded from postgres
+		p.health.AddCheck("postgres", true, func(ctx context.Context) (interface{}, error) {
+			return nil, pgStorage.Ping(ctx)
+		})
+	}
+	if sink != nil {
+		// stats are collected in memory while sink is unavailable
+		p.health.AddCheck("stats_sink", false, func(ctx context.Context) (interface{}, error) {
+			return sinkHealthInfo{Sink: sink.Name()}, sink.Ping(ctx)
+		})
+	}
+	p.health.AddCheck("targets", true, func(ctx context.Context) (interface{}, error) {
+		if p.transport == nil {
+			return nil, errors.New("transport is not initialized")
+		}
+		var info targetsHealthInfo
+		info.Targets, info.FailoverTargets = p.transport.AvailableTargetsCount()
+		if info.Targets+info.FailoverTargets == 0 {
+			return info, errors.New("no available targets")
+		}
+
+		return info, nil
+	})
+	p.health.AddCheck("stats_collector", false, func(ctx context.Context) (interface{}, error) {
+		return collectorHealthInfo{Backlog: p.statsCollector.Len()}, nil
+	})
+}
@@ -0,0 +1,212 @@
+package middlewares
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	encodingIdentity = ""
+	encodingGzip     = "gzip"
+	encodingBrotli   = "br"
+	encodingZstd     = "zstd"
+
+	// upstream responses are inspected, so only encodings we can decode are requested
+	upstreamAcceptEncoding = encodingGzip
+	// responses below this size are sent as is, compression doesn't pay off
+	compressionMinLength = 1024
+	brotliLevel          = 4
+)
+
+// preferred order of encodings when client accepts several of them with the same weight
+var supportedEncodings = []string{encodingZstd, encodingBrotli, encodingGzip}
+
+// negotiateEncoding returns the best supported encoding accepted by the client.
+// When client accepts upstreamEncoding it is preferred, so the body is passed through without recompression
+func negotiateEncoding(acceptEncoding, upstreamEncoding string) string {
+	accepted := parseAcceptEncoding(acceptEncoding)
+	if upstreamEncoding != encodingIdentity {
+		if _, ok := accepted[upstreamEncoding]; ok {
+			return upstreamEncoding
+		}
+	}
+
+	res := encodingIdentity
+	var resQ float64
+	for _, e := range supportedEncodings {
+		if q, ok := accepted[e]; ok && q > resQ {
+			res, resQ = e, q
+		}
+	}
+
+	return res
+}
+
+// parseAcceptEncoding returns accepted encodings with their weights. Encodings with q=0 are skipped
+func parseAcceptEncoding(header string) map[string]float64 {
+	res := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		q := 1.0
+		name, params, found := strings.Cut(part, ";")
+		if found {
+			params = strings.TrimSpace(params)
+			if strings.HasPrefix(params, "q=") {
+				parsedQ, err := strconv.ParseFloat(params[2:], 64)
+				if err != nil {
+					continue
+				}
+				q = parsedQ
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "*" {
+			for _, e := range supportedEncodings {
+				if _, ok := res[e]; !ok {
+					res[e] = q
+				}
+			}
+			continue
+		}
+		res[name] = q
+	}
+
+	return res
+}
+
+type readCloser struct {
+	io.Reader
+	closeFunc func() error
+}
+
+func (rc readCloser) Close() error {
+	return rc.closeFunc()
+}
+
+func newDecodingReader(r io.Reader, encoding string) (io.Reader, error) {
+	switch encoding {
+	case encodingIdentity:
+		return r, nil
+	case encodingGzip:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("gzip.NewReader: %s", err)
+		}
+
+		return gr, nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding: %s", encoding)
+	}
+}
+
+func newEncodingWriter(w io.Writer, encoding string) (io.WriteCloser, error) {
+	switch encoding {
+	case encodingGzip:
+		return gzip.NewWriter(w), nil
+	case encodingBrotli:
+		return brotli.NewWriterLevel(w, brotliLevel), nil
+	case encodingZstd:
+		zw, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("zstd.NewWriter: %s", err)
+		}
+
+		return zw, nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding: %s", encoding)
+	}
+}
+
+func decodeBody(body []byte, encoding string) ([]byte, error) {
+	if encoding == encodingIdentity {
+		return body, nil
+	}
+
+	r, err := newDecodingReader(bytes.NewReader(body), encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(r)
+}
+
+func setResponseBody(res *http.Response, body []byte, encoding string) {
+	res.Body = io.NopCloser(bytes.NewBuffer(body))
+	res.ContentLength = int64(len(body))
+	res.Header.Set(echo.HeaderContentLength, strconv.Itoa(len(body)))
+	if encoding == encodingIdentity {
+		res.Header.Del(echo.HeaderContentEncoding)
+	} else {
+		res.Header.Set(echo.HeaderContentEncoding, encoding)
+	}
+}
+
+// recompressResponse converts upstream response body to the encoding accepted by the client.
+// Body is converted on the fly, so large responses are not buffered
+func recompressResponse(res *http.Response, acceptEncoding string) error {
+	upstreamEncoding := strings.ToLower(res.Header.Get(echo.HeaderContentEncoding))
+	res.Header.Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+
+	encoding := negotiateEncoding(acceptEncoding, upstreamEncoding)
+	if encoding == upstreamEncoding {
+		return nil
+	}
+	if upstreamEncoding == encodingIdentity && res.ContentLength >= 0 && res.ContentLength < compressionMinLength {
+		return nil
+	}
+
+	upstreamBody := res.Body
+	decodedBody, err := newDecodingReader(upstreamBody, upstreamEncoding)
+	if err != nil {
+		return fmt.Errorf("newDecodingReader: %s", err)
+	}
+
+	// length is unknown after conversion, response is sent chunked
+	res.ContentLength = -1
+	res.Header.Del(echo.HeaderContentLength)
+	if encoding == encodingIdentity {
+		res.Header.Del(echo.HeaderContentEncoding)
+		res.Body = readCloser{Reader: decodedBody, closeFunc: upstreamBody.Close}
+		return nil
+	}
+
+	encodedBody, bodyWriter := io.Pipe()
+	encoder, err := newEncodingWriter(bodyWriter, encoding)
+	if err != nil {
+		return fmt.Errorf("newEncodingWriter: %s", err)
+	}
+	go func() {
+		_, err := io.Copy(encoder, decodedBody)
+		closeErr := encoder.Close()
+		if err == nil {
+			err = closeErr
+		}
+		bodyWriter.CloseWithError(err)
+	}()
+
+	res.Header.Set(echo.HeaderContentEncoding, encoding)
+	res.Body = readCloser{Reader: encodedBody, closeFunc: func() error {
+		// stops encoder goroutine if client has gone
+		encodedBody.Close()
+		return upstreamBody.Close()
+	}}
+
+	return nil
+}
@@ -45,6 +45,12 @@ type (
 		//
 		// See also: https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Access-Control-Allow-Headers
 		AllowHeaders []string `yaml:"allow_headers"`
+
+		// AllowOriginsFunc returns origins allowed for the particular request, e.g. for api token.
+		// Non-empty result replaces AllowOrigins, preflight requests are checked the same way.
+		//
+		// Optional.
+		AllowOriginsFunc func(c echo.Context) ([]string, error) `yaml:"-"`
 	}
 )
 
@@ -69,14 +75,7 @@ func CORSWithConfig(config CORSConfig) echo.MiddlewareFunc {
 		config.AllowMethods = DefaultCORSConfig.AllowMethods
 	}
 
-	allowOriginPatterns := []string{}
-	for _, origin := range config.AllowOrigins {
-		pattern := regexp.QuoteMeta(origin)
-		pattern = strings.Replace(pattern, "\\*", ".*", -1)
-		pattern = strings.Replace(pattern, "\\?", ".", -1)
-		pattern = "^" + pattern + "$"
-		allowOriginPatterns = append(allowOriginPatterns, pattern)
-	}
+	allowOriginPatterns := originPatterns(config.AllowOrigins)
 
 	allowMethods := strings.Join(config.AllowMethods, ",")
 	allowHeaders := strings.Join(config.AllowHeaders, ",")
@@ -86,7 +85,6 @@ func CORSWithConfig(config CORSConfig) echo.MiddlewareFunc {
 			req := c.Request()
 			res := c.Response()
 			origin := req.Header.Get(echo.HeaderOrigin)
-			allowOrigin := ""
 
 			res.Header().Add(echo.HeaderVary, echo.HeaderOrigin)
 
@@ -117,36 +115,26 @@ func CORSWithConfig(config CORSConfig) echo.MiddlewareFunc {
 				return c.NoContent(http.StatusNoContent)
 			}
 
-			// Check allowed origins
-			for _, o := range config.AllowOrigins {
-				if o == "*" || o == origin {
-					allowOrigin = o
-					break
+			allowOrigins, patterns := config.AllowOrigins, allowOriginPatterns
+			restricted := false
+			if config.AllowOriginsFunc != nil {
+				reqAllowOrigins, err := config.AllowOriginsFunc(c)
+				if err != nil {
+					return err
 				}
-				if matchSubdomain(origin, o) {
-					allowOrigin = origin
-					break
-				}
-			}
-
-			checkPatterns := false
-			if allowOrigin == "" {
-				// to avoid regex cost by invalid (long) domains (253 is domain name max limit)
-				if len(origin) <= (253+3+5) && strings.Contains(origin, "://") {
-					checkPatterns = true
-				}
-			}
-			if checkPatterns {
-				for _, re := range allowOriginPatterns {
-					if match, _ := regexp.MatchString(re, origin); match {
-						allowOrigin = origin
-						break
-					}
+				if len(reqAllowOrigins) != 0 {
+					allowOrigins, patterns = reqAllowOrigins, originPatterns(reqAllowOrigins)
+					restricted = true
 				}
 			}
+			allowOrigin := matchOrigin(origin, allowOrigins, patterns)
 
 			// Origin not allowed
 			if allowOrigin == "" {
+				// origins restricted for the particular request (e.g. api token) are enforced, not only advertised
+				if restricted && !preflight {
+					return echo.NewHTTPError(http.StatusForbidden, originNotAllowedErrorResponse)
+				}
 				if !preflight {
 					return next(c)
 				}
@@ -189,6 +177,44 @@ func CORSWithConfig(config CORSConfig) echo.MiddlewareFunc {
 	}
 }
 
+func originPatterns(allowOrigins []string) []string {
+	allowOriginPatterns := make([]string, 0, len(allowOrigins))
+	for _, origin := range allowOrigins {
+		pattern := regexp.QuoteMeta(origin)
+		pattern = strings.Replace(pattern, "\\*", ".*", -1)
+		pattern = strings.Replace(pattern, "\\?", ".", -1)
+		pattern = "^" + pattern + "$"
+		allowOriginPatterns = append(allowOriginPatterns, pattern)
+	}
+
+	return allowOriginPatterns
+}
+
+// matchOrigin returns value for Access-Control-Allow-Origin header, empty if origin is not allowed
+func matchOrigin(origin string, allowOrigins, allowOriginPatterns []string) string {
+	// Check allowed origins
+	for _, o := range allowOrigins {
+		if o == "*" || o == origin {
+			return o
+		}
+		if matchSubdomain(origin, o) {
+			return origin
+		}
+	}
+
+	// to avoid regex cost by invalid (long) domains (253 is domain name max limit)
+	if len(origin) > (253+3+5) || !strings.Contains(origin, "://") {
+		return ""
+	}
+	for _, re := range allowOriginPatterns {
+		if match, _ := regexp.MatchString(re, origin); match {
+			return origin
+		}
+	}
+
+	return ""
+}
+
 func matchScheme(domain, pattern string) bool {
 	didx := strings.Index(domain, ":")
 	pidx := strings.Index(pattern, ":")
@@ -9,9 +9,14 @@ import (
 	"strings"
 
 	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+	"github.com/labstack/echo/v4"
 )
 
-var ErrInvalidRequest = errors.New("invalid request")
+var (
+	ErrInvalidRequest = errors.New("invalid request")
+	// body of response is partially consumed, so response can't be returned to the client
+	ErrReadResponseBody = errors.New("read response body")
+)
 
 const (
 	BlockCleanedUpErrCode                           = -32001
@@ -40,31 +45,51 @@ const (
 )
 
 func (ptc *proxyTransportWithContext) decodeNodeResponse(httpResponse *http.Response) (errs []error) {
-	body, err := io.ReadAll(httpResponse.Body)
+	// clean possible old value
+	ptc.c.SetRpcErrors(nil)
+
+	rawBody, isBuffered, err := bufferResponseBody(httpResponse, ptc.transport.responseBufferLimit)
 	if err != nil {
-		return append(errs, fmt.Errorf("ReadAll: %s", err))
+		httpResponse.Body.Close()
+		return append(errs, fmt.Errorf("%w: bufferResponseBody: %s", ErrReadResponseBody, err))
 	}
 
-	httpResponse.Body = io.NopCloser(bytes.NewBuffer(body))
+	// body is decompressed only for inspection, compressed one is relayed when client accepts its encoding
+	upstreamEncoding := strings.ToLower(httpResponse.Header.Get(echo.HeaderContentEncoding))
+	if !isBuffered {
+		// large response is streamed to the client without retries, so errors are only saved for logs and metrics
+		ptc.inspectResponsePrefix(rawBody, upstreamEncoding)
+		return nil
+	}
+
+	body, err := decodeBody(rawBody, upstreamEncoding)
+	if err != nil {
+		httpResponse.Body = io.NopCloser(bytes.NewBuffer(rawBody))
+		return append(errs, fmt.Errorf("decodeBody: %s", err))
+	}
+	if upstreamEncoding == encodingIdentity || negotiateEncoding(ptc.c.Request().Header.Get(echo.HeaderAcceptEncoding), upstreamEncoding) == upstreamEncoding {
+		httpResponse.Body = io.NopCloser(bytes.NewBuffer(rawBody))
+	} else {
+		setResponseBody(httpResponse, body, encodingIdentity)
+	}
 	decoder := newJsonDecoder(body, false)
 
 	// trim after cloning
-	bodyString := string(bytes.TrimSpace(body))
+	trimmedBody := bytes.TrimSpace(body)
 	// truncate body for context
-	if len(bodyString) > bodyLimit {
-		bodyString = bodyString[:bodyLimit]
+	truncatedBody := trimmedBody
+	if len(truncatedBody) > bodyLimit {
+		truncatedBody = truncatedBody[:bodyLimit]
 	}
 	// save truncated body to context before handling it. Used in logger
-	ptc.c.SetResBody(bodyString)
-	// clean possible old value
-	ptc.c.SetRpcErrors(nil)
+	ptc.c.SetResBody(string(truncatedBody))
 
-	if len(bodyString) == 0 {
+	if len(trimmedBody) == 0 {
 		return append(errs, errors.New("empty body"))
 	}
 
 	var errCodes []int
-	switch fs := bodyString[0]; {
+	switch fs := trimmedBody[0]; {
 	case fs == '{':
 		var rpcResponse RPCResponse
 		rpcMethod := ptc.c.GetReqMethod()
@@ -168,10 +193,12 @@ func rpcErrorAnalysis(errs []error) error {
 }
 
 func (ptc *proxyTransportWithContext) getResponseError(httpResponse *http.Response) error {
-	err := ptc.decodeNodeResponse(httpResponse)
-	if err == nil {
-		return nil
+	errs := ptc.decodeNodeResponse(httpResponse)
+	for _, err := range errs {
+		if errors.Is(err, ErrReadResponseBody) {
+			return err
+		}
 	}
 
-	return rpcErrorAnalysis(err)
+	return rpcErrorAnalysis(errs)
 }
@@ -0,0 +1,137 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+
+	solana2 "extrnode-be/internal/pkg/util/solana"
+)
+
+type ValidatorConfig struct {
+	MaxBodySize    int64
+	MaxBatchLength int
+	MaxParamsDepth int
+
+	// method specific guards
+	AllowUnfilteredProgramAccounts bool
+	MaxSignaturesLimit             uint64
+	MaxBlocksRange                 uint64
+}
+
+// reasons of request rejection, used in metrics
+const (
+	rejectReasonBodySize    = "body_size"
+	rejectReasonBatchLength = "batch_length"
+	rejectReasonParamsDepth = "params_depth"
+	rejectReasonMethodGuard = "method_guard"
+)
+
+func newRequestRejectedError(format string, args ...interface{}) *jsonrpc.RPCError {
+	return &jsonrpc.RPCError{
+		Code:    requestRejectedErrCode,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// checkRequestLimits returns error and rejection reason if request exceeds configured limits.
+// Method guards are lifted for keys of plans allowing heavy requests
+func (cfg ValidatorConfig) checkRequestLimits(req RPCRequest, liftMethodGuards bool) (*jsonrpc.RPCError, string) {
+	if cfg.MaxParamsDepth > 0 && paramsDepth(req.Params) > cfg.MaxParamsDepth {
+		return &jsonrpc.RPCError{
+			Code:    InvalidParamsErrCode,
+			Message: fmt.Sprintf("Invalid params: nesting depth exceeds %d", cfg.MaxParamsDepth),
+		}, rejectReasonParamsDepth
+	}
+
+	if liftMethodGuards {
+		return nil, ""
+	}
+
+	params, _ := req.Params.([]interface{})
+	switch req.Method {
+	case solana2.GetProgramAccounts:
+		if cfg.AllowUnfilteredProgramAccounts {
+			break
+		}
+		filters, _ := getParamsConfigField(params, 1, "filters").([]interface{})
+		if len(filters) == 0 {
+			return newRequestRejectedError("%s without filters is not allowed", req.Method), rejectReasonMethodGuard
+		}
+	case solana2.GetSignaturesForAddress:
+		limit, ok := getUintValue(getParamsConfigField(params, 1, "limit"))
+		if ok && cfg.MaxSignaturesLimit > 0 && limit > cfg.MaxSignaturesLimit {
+			return newRequestRejectedError("%s limit must not exceed %d", req.Method, cfg.MaxSignaturesLimit), rejectReasonMethodGuard
+		}
+	case solana2.GetBlocks:
+		if cfg.MaxBlocksRange == 0 || len(params) < 2 {
+			// without end slot the range is limited by the node itself
+			break
+		}
+		startSlot, startOk := getUintValue(params[0])
+		endSlot, endOk := getUintValue(params[1])
+		if startOk && endOk && endSlot > startSlot && endSlot-startSlot > cfg.MaxBlocksRange {
+			return newRequestRejectedError("%s range must not exceed %d slots", req.Method, cfg.MaxBlocksRange), rejectReasonMethodGuard
+		}
+	case solana2.GetBlocksWithLimit:
+		if cfg.MaxBlocksRange == 0 || len(params) < 2 {
+			break
+		}
+		limit, ok := getUintValue(params[1])
+		if ok && limit > cfg.MaxBlocksRange {
+			return newRequestRejectedError("%s limit must not exceed %d", req.Method, cfg.MaxBlocksRange), rejectReasonMethodGuard
+		}
+	}
+
+	return nil, ""
+}
+
+// paramsDepth returns nesting level of arrays and objects
+func paramsDepth(v interface{}) int {
+	var maxChildDepth int
+	switch typed := v.(type) {
+	case []interface{}:
+		for _, child := range typed {
+			if d := paramsDepth(child); d > maxChildDepth {
+				maxChildDepth = d
+			}
+		}
+	case map[string]interface{}:
+		for _, child := range typed {
+			if d := paramsDepth(child); d > maxChildDepth {
+				maxChildDepth = d
+			}
+		}
+	default:
+		return 0
+	}
+
+	return maxChildDepth + 1
+}
+
+// getParamsConfigField returns field of config object, which is passed as params[index]
+func getParamsConfigField(params []interface{}, index int, field string) interface{} {
+	if len(params) <= index {
+		return nil
+	}
+	config, ok := params[index].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	return config[field]
+}
+
+func getUintValue(v interface{}) (uint64, bool) {
+	number, ok := v.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	value, err := number.Int64()
+	if err != nil || value < 0 {
+		return 0, false
+	}
+
+	return uint64(value), true
+}
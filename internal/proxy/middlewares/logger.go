@@ -5,20 +5,23 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/gagliardetto/solana-go"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"golang.org/x/crypto/blake2b"
 
 	"extrnode-be/internal/pkg/log"
-	"extrnode-be/internal/pkg/storage/clickhouse"
+	"extrnode-be/internal/pkg/stats_types"
 	echo2 "extrnode-be/internal/pkg/util/echo"
 	solana2 "extrnode-be/internal/pkg/util/solana"
 )
 
-func NewLoggerMiddleware(saveLog func(s clickhouse.Stat)) echo.MiddlewareFunc {
+func NewLoggerMiddleware(saveLog func(s stats_types.Stat)) echo.MiddlewareFunc {
 	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
 		LogStatus:    true,
 		LogMethod:    true,
@@ -32,13 +35,14 @@ func NewLoggerMiddleware(saveLog func(s clickhouse.Stat)) echo.MiddlewareFunc {
 			cc := c.(*echo2.CustomContext)
 			reqBody := cc.GetReqBody()
 
-			saveLog(buildStatStruct(v.RemoteIP, v.RequestID, v.Status, v.Latency.Milliseconds(), cc.GetProxyEndpoint(),
-				cc.GetProxyAttempts(), cc.GetProxyResponseTime(), cc.GetReqMethods(), cc.GetRpcErrors(), v.UserAgent, reqBody))
+			saveLog(buildStatStruct(statUserUUID(cc, v.RemoteIP), v.RequestID, v.Status, v.Latency.Milliseconds(), cc.GetProxyEndpoint(),
+				cc.GetProxyAttempts(), cc.GetProxyResponseTime(), cc.GetReqMethods(), cc.GetRpcErrors(), v.UserAgent, reqBody, cc.GetCredits()))
 
 			// truncate before log
 			if len(reqBody) > bodyLimit {
 				reqBody = reqBody[:bodyLimit]
 			}
+			reqBody = removeSpaces(reqBody)
 
 			if v.Error != nil || len(cc.GetRpcErrors()) != 0 || v.Status >= http.StatusBadRequest {
 				log.Logger.Proxy.Errorf("%d %s, id: %s, latency: %d, endpoint: %s, rpc_method: %v, attempts: %d, node_response_time: %dms, "+
@@ -57,8 +61,21 @@ func NewLoggerMiddleware(saveLog func(s clickhouse.Stat)) echo.MiddlewareFunc {
 	})
 }
 
-func buildStatStruct(ip, requestId string, statusCode int, latency int64, endpoint string, attempts int, responseTime int64,
-	rpcMethods []string, rpcErrorCodes []int, userAgent, reqBody string) clickhouse.Stat {
+// statUserUUID returns api token of the request if it's valid, so usage is available to token owner. Otherwise hash of ip is used
+func statUserUUID(cc *echo2.CustomContext, ip string) string {
+	if cc.GetApiTokenPolicy() != nil {
+		apiToken, err := uuid.Parse(cc.Param(ApiTokenParam))
+		if err == nil {
+			return apiToken.String()
+		}
+	}
+	userUUidHash := blake2b.Sum256([]byte(ip))
+
+	return hex.EncodeToString(userUUidHash[:])
+}
+
+func buildStatStruct(userUUID, requestId string, statusCode int, latency int64, endpoint string, attempts int, responseTime int64,
+	rpcMethods []string, rpcErrorCodes []int, userAgent, reqBody string, credits uint64) stats_types.Stat {
 	var rpcMethod string
 	if len(rpcMethods) > 1 {
 		rpcMethod = solana2.MultipleValuesRequested
@@ -72,10 +89,8 @@ func buildStatStruct(ip, requestId string, statusCode int, latency int64, endpoi
 		rpcErrorCodeString = fmt.Sprintf("%d", rpcErrorCodes[0])
 	}
 
-	userUUidHash := blake2b.Sum256([]byte(ip))
-
-	return clickhouse.Stat{
-		UserUUID:       hex.EncodeToString(userUUidHash[:]),
+	return stats_types.Stat{
+		UserUUID:       userUUID,
 		RequestID:      requestId,
 		Status:         uint16(statusCode),
 		ExecutionTime:  latency,
@@ -87,6 +102,7 @@ func buildStatStruct(ip, requestId string, statusCode int, latency int64, endpoi
 		RpcMethod:      rpcMethod,
 		RpcRequestData: getContextValueForRequest(rpcMethod, reqBody),
 		Timestamp:      time.Now().UTC(),
+		Credits:        credits,
 	}
 }
 
@@ -152,3 +168,12 @@ func getContextValueForRequest(rpcMethod, reqBody string) (res string) {
 
 	return
 }
+
+func removeSpaces(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
@@ -22,6 +22,8 @@ func NewMetricsMiddleware() echo.MiddlewareFunc {
 			metrics.ObserveNodeAttempts(rpcMethod, success, cc.GetProxyAttempts())
 			metrics.ObserveNodeResponseTime(rpcMethod, success, cc.GetProxyResponseTime())
 			metrics.ObserveExecutionTime(rpcMethod, success, time.Since(cc.GetReqDuration()))
+			metrics.ObserveRequestSize(rpcMethod, success, cc.GetReqBodyLen())
+			metrics.ObserveResponseSize(rpcMethod, success, c.Response().Size)
 
 			return err
 		}
@@ -0,0 +1,266 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/patrickmn/go-cache"
+
+	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/pkg/metrics"
+	"extrnode-be/internal/pkg/storage/postgres"
+	echo2 "extrnode-be/internal/pkg/util/echo"
+	solana2 "extrnode-be/internal/pkg/util/solana"
+)
+
+const (
+	ApiTokenParam = "token"
+
+	rejectReasonApiToken = "api_token"
+	rejectReasonPolicy   = "policy"
+
+	// last used time of api keys is saved by batches
+	lastUsedFlushInterval = time.Minute
+	lastUsedFlushTimeout  = 5 * time.Second
+)
+
+// methods which accept dataSlice in config object (params[1])
+var dataSliceMethods = map[string]struct{}{
+	solana2.GetAccountInfo:      {},
+	solana2.GetMultipleAccounts: {},
+	solana2.GetProgramAccounts:  {},
+}
+
+// PolicyProvider caches api token policies loaded from postgres. Policies of revoked api keys are removed from cache
+// on notification from postgres. Last used time of api keys is collected and saved periodically
+type PolicyProvider struct {
+	storage postgres.Storage
+	cache   *cache.Cache
+
+	mx       sync.Mutex
+	lastUsed map[uuid.UUID]time.Time
+	// closed after final save of last used time
+	done chan struct{}
+}
+
+func NewPolicyProvider(ctx context.Context, storage postgres.Storage, ttl time.Duration) *PolicyProvider {
+	pp := &PolicyProvider{
+		storage:  storage,
+		cache:    cache.New(ttl, 2*ttl),
+		lastUsed: make(map[uuid.UUID]time.Time),
+		done:     make(chan struct{}),
+	}
+
+	err := storage.ListenRevokedApiKeys(ctx, func(apiToken uuid.UUID) {
+		pp.cache.Delete(apiToken.String())
+	})
+	if err != nil {
+		// revoked keys are still rejected after cache ttl
+		log.Logger.Proxy.Errorf("ListenRevokedApiKeys: %s", err)
+	}
+
+	go pp.start(ctx)
+
+	return pp
+}
+
+// Done is closed when provider is stopped by context and last used time is saved
+func (pp *PolicyProvider) Done() <-chan struct{} {
+	return pp.done
+}
+
+func (pp *PolicyProvider) start(ctx context.Context) {
+	defer close(pp.done)
+
+	for {
+		select {
+		case <-ctx.Done():
+			pp.flushLastUsed()
+			return
+
+		case <-time.After(lastUsedFlushInterval):
+			pp.flushLastUsed()
+		}
+	}
+}
+
+// MarkUsed remembers that api token is used now
+func (pp *PolicyProvider) MarkUsed(apiToken uuid.UUID) {
+	pp.mx.Lock()
+	pp.lastUsed[apiToken] = time.Now()
+	pp.mx.Unlock()
+}
+
+func (pp *PolicyProvider) flushLastUsed() {
+	pp.mx.Lock()
+	lastUsed := pp.lastUsed
+	pp.lastUsed = make(map[uuid.UUID]time.Time, len(lastUsed))
+	pp.mx.Unlock()
+
+	// service context may be already canceled, so the own one is used
+	ctx, cancel := context.WithTimeout(context.Background(), lastUsedFlushTimeout)
+	defer cancel()
+	err := pp.storage.UpdateApiKeysLastUsed(ctx, lastUsed)
+	if err != nil {
+		// last used time is informational, so it's not retried
+		log.Logger.Proxy.Errorf("UpdateApiKeysLastUsed: %s", err)
+	}
+}
+
+// Get returns nil policy if token doesn't exist, is revoked or expired. Unknown tokens are cached too
+func (pp *PolicyProvider) Get(apiToken uuid.UUID) (*postgres.Policy, error) {
+	cacheKey := apiToken.String()
+	cacheValue, ok := pp.cache.Get(cacheKey)
+	if ok {
+		policy := cacheValue.(*postgres.Policy)
+		if policy != nil && policy.ExpiresAt != nil && !policy.ExpiresAt.After(time.Now()) {
+			return nil, nil
+		}
+		return policy, nil
+	}
+
+	policy, isFound, err := pp.storage.GetPolicyByApiToken(apiToken)
+	if err != nil {
+		return nil, fmt.Errorf("GetPolicyByApiToken: %s", err)
+	}
+
+	var res *postgres.Policy
+	if isFound {
+		res = &policy
+	}
+	pp.cache.SetDefault(cacheKey, res)
+
+	return res, nil
+}
+
+// NewPolicyMiddleware loads policy of the api token passed in url path. Requests without token are not restricted
+func NewPolicyMiddleware(provider *PolicyProvider) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			cc := c.(*echo2.CustomContext)
+			tokenParam := c.Param(ApiTokenParam)
+			if tokenParam == "" {
+				return next(c)
+			}
+
+			apiToken, err := uuid.Parse(tokenParam)
+			if err != nil {
+				return rejectInvalidApiToken(cc)
+			}
+			policy, err := provider.Get(apiToken)
+			if err != nil {
+				log.Logger.Proxy.Errorf("PolicyProvider.Get: %s", err)
+				return echo.NewHTTPError(http.StatusInternalServerError, internalErrorResponse)
+			}
+			if policy == nil {
+				return rejectInvalidApiToken(cc)
+			}
+			cc.SetApiTokenPolicy(policy)
+			provider.MarkUsed(apiToken)
+
+			return next(c)
+		}
+	}
+}
+
+func rejectInvalidApiToken(cc *echo2.CustomContext) error {
+	metrics.IncRejectedRequestsCnt("", rejectReasonApiToken)
+	cc.SetRpcErrors([]int{invalidApiTokenErrorResponse.Error.Code})
+	cc.SetProxyUserError(true)
+
+	return echo.NewHTTPError(http.StatusUnauthorized, invalidApiTokenErrorResponse)
+}
+
+// checkRequestPolicy returns error if request is not allowed by api token policy
+func checkRequestPolicy(policy *postgres.Policy, req RPCRequest) *jsonrpc.RPCError {
+	if policy == nil {
+		return nil
+	}
+
+	if contains(policy.DeniedMethods, req.Method) ||
+		(len(policy.AllowedMethods) != 0 && !contains(policy.AllowedMethods, req.Method)) {
+		return newRequestRejectedError("method %s is not allowed for this api token", req.Method)
+	}
+
+	params, _ := req.Params.([]interface{})
+	if req.Method == solana2.GetProgramAccounts && len(policy.AllowedProgramIDs) != 0 {
+		var programID string
+		if len(params) != 0 {
+			programID, _ = params[0].(string)
+		}
+		if !contains(policy.AllowedProgramIDs, programID) {
+			return newRequestRejectedError("program %s is not allowed for this api token", programID)
+		}
+	}
+
+	if len(policy.DeniedEncodings) != 0 {
+		// config object position depends on the method, so all of them are checked
+		for _, p := range params {
+			config, ok := p.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			encoding, _ := config["encoding"].(string)
+			if encoding != "" && contains(policy.DeniedEncodings, encoding) {
+				return newRequestRejectedError("encoding %s is not allowed for this api token", encoding)
+			}
+		}
+	}
+
+	if _, ok := dataSliceMethods[req.Method]; ok && policy.MaxDataSliceLength > 0 {
+		dataSlice, _ := getParamsConfigField(params, 1, "dataSlice").(map[string]interface{})
+		length, ok := getUintValue(dataSlice["length"])
+		if !ok {
+			return newRequestRejectedError("%s requires dataSlice for this api token", req.Method)
+		}
+		if length > policy.MaxDataSliceLength {
+			return newRequestRejectedError("dataSlice length must not exceed %d for this api token", policy.MaxDataSliceLength)
+		}
+	}
+
+	return nil
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowedOrigins returns origins allowed for api token passed in url path. Used by CORS middleware.
+// Keys of organization without allowed origins are rejected for browsers
+func (pp *PolicyProvider) AllowedOrigins(c echo.Context) ([]string, error) {
+	tokenParam := c.Param(ApiTokenParam)
+	if tokenParam == "" {
+		return nil, nil
+	}
+	apiToken, err := uuid.Parse(tokenParam)
+	if err != nil {
+		// request is rejected later by policy middleware
+		return nil, nil
+	}
+
+	policy, err := pp.Get(apiToken)
+	if err != nil {
+		log.Logger.Proxy.Errorf("PolicyProvider.Get: %s", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, internalErrorResponse)
+	}
+	if policy == nil {
+		return nil, nil
+	}
+	if policy.IsOrgKey && len(policy.AllowedOrigins) == 0 {
+		return nil, echo.NewHTTPError(http.StatusForbidden, originNotAllowedErrorResponse)
+	}
+
+	return policy.AllowedOrigins, nil
+}
@@ -0,0 +1,169 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/pkg/metrics"
+)
+
+type PoolConfig struct {
+	MaxIdleConns    int
+	MaxConns        int
+	IdleConnTimeout time.Duration
+}
+
+// targetPool holds connections to a single target
+type targetPool struct {
+	name      string
+	transport *http.Transport
+	closed    int32
+}
+
+type countedConn struct {
+	net.Conn
+	pool      *targetPool
+	closeOnce sync.Once
+}
+
+const (
+	targetWarmUpTimeout = 5 * time.Second
+	warmUpRequestBody   = `{"jsonrpc":"2.0","id":1,"method":"getHealth"}`
+)
+
+func newTargetPool(name string, cfg PoolConfig) *targetPool {
+	tp := &targetPool{name: name}
+	dialer := &net.Dialer{
+		Timeout:   transportDialerTimeout,
+		KeepAlive: transportDialerTimeout,
+	}
+
+	tp.transport = &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			tp.addOpenConns(1)
+
+			return &countedConn{Conn: conn, pool: tp}, nil
+		},
+		// h2 is negotiated through ALPN, so multiplexing is used only by targets which support it
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConns,
+		MaxConnsPerHost:       cfg.MaxConns,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		TLSHandshakeTimeout:   3 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	return tp
+}
+
+func (c *countedConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.pool.addOpenConns(-1)
+	})
+
+	return c.Conn.Close()
+}
+
+func (tp *targetPool) addOpenConns(delta int) {
+	// series is deleted on close, don't create it again
+	if atomic.LoadInt32(&tp.closed) == 1 {
+		return
+	}
+
+	metrics.AddTargetOpenConns(tp.name, delta)
+}
+
+func (tp *targetPool) addActiveReqs(delta int) {
+	if atomic.LoadInt32(&tp.closed) == 1 {
+		return
+	}
+
+	metrics.AddTargetActiveReqs(tp.name, delta)
+}
+
+func (tp *targetPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	var connectStart, tlsStart time.Time
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			metrics.IncTargetConnsTotalCnt(tp.name, info.Reused)
+		},
+		ConnectStart: func(_, _ string) {
+			connectStart = time.Now()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil && !connectStart.IsZero() {
+				metrics.ObserveTargetDialTime(tp.name, time.Since(connectStart))
+			}
+		},
+		TLSHandshakeStart: func() {
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil && !tlsStart.IsZero() {
+				metrics.ObserveTargetTLSHandshake(tp.name, time.Since(tlsStart))
+			}
+		},
+	}
+
+	tp.addActiveReqs(1)
+	resp, err := tp.transport.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err != nil {
+		tp.addActiveReqs(-1)
+		return nil, err
+	}
+
+	// request is active until its body is closed, streamed responses are relayed long after headers
+	body := resp.Body
+	var once sync.Once
+	resp.Body = readCloser{Reader: body, closeFunc: func() error {
+		once.Do(func() { tp.addActiveReqs(-1) })
+		return body.Close()
+	}}
+
+	return resp, nil
+}
+
+// warmUp opens connection to the target, so first user request does not wait for dial and tls handshake
+func (tp *targetPool) warmUp() {
+	ctx, cancel := context.WithTimeout(context.Background(), targetWarmUpTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tp.name, bytes.NewBufferString(warmUpRequestBody))
+	if err != nil {
+		log.Logger.Proxy.Errorf("warmUp: NewRequest (%s): %s", tp.name, err)
+		return
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+	resp, err := tp.RoundTrip(req)
+	if err != nil {
+		log.Logger.Proxy.Debugf("warmUp: RoundTrip (%s): %s", tp.name, err)
+		return
+	}
+	// body must be read to the end, otherwise connection will not return to the pool
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+func (tp *targetPool) Close() {
+	tp.transport.CloseIdleConnections()
+	atomic.StoreInt32(&tp.closed, 1)
+	metrics.DeleteTargetMetrics(tp.name)
+}
@@ -10,13 +10,14 @@ import (
 
 	"github.com/labstack/echo/v4"
 
+	"extrnode-be/internal/pkg/billing"
 	echo2 "extrnode-be/internal/pkg/util/echo"
 )
 
-func NewProxyMiddleware(transport *ProxyTransport) echo.MiddlewareFunc {
+func NewProxyMiddleware(transport *ProxyTransport, meter func() billing.Meter) echo.MiddlewareFunc {
 	// set some basic url so validation does not fail, later we get proxy url from transport in roundtripper
 	baseUrl, _ := url.Parse("https://localhost:8080")
-	responseModifier := responseModifier{}
+	responseModifier := responseModifier{meter: meter}
 
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) (err error) {
@@ -55,9 +56,13 @@ const (
 	headerNodeReqAttempts  = "X-NODE-REQ-ATTEMPTS"
 	headerNodeResponseTime = "X-NODE-RESPONSE-TIME"
 	headerNodeEndpoint     = "X-NODE-ENDPOINT"
+	headerCreditsUsed      = "X-CREDITS-USED"
 )
 
-type responseModifier struct{}
+type responseModifier struct {
+	// meter is reloaded from storage, so it's taken on each response
+	meter func() billing.Meter
+}
 
 func (rm *responseModifier) WithContext(c echo.Context) func(*http.Response) error {
 	return func(res *http.Response) error {
@@ -66,6 +71,17 @@ func (rm *responseModifier) WithContext(c echo.Context) func(*http.Response) err
 		res.Header.Set(headerNodeEndpoint, cc.GetProxyEndpoint())
 		res.Header.Set(headerNodeReqAttempts, fmt.Sprintf("%d", cc.GetProxyAttempts()))
 		res.Header.Set(headerNodeResponseTime, fmt.Sprintf("%dms", cc.GetProxyResponseTime()))
+		// only requests answered by node are charged, the same credits are saved to stats.
+		// Invalid requests are answered by node too, failed responses of upstream are not charged
+		if !cc.GetProxyHasError() || cc.GetProxyUserError() {
+			cc.SetCredits(rm.meter().Credits(cc.GetReqMethods()))
+		}
+		res.Header.Set(headerCreditsUsed, fmt.Sprintf("%d", cc.GetCredits()))
+
+		err := recompressResponse(res, c.Request().Header.Get(echo.HeaderAcceptEncoding))
+		if err != nil {
+			return fmt.Errorf("recompressResponse: %s", err)
+		}
 
 		return nil
 	}
@@ -0,0 +1,138 @@
+package middlewares
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+
+	"extrnode-be/internal/pkg/log"
+)
+
+// part of the body read for inspection when Content-Length already exceeds the buffer limit
+const streamedPrefixSize = 64 * 1024
+
+// bufferResponseBody reads the body up to limit. If the body is larger, only read part is returned
+// and the body is left to be streamed to the client, starting with the read part
+func bufferResponseBody(res *http.Response, limit int64) (buffered []byte, isFull bool, err error) {
+	if limit <= 0 {
+		buffered, err = io.ReadAll(res.Body)
+		if err != nil {
+			return nil, false, err
+		}
+		res.Body.Close()
+
+		return buffered, true, nil
+	}
+
+	readLimit := limit + 1
+	if res.ContentLength > limit && streamedPrefixSize < limit {
+		// body won't be buffered anyway, read only the part needed for inspection
+		readLimit = streamedPrefixSize
+	}
+
+	buffered, err = io.ReadAll(io.LimitReader(res.Body, readLimit))
+	if err != nil {
+		return nil, false, err
+	}
+	if res.ContentLength <= limit && int64(len(buffered)) <= limit {
+		res.Body.Close()
+		return buffered, true, nil
+	}
+
+	upstreamBody := res.Body
+	res.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(buffered), upstreamBody), closeFunc: upstreamBody.Close}
+
+	return buffered, false, nil
+}
+
+// inspectResponsePrefix saves to context the beginning of the streamed body and rpc errors found in it
+func (ptc *proxyTransportWithContext) inspectResponsePrefix(prefix []byte, encoding string) {
+	decodedPrefix, err := newDecodingReader(bytes.NewReader(prefix), encoding)
+	if err != nil {
+		log.Logger.Proxy.Errorf("inspectResponsePrefix: newDecodingReader: %s", err)
+		return
+	}
+
+	br := bufio.NewReaderSize(decodedPrefix, bodyLimit)
+	// error is ignored, body may be shorter than bodyLimit
+	peeked, _ := br.Peek(bodyLimit)
+	ptc.c.SetResBody(string(bytes.TrimSpace(peeked)))
+
+	errCodes := scanResponseErrors(br)
+	if len(errCodes) != 0 {
+		ptc.c.SetRpcErrors(errCodes)
+	}
+}
+
+// scanResponseErrors parses only top-level fields of rpc responses. Parsing stops at the first non-error result
+// or at the end of the truncated body
+func scanResponseErrors(r io.Reader) (errCodes []int) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	tok, err := decoder.Token()
+	if err != nil {
+		return nil
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		if code := scanResponseObject(decoder); code != 0 {
+			errCodes = append(errCodes, code)
+		}
+	case json.Delim('['):
+		for decoder.More() {
+			var rpcResponse RPCResponse
+			err = decoder.Decode(&rpcResponse)
+			if err != nil {
+				// the rest of the body is not read
+				return errCodes
+			}
+			if rpcResponse.Error != nil && rpcResponse.Error.Code != 0 {
+				errCodes = append(errCodes, rpcResponse.Error.Code)
+			}
+		}
+	}
+
+	return errCodes
+}
+
+// scanResponseObject returns error code of single rpc response, decoder must be positioned after opening brace
+func scanResponseObject(decoder *json.Decoder) int {
+	for decoder.More() {
+		tok, err := decoder.Token()
+		if err != nil {
+			return 0
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return 0
+		}
+
+		switch key {
+		case "error":
+			var rpcErr jsonrpc.RPCError
+			err = decoder.Decode(&rpcErr)
+			if err != nil {
+				return 0
+			}
+
+			return rpcErr.Code
+		case "result":
+			// result is not parsed, huge response can't be an error
+			return 0
+		default:
+			var skipped json.RawMessage
+			err = decoder.Decode(&skipped)
+			if err != nil {
+				return 0
+			}
+		}
+	}
+
+	return 0
+}
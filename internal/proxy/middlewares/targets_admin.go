@@ -0,0 +1,280 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"extrnode-be/internal/pkg/config_types"
+	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/pkg/util/solana"
+)
+
+const (
+	targetStateActive int32 = iota
+	// drained target gets no new requests, in-flight requests are finished. State is lost if target is removed from db
+	targetStateDrained
+	// banned target gets no requests until unbanned, state is kept even if target is removed from db and added again
+	targetStateBanned
+)
+
+var targetStateNames = map[int32]string{
+	targetStateActive:  "active",
+	targetStateDrained: "drained",
+	targetStateBanned:  "banned",
+}
+
+var ErrTargetNotFound = errors.New("target not found")
+
+// TargetInfo is a snapshot of target in-memory state
+type TargetInfo struct {
+	Url              string   `json:"url"`
+	State            string   `json:"state"`
+	IsAvailable      bool     `json:"is_available"`
+	IsPinned         bool     `json:"is_pinned"`
+	PinExpireTime    int64    `json:"pin_expire_time,omitempty"`
+	JailExpireTime   int64    `json:"jail_expire_time"`
+	ErrCounter       uint64   `json:"err_counter"`
+	SuccessCounter   uint64   `json:"success_counter"`
+	ReqCounter       uint64   `json:"req_counter"`
+	ReqLimitHourly   uint64   `json:"req_limit_hourly"`
+	SupportedMethods []string `json:"supported_methods"`
+}
+
+func (t *proxyTarget) getState() int32 {
+	return atomic.LoadInt32(&t.state)
+}
+
+func (t *proxyTarget) setState(state int32) {
+	atomic.StoreInt32(&t.state, state)
+}
+
+func (t *proxyTarget) isPinned() bool {
+	return atomic.LoadInt32(&t.pinned) == 1
+}
+
+func (t *proxyTarget) pin(expireTime int64) {
+	atomic.StoreInt64(&t.pinExpireTime, expireTime)
+	atomic.StoreInt32(&t.pinned, 1)
+}
+
+func (t *proxyTarget) isPinExpired() bool {
+	expireTime := atomic.LoadInt64(&t.pinExpireTime)
+	return t.isPinned() && expireTime != 0 && expireTime <= time.Now().Unix()
+}
+
+func (t *proxyTarget) info(withJail bool) TargetInfo {
+	t.Lock()
+	defer t.Unlock()
+
+	supportedMethods := make([]string, 0, len(t.supportedMethods))
+	for m := range t.supportedMethods {
+		supportedMethods = append(supportedMethods, m)
+	}
+	sort.Strings(supportedMethods)
+
+	return TargetInfo{
+		Url:              t.url.String(),
+		State:            targetStateNames[t.getState()],
+		IsAvailable:      t.isAvailable(withJail),
+		IsPinned:         t.isPinned(),
+		PinExpireTime:    atomic.LoadInt64(&t.pinExpireTime),
+		JailExpireTime:   t.jailExpireTime,
+		ErrCounter:       t.errCounter,
+		SuccessCounter:   t.successCounter,
+		ReqCounter:       t.reqCounter,
+		ReqLimitHourly:   t.reqLimitHourly,
+		SupportedMethods: supportedMethods,
+	}
+}
+
+func targetKey(u *url.URL) string {
+	return strings.ToLower(u.String())
+}
+
+func (pt *ProxyTransport) getTargets() []*proxyTarget {
+	pt.endpointTargetsMutex.Lock()
+	defer pt.endpointTargetsMutex.Unlock()
+
+	return append([]*proxyTarget(nil), pt.targets...)
+}
+
+func (pt *ProxyTransport) getFailoverTargets() []*proxyTarget {
+	pt.failoverTargetsMutex.Lock()
+	defer pt.failoverTargetsMutex.Unlock()
+
+	return append([]*proxyTarget(nil), pt.failoverTargets...)
+}
+
+// Targets returns state of endpoint and failover targets
+func (pt *ProxyTransport) Targets() (targets, failoverTargets []TargetInfo) {
+	targets = make([]TargetInfo, 0, len(pt.targets))
+	for _, t := range pt.getTargets() {
+		targets = append(targets, t.info(pt.withJail))
+	}
+	failoverTargets = make([]TargetInfo, 0, len(pt.failoverTargets))
+	for _, t := range pt.getFailoverTargets() {
+		failoverTargets = append(failoverTargets, t.info(pt.withJail))
+	}
+
+	return targets, failoverTargets
+}
+
+// AvailableTargetsCount returns number of endpoint and failover targets which are able to serve requests
+func (pt *ProxyTransport) AvailableTargetsCount() (targets, failoverTargets int) {
+	for _, t := range pt.getTargets() {
+		if t.isAvailable(pt.withJail) {
+			targets++
+		}
+	}
+	for _, t := range pt.getFailoverTargets() {
+		if t.isAvailable(pt.withJail) {
+			failoverTargets++
+		}
+	}
+
+	return targets, failoverTargets
+}
+
+func (pt *ProxyTransport) findTarget(u *url.URL) *proxyTarget {
+	key := targetKey(u)
+	for _, t := range append(pt.getTargets(), pt.getFailoverTargets()...) {
+		if targetKey(t.url) == key {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// DrainTarget stops sending new requests to the target until it is unbanned
+func (pt *ProxyTransport) DrainTarget(u *url.URL) error {
+	return pt.setTargetState(u, targetStateDrained)
+}
+
+// BanTarget stops sending requests to the target until it is unbanned
+func (pt *ProxyTransport) BanTarget(u *url.URL) error {
+	return pt.setTargetState(u, targetStateBanned)
+}
+
+// UnbanTarget returns drained or banned target to the rotation
+func (pt *ProxyTransport) UnbanTarget(u *url.URL) error {
+	return pt.setTargetState(u, targetStateActive)
+}
+
+func (pt *ProxyTransport) setTargetState(u *url.URL, state int32) error {
+	t := pt.findTarget(u)
+	if t == nil {
+		return ErrTargetNotFound
+	}
+
+	pt.endpointTargetsMutex.Lock()
+	if state == targetStateBanned {
+		pt.bannedTargets[targetKey(u)] = struct{}{}
+	} else {
+		delete(pt.bannedTargets, targetKey(u))
+	}
+	pt.endpointTargetsMutex.Unlock()
+
+	t.setState(state)
+	if state != targetStateActive {
+		// in-flight requests keep their connections
+		t.pool.transport.CloseIdleConnections()
+	}
+	log.Logger.Proxy.Infof("Transport changed target state to %s: %s", targetStateNames[state], u.String())
+
+	return nil
+}
+
+// AddPinnedTarget adds target which is not removed on reload from db. Zero ttl means no expiration.
+// Target without supported methods receives requests for all methods
+func (pt *ProxyTransport) AddPinnedTarget(urlWithMethods UrlWithMethods, ttl time.Duration) {
+	if len(urlWithMethods.SupportedMethods) == 0 {
+		urlWithMethods.SupportedMethods = make(map[string]struct{}, len(solana.FullMethodList))
+		for m := range solana.FullMethodList {
+			urlWithMethods.SupportedMethods[m] = struct{}{}
+		}
+	}
+	var expireTime int64
+	if ttl > 0 {
+		expireTime = time.Now().Add(ttl).Unix()
+	}
+
+	// existing target is replaced to apply new supported methods
+	pt.RemoveTarget(urlWithMethods.Url)
+	t := newProxyTarget(urlWithMethods, 0, pt.poolConfig)
+	t.pin(expireTime)
+	pt.endpointTargetsMutex.Lock()
+	if _, ok := pt.bannedTargets[targetKey(t.url)]; ok {
+		t.setState(targetStateBanned)
+	}
+	pt.targets = append(pt.targets, t)
+	pt.endpointTargetsMutex.Unlock()
+	go t.pool.warmUp()
+
+	log.Logger.Proxy.Infof("Transport added pinned target: %s", urlWithMethods.Url.String())
+}
+
+// RemovePinnedTarget removes pinned target. If it's still in db, it will be added on the next reload
+func (pt *ProxyTransport) RemovePinnedTarget(u *url.URL) error {
+	key := targetKey(u)
+	for _, t := range pt.getTargets() {
+		if targetKey(t.url) == key && t.isPinned() {
+			pt.RemoveTarget(t.url)
+			return nil
+		}
+	}
+
+	return ErrTargetNotFound
+}
+
+// SetFailoverTargets replaces failover targets. Targets with the same url keep their connections and stats
+func (pt *ProxyTransport) SetFailoverTargets(failoverTargets config_types.FailoverTargets) error {
+	newTargets := make([]*proxyTarget, 0, len(failoverTargets))
+	for _, ft := range failoverTargets {
+		parsedUrl, err := url.Parse(ft.Url)
+		if err != nil {
+			return fmt.Errorf("url.Parse: %s", err)
+		}
+		newTargets = append(newTargets, newProxyTarget(UrlWithMethods{Url: parsedUrl}, ft.ReqLimitHourly, pt.poolConfig))
+	}
+
+	pt.failoverTargetsMutex.Lock()
+	oldTargets := make(map[string]*proxyTarget, len(pt.failoverTargets))
+	for _, t := range pt.failoverTargets {
+		oldTargets[targetKey(t.url)] = t
+	}
+	for i, t := range newTargets {
+		old, ok := oldTargets[targetKey(t.url)]
+		if !ok {
+			go t.pool.warmUp()
+			continue
+		}
+
+		old.Lock()
+		old.reqLimit, old.reqLimitHourly = t.reqLimit, t.reqLimitHourly
+		old.Unlock()
+		newTargets[i] = old
+		delete(oldTargets, targetKey(t.url))
+	}
+	pt.failoverTargets = newTargets
+	pt.failoverTargetsMutex.Unlock()
+
+	for _, t := range oldTargets {
+		t.pool.Close()
+	}
+
+	pt.endpointTargetsMutex.Lock()
+	for _, t := range newTargets {
+		if _, ok := pt.bannedTargets[targetKey(t.url)]; ok {
+			t.setState(targetStateBanned)
+		}
+	}
+	pt.endpointTargetsMutex.Unlock()
+
+	return nil
+}
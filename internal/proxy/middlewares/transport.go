@@ -2,13 +2,14 @@ package middlewares
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"extrnode-be/internal/pkg/config_types"
@@ -19,9 +20,12 @@ import (
 )
 
 type ProxyTransport struct {
-	maxAttempts int
-	transport   *http.Transport
+	// changed on config reload, accessed atomically
+	maxAttempts int32
+	poolConfig  PoolConfig
 	withJail    bool
+	// responses larger than the limit are streamed to the client without retries
+	responseBufferLimit int64
 
 	targets []*proxyTarget
 	i       int
@@ -31,6 +35,9 @@ type ProxyTransport struct {
 
 	scannedMethodList map[string]int
 
+	// banned targets stay banned after reload from db, keys are lowercase urls
+	bannedTargets map[string]struct{}
+
 	endpointTargetsMutex   sync.Mutex
 	failoverTargetsMutex   sync.Mutex
 	scannedMethodListMutex sync.Mutex
@@ -54,37 +61,33 @@ const (
 	secondsInHour              = 3600
 )
 
-func NewProxyTransport(withJail bool, failoverTargets config_types.FailoverTargets, scannedMethodList map[string]int) (*ProxyTransport, error) {
+func NewProxyTransport(withJail bool, maxAttempts int, poolConfig PoolConfig, responseBufferLimit int64, failoverTargets config_types.FailoverTargets, scannedMethodList map[string]int) (*ProxyTransport, error) {
 	pt := &ProxyTransport{
-		transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   transportDialerTimeout,
-				KeepAlive: transportDialerTimeout,
-			}).DialContext,
-			ForceAttemptHTTP2:     true,
-			MaxIdleConns:          1,
-			TLSHandshakeTimeout:   3 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-		},
-		maxAttempts:       5,
-		withJail:          withJail,
-		scannedMethodList: scannedMethodList,
+		poolConfig:          poolConfig,
+		maxAttempts:         int32(maxAttempts),
+		withJail:            withJail,
+		responseBufferLimit: responseBufferLimit,
+		scannedMethodList:   scannedMethodList,
+		bannedTargets:       make(map[string]struct{}),
 	}
 
-	for _, ft := range failoverTargets {
-		parsedUrl, err := url.Parse(ft.Url)
-		if err != nil {
-			return nil, fmt.Errorf("url.Parse: %s", err)
-		}
-
-		reqLimit := ft.ReqLimitHourly / (secondsInHour / limitWindowSeconds)
-		pt.failoverTargets = append(pt.failoverTargets, newProxyTarget(UrlWithMethods{Url: parsedUrl}, reqLimit))
+	err := pt.SetFailoverTargets(failoverTargets)
+	if err != nil {
+		return nil, err
 	}
 
 	return pt, nil
 }
 
+func (pt *ProxyTransport) getMaxAttempts() int {
+	return int(atomic.LoadInt32(&pt.maxAttempts))
+}
+
+// SetMaxAttempts changes retry policy, applied to new requests
+func (pt *ProxyTransport) SetMaxAttempts(maxAttempts int) {
+	atomic.StoreInt32(&pt.maxAttempts, int32(maxAttempts))
+}
+
 func (pt *ProxyTransport) WithContext(c echo.Context) *proxyTransportWithContext {
 	return &proxyTransportWithContext{
 		transport: pt,
@@ -100,13 +103,18 @@ func (ptc *proxyTransportWithContext) RoundTrip(req *http.Request) (resp *http.R
 		return nil, fmt.Errorf("ReadAll: %s", err)
 	}
 
+	// ask upstream for compressed response, the encoding for client is negotiated in responseModifier
+	req.Header.Set(echo.HeaderAcceptEncoding, upstreamAcceptEncoding)
+
 	var (
-		i         int
-		target    *proxyTarget
-		startTime time.Time
+		i           int
+		isAnswered  bool
+		target      *proxyTarget
+		startTime   time.Time
+		maxAttempts = ptc.transport.getMaxAttempts()
 	)
 outerLoop:
-	for ; i < ptc.transport.maxAttempts; i++ {
+	for ; i < maxAttempts; i++ {
 		select {
 		case <-req.Context().Done():
 			err = req.Context().Err()
@@ -130,7 +138,7 @@ outerLoop:
 
 		startTime = time.Now()
 		mustContinue, isAvailable := func() (bool, bool) {
-			resp, err = ptc.transport.transport.RoundTrip(req)
+			resp, err = target.pool.RoundTrip(req)
 			if err != nil {
 				log.Logger.Proxy.Errorf("RoundTrip: %s", err)
 				return true, false
@@ -141,6 +149,12 @@ outerLoop:
 			}
 
 			analysisErr := ptc.getResponseError(resp)
+			if errors.Is(analysisErr, ErrReadResponseBody) {
+				// body is closed, the next attempt is made or the proxy error is returned
+				log.Logger.Proxy.Errorf("responseError: %s", analysisErr)
+				resp = nil
+				return true, false
+			}
 			if analysisErr != nil {
 				if analysisErr == ErrInvalidRequest {
 					ptc.c.SetProxyUserError(true)
@@ -156,8 +170,14 @@ outerLoop:
 		}()
 
 		target.UpdateStats(isAvailable)
+		isAnswered = !mustContinue
 
 		if mustContinue {
+			// release connection to the pool before next attempt, last response is returned to the user as is
+			if resp != nil && i+1 < maxAttempts {
+				_, _ = io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
 			continue
 		}
 
@@ -178,7 +198,8 @@ outerLoop:
 		ptc.c.SetProxyResponseTime(time.Since(startTime).Milliseconds())
 	}
 
-	ptc.c.SetProxyHasError(err != nil)
+	// failed response of the last attempt is returned as is, but it's still an error of proxy
+	ptc.c.SetProxyHasError(err != nil || !isAnswered)
 
 	return resp, err
 }
@@ -275,9 +296,15 @@ func (pt *ProxyTransport) AddTarget(urlWithMethods UrlWithMethods) bool {
 			return false
 		}
 	}
+	t := newProxyTarget(urlWithMethods, 0, pt.poolConfig)
 	pt.endpointTargetsMutex.Lock()
-	pt.targets = append(pt.targets, newProxyTarget(urlWithMethods, 0))
+	if _, ok := pt.bannedTargets[targetKey(t.url)]; ok {
+		t.setState(targetStateBanned)
+	}
+	pt.targets = append(pt.targets, t)
 	pt.endpointTargetsMutex.Unlock()
+	go t.pool.warmUp()
+
 	log.Logger.Proxy.Debugf("Transport added target: %s", urlWithMethods.Url.String())
 	return true
 }
@@ -289,6 +316,7 @@ func (pt *ProxyTransport) RemoveTarget(url *url.URL) bool {
 			pt.endpointTargetsMutex.Lock()
 			pt.targets = append(pt.targets[:i], pt.targets[i+1:]...)
 			pt.endpointTargetsMutex.Unlock()
+			t.pool.Close()
 
 			log.Logger.Proxy.Debugf("Transport removed target: %s", url.String())
 			return true
@@ -299,8 +327,16 @@ func (pt *ProxyTransport) RemoveTarget(url *url.URL) bool {
 }
 
 type proxyTarget struct {
-	url      *url.URL
-	reqLimit uint64
+	url            *url.URL
+	reqLimit       uint64
+	reqLimitHourly uint64
+	pool           *targetPool
+
+	// state is changed through admin api
+	state int32
+	// pinned targets are added manually and are not removed on reload from db
+	pinned        int32
+	pinExpireTime int64
 
 	errCounter     uint64
 	successCounter uint64
@@ -313,10 +349,12 @@ type proxyTarget struct {
 	sync.Mutex
 }
 
-func newProxyTarget(urlWithMethods UrlWithMethods, reqLimit uint64) *proxyTarget {
+func newProxyTarget(urlWithMethods UrlWithMethods, reqLimitHourly uint64, poolConfig PoolConfig) *proxyTarget {
 	return &proxyTarget{
 		url:              urlWithMethods.Url,
-		reqLimit:         reqLimit,
+		reqLimit:         reqLimitHourly / (secondsInHour / limitWindowSeconds),
+		reqLimitHourly:   reqLimitHourly,
+		pool:             newTargetPool(urlWithMethods.Url.String(), poolConfig),
 		supportedMethods: urlWithMethods.SupportedMethods,
 	}
 }
@@ -349,6 +387,10 @@ func (t *proxyTarget) UpdateStats(success bool) {
 }
 
 func (t *proxyTarget) isAvailable(withJail bool) bool {
+	if t.getState() != targetStateActive || t.isPinExpired() {
+		return false
+	}
+
 	// check jail time
 	if withJail && t.jailExpireTime > time.Now().Unix() {
 		return false
@@ -366,7 +408,14 @@ func (t *proxyTarget) isAvailable(withJail bool) bool {
 // AddTarget adds an upstream target to the list.
 func (pt *ProxyTransport) UpdateTargets(urlsWithMethods []UrlWithMethods) {
 	// Remove targets
-	for _, t := range pt.targets {
+	for _, t := range pt.getTargets() {
+		if t.isPinned() {
+			if t.isPinExpired() {
+				pt.RemoveTarget(t.url)
+			}
+			continue
+		}
+
 		var found bool
 		for _, u := range urlsWithMethods {
 			if strings.EqualFold(t.url.String(), u.Url.String()) {
@@ -6,6 +6,8 @@ import (
 
 	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
 	"github.com/labstack/echo/v4"
+
+	"extrnode-be/internal/pkg/util/solana"
 )
 
 type (
@@ -44,6 +46,8 @@ func errMsg(err error) string {
 	return rpcResponse.Error.Message
 }
 
+const requestRejectedErrCode = 2004
+
 var (
 	parseErrorResponse = &RPCResponse{
 		Error: &jsonrpc.RPCError{
@@ -66,6 +70,41 @@ var (
 		},
 		JSONRPC: jsonrpcVersion,
 	}
+	requestTooLargeErrorResponse = &RPCResponse{
+		Error: &jsonrpc.RPCError{
+			Code:    2002,
+			Message: "Request body too large",
+		},
+		JSONRPC: jsonrpcVersion,
+	}
+	batchTooLargeErrorResponse = &RPCResponse{
+		Error: &jsonrpc.RPCError{
+			Code:    2003,
+			Message: "Batch too large",
+		},
+		JSONRPC: jsonrpcVersion,
+	}
+	invalidApiTokenErrorResponse = &RPCResponse{
+		Error: &jsonrpc.RPCError{
+			Code:    2005,
+			Message: "Invalid api token",
+		},
+		JSONRPC: jsonrpcVersion,
+	}
+	originNotAllowedErrorResponse = &RPCResponse{
+		Error: &jsonrpc.RPCError{
+			Code:    2006,
+			Message: "Origin not allowed",
+		},
+		JSONRPC: jsonrpcVersion,
+	}
+	internalErrorResponse = &RPCResponse{
+		Error: &jsonrpc.RPCError{
+			Code:    InternalErrorErrCode,
+			Message: "Internal error",
+		},
+		JSONRPC: jsonrpcVersion,
+	}
 	invalidContentTypeErrorResponse = &RPCResponse{
 		Error: &jsonrpc.RPCError{
 			Code:    415,
@@ -92,3 +131,46 @@ func newJsonDecoder(data []byte, disallowUnknownFields bool) (decoder *json.Deco
 
 	return
 }
+
+// sniffRequestMethod extracts rpc method from a possibly truncated request body
+func sniffRequestMethod(body []byte) string {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return ""
+	}
+	if body[0] == '[' {
+		return solana.MultipleValuesRequested
+	}
+
+	decoder := newJsonDecoder(body, false)
+	if t, err := decoder.Token(); err != nil || t != json.Delim('{') {
+		return ""
+	}
+	for decoder.More() {
+		t, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if key, _ := t.(string); key != "method" {
+			var skip json.RawMessage
+			if err = decoder.Decode(&skip); err != nil {
+				return ""
+			}
+			continue
+		}
+
+		t, err = decoder.Token()
+		if err != nil {
+			return ""
+		}
+		method, _ := t.(string)
+		// keep metric labels bounded
+		if _, ok := solana.FullMethodList[method]; !ok {
+			return ""
+		}
+
+		return method
+	}
+
+	return ""
+}
@@ -4,12 +4,12 @@ import (
 	"bytes"
 	"io"
 	"net/http"
-	"strings"
-	"unicode"
 
 	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
 	"github.com/labstack/echo/v4"
 
+	"extrnode-be/internal/pkg/metrics"
+	"extrnode-be/internal/pkg/storage/postgres"
 	echo2 "extrnode-be/internal/pkg/util/echo"
 	"extrnode-be/internal/pkg/util/solana"
 )
@@ -19,7 +19,7 @@ const (
 	jsonrpcVersion = "2.0"
 )
 
-func NewValidatorMiddleware() echo.MiddlewareFunc {
+func NewValidatorMiddleware(cfg ValidatorConfig) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			cc := c.(*echo2.CustomContext)
@@ -31,16 +31,22 @@ func NewValidatorMiddleware() echo.MiddlewareFunc {
 			// Request
 			reqBody := []byte{}
 			if c.Request().Body != nil { // Read
-				reqBody, _ = io.ReadAll(c.Request().Body)
+				var bodyReader io.Reader = c.Request().Body
+				if cfg.MaxBodySize > 0 {
+					bodyReader = io.LimitReader(bodyReader, cfg.MaxBodySize+1)
+				}
+				reqBody, _ = io.ReadAll(bodyReader)
+			}
+			if cfg.MaxBodySize > 0 && int64(len(reqBody)) > cfg.MaxBodySize {
+				metrics.IncRejectedRequestsCnt(sniffRequestMethod(reqBody), rejectReasonBodySize)
+				cc.SetRpcErrors([]int{requestTooLargeErrorResponse.Error.Code})
+				cc.SetProxyUserError(true)
+				return echo.NewHTTPError(http.StatusRequestEntityTooLarge, requestTooLargeErrorResponse)
 			}
 			c.Request().Body = io.NopCloser(bytes.NewBuffer(reqBody)) // Reset
 
-			reqBody = []byte(strings.Map(func(r rune) rune {
-				if unicode.IsSpace(r) {
-					return -1
-				}
-				return r
-			}, string(reqBody)))
+			// json decoder skips whitespaces itself, only leading ones are trimmed to check the first symbol
+			reqBody = bytes.TrimSpace(reqBody)
 			if len(reqBody) == 0 {
 				cc.SetRpcErrors([]int{parseErrorResponse.Error.Code})
 				cc.SetProxyUserError(true)
@@ -61,7 +67,7 @@ func NewValidatorMiddleware() echo.MiddlewareFunc {
 					return echo.NewHTTPError(http.StatusOK, parseErrorResponse)
 				}
 
-				rpcErr := checkJsonRpcBody(parsedJson)
+				rpcErr := checkJsonRpcBody(parsedJson, cfg, cc.GetApiTokenPolicy())
 				if rpcErr != nil {
 					cc.SetRpcErrors([]int{rpcErr.Code})
 					cc.SetProxyUserError(true)
@@ -80,12 +86,18 @@ func NewValidatorMiddleware() echo.MiddlewareFunc {
 					cc.SetProxyUserError(true)
 					return echo.NewHTTPError(http.StatusOK, parseErrorResponse)
 				}
+				if cfg.MaxBatchLength > 0 && len(parsedJson) > cfg.MaxBatchLength {
+					metrics.IncRejectedRequestsCnt(solana.MultipleValuesRequested, rejectReasonBatchLength)
+					cc.SetRpcErrors([]int{batchTooLargeErrorResponse.Error.Code})
+					cc.SetProxyUserError(true)
+					return echo.NewHTTPError(http.StatusOK, batchTooLargeErrorResponse)
+				}
 
 				for _, r := range parsedJson {
 					if r == nil {
 						continue
 					}
-					rpcErr := checkJsonRpcBody(*r)
+					rpcErr := checkJsonRpcBody(*r, cfg, cc.GetApiTokenPolicy())
 					if rpcErr != nil {
 						cc.SetRpcErrors([]int{rpcErr.Code})
 						cc.SetProxyUserError(true)
@@ -109,7 +121,7 @@ func NewValidatorMiddleware() echo.MiddlewareFunc {
 	}
 }
 
-func checkJsonRpcBody(req RPCRequest) *jsonrpc.RPCError {
+func checkJsonRpcBody(req RPCRequest, cfg ValidatorConfig, policy *postgres.Policy) *jsonrpc.RPCError {
 	if req.JSONRPC != jsonrpcVersion {
 		return invalidReqError
 	}
@@ -118,5 +130,17 @@ func checkJsonRpcBody(req RPCRequest) *jsonrpc.RPCError {
 		return methodNotFoundError
 	}
 
+	rpcErr, reason := cfg.checkRequestLimits(req, policy != nil && policy.LiftMethodGuards)
+	if rpcErr != nil {
+		metrics.IncRejectedRequestsCnt(req.Method, reason)
+		return rpcErr
+	}
+
+	rpcErr = checkRequestPolicy(policy, req)
+	if rpcErr != nil {
+		metrics.IncRejectedRequestsCnt(req.Method, rejectReasonPolicy)
+		return rpcErr
+	}
+
 	return nil
 }
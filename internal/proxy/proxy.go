@@ -2,22 +2,27 @@ package proxy
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
-	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/labstack/echo-contrib/prometheus"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 
+	"extrnode-be/internal/pkg/billing"
 	"extrnode-be/internal/pkg/config_types"
+	"extrnode-be/internal/pkg/health"
 	"extrnode-be/internal/pkg/log"
 	"extrnode-be/internal/pkg/metrics"
-	"extrnode-be/internal/pkg/storage/clickhouse"
-	"extrnode-be/internal/pkg/storage/clickhouse/delayed_insertion"
+	"extrnode-be/internal/pkg/stats_types"
+	"extrnode-be/internal/pkg/storage/delayed_insertion"
+	"extrnode-be/internal/pkg/storage/postgres"
 	"extrnode-be/internal/pkg/storage/sqlite"
+	"extrnode-be/internal/pkg/storage/stats_sink"
 	echo2 "extrnode-be/internal/pkg/util/echo"
 	"extrnode-be/internal/proxy/config"
 	"extrnode-be/internal/proxy/middlewares"
@@ -28,7 +33,10 @@ const (
 )
 
 type proxy struct {
-	certData      []byte
+	// current config, replaced on reload
+	cfg config.Config
+	// *tls.Certificate, replaced on reload
+	cert          atomic.Value
 	proxyPort     uint64
 	metricsPort   uint64
 	router        *echo.Echo
@@ -40,13 +48,36 @@ type proxy struct {
 
 	blockchainIDs   map[string]int
 	failoverTargets config_types.FailoverTargets
-
-	statsCollector *delayed_insertion.Collector[clickhouse.Stat]
+	allowOrigins    []string
+	adminToken      string
+	// forces reload of endpoints from db
+	reloadEndpoints chan struct{}
+	poolConfig      middlewares.PoolConfig
+	maxAttempts     int
+
+	transport        *middlewares.ProxyTransport
+	rateLimiterStore *echo2.ReloadableRateLimiterStore
+
+	responseBufferLimit int64
+	validatorConfig     middlewares.ValidatorConfig
+	// nil if postgres is not configured
+	policyProvider *middlewares.PolicyProvider
+	// billing.Meter, reloaded from postgres
+	meter atomic.Value
+
+	statsCollector *delayed_insertion.Collector[stats_types.Stat]
+	aggregator     *delayed_insertion.Aggregator
+
+	health       *health.Health
+	drainDelay   time.Duration
+	drainTimeout time.Duration
+	reusePort    bool
 }
 
 const (
-	serverShutdownTimeout   = 10 * time.Second
+	metricsShutdownTimeout  = 5 * time.Second
 	endpointsReloadInterval = 5 * time.Minute
+	meterReloadInterval     = 5 * time.Minute
 	collectorInterval       = 10 * time.Second
 )
 
@@ -57,9 +88,9 @@ func NewProxy(cfg config.Config) (*proxy, error) {
 	if err != nil {
 		return nil, fmt.Errorf("SL storage init: %s", err)
 	}
-	chStorage, err := clickhouse.New(cfg.CH.DSN)
+	sink, err := stats_sink.New(cfg.Stats, cfg.CH, slStorage)
 	if err != nil {
-		return nil, fmt.Errorf("CH storage init: %s", err)
+		return nil, fmt.Errorf("stats sink init: %s", err)
 	}
 
 	blockchainsMap, err := slStorage.GetBlockchainsMap()
@@ -67,8 +98,8 @@ func NewProxy(cfg config.Config) (*proxy, error) {
 		return nil, fmt.Errorf("GetBlockchainsMap: %s", err)
 	}
 
-	delayed_insertion.NewAggregator(ctx, chStorage)
 	p := &proxy{
+		cfg:           cfg,
 		proxyPort:     cfg.Proxy.Port,
 		metricsPort:   cfg.Proxy.MetricsPort,
 		router:        echo.New(),
@@ -80,15 +111,75 @@ func NewProxy(cfg config.Config) (*proxy, error) {
 		ctxCancel:       cancelFunc,
 		blockchainIDs:   blockchainsMap,
 		failoverTargets: cfg.Proxy.FailoverEndpoints,
+		allowOrigins:    cfg.Proxy.CorsAllowOrigins,
+		adminToken:      cfg.Proxy.AdminToken,
+		reloadEndpoints: make(chan struct{}, 1),
+		maxAttempts:     cfg.Proxy.MaxAttempts,
+		poolConfig: middlewares.PoolConfig{
+			MaxIdleConns:    cfg.Proxy.TargetMaxIdleConns,
+			MaxConns:        cfg.Proxy.TargetMaxConns,
+			IdleConnTimeout: cfg.Proxy.TargetIdleConnTimeout,
+		},
+		responseBufferLimit: cfg.Proxy.ResponseBufferLimit,
+		validatorConfig: middlewares.ValidatorConfig{
+			MaxBodySize:                    cfg.Proxy.MaxRequestBodySize,
+			MaxBatchLength:                 cfg.Proxy.MaxBatchLength,
+			MaxParamsDepth:                 cfg.Proxy.MaxParamsDepth,
+			AllowUnfilteredProgramAccounts: cfg.Proxy.AllowUnfilteredProgramAccounts,
+			MaxSignaturesLimit:             cfg.Proxy.MaxSignaturesLimit,
+			MaxBlocksRange:                 cfg.Proxy.MaxBlocksRange,
+		},
 
-		statsCollector: delayed_insertion.New[clickhouse.Stat](ctx, chStorage, collectorInterval),
+		rateLimiterStore: echo2.NewReloadableRateLimiterStore(cfg.Proxy.RateLimit),
+		statsCollector:   delayed_insertion.New[stats_types.Stat](ctx, sink, collectorInterval, cfg.Stats),
+		aggregator:       delayed_insertion.NewAggregator(ctx, sink),
+
+		health:       health.New(),
+		drainDelay:   cfg.Proxy.DrainDelay,
+		drainTimeout: cfg.Proxy.DrainTimeout,
+		reusePort:    cfg.Proxy.ReusePort,
+	}
+
+	// stop waits for final flush of stats
+	p.waitGroup.Add(1)
+	go func() {
+		defer p.waitGroup.Done()
+		<-p.statsCollector.Done()
+	}()
+
+	// without postgres each request costs default credits
+	p.meter.Store(billing.NewMeter(nil))
+	// nil if postgres is not configured
+	var pgStorage *postgres.Storage
+	if cfg.PG.Host != "" {
+		storage, err := postgres.New(ctx, cfg.PG)
+		if err != nil {
+			return nil, fmt.Errorf("PG storage init: %s", err)
+		}
+		meter, err := billing.LoadMeter(storage)
+		if err != nil {
+			return nil, fmt.Errorf("LoadMeter: %s", err)
+		}
+		p.meter.Store(meter)
+		go p.updateMeter(storage)
+		p.policyProvider = middlewares.NewPolicyProvider(ctx, storage, cfg.Proxy.PolicyCacheTTL)
+		pgStorage = &storage
+
+		// stop waits for final save of api keys last used time
+		p.waitGroup.Add(1)
+		go func() {
+			defer p.waitGroup.Done()
+			<-p.policyProvider.Done()
+		}()
 	}
+	p.initHealthChecks(sink, pgStorage)
 
 	if cfg.Proxy.CertFile != "" {
-		p.certData, err = os.ReadFile(cfg.Proxy.CertFile)
+		cert, err := loadCertificate(cfg.Proxy.CertFile)
 		if err != nil {
-			return nil, fmt.Errorf("fail to read certificate (%s): %s", cfg.Proxy.CertFile, err)
+			return nil, err
 		}
+		p.cert.Store(cert)
 	}
 	p.setupServer()
 
@@ -97,6 +188,31 @@ func NewProxy(cfg config.Config) (*proxy, error) {
 	return p, err
 }
 
+func (p *proxy) getMeter() billing.Meter {
+	return p.meter.Load().(billing.Meter)
+}
+
+// updateMeter reloads credits of methods shared with user api. On error the old ones are kept
+func (p *proxy) updateMeter(storage postgres.Storage) {
+	ticker := time.NewTicker(meterReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		meter, err := billing.LoadMeter(storage)
+		if err != nil {
+			log.Logger.Proxy.Errorf("Cannot get credits from db: %s", err)
+			continue
+		}
+		p.meter.Store(meter)
+	}
+}
+
 func (p *proxy) setupServer() {
 	echo2.SetupServer(p.router)
 	echo2.SetupServer(p.metricsServer)
@@ -128,12 +244,16 @@ func (p *proxy) initMetrics() {
 }
 
 func (p *proxy) initProxyHandlers() error {
-	echo2.InitHandlersStart(p.router)
+	echo2.InitStreamingHandlersStart(p.router, p.rateLimiterStore)
 
 	// forked cors middleware
-	p.router.Use(middlewares.CORSWithConfig(middlewares.CORSConfig{
-		AllowOrigins: []string{"*"},
-	}))
+	corsConfig := middlewares.CORSConfig{
+		AllowOrigins: p.allowOrigins,
+	}
+	if p.policyProvider != nil {
+		corsConfig.AllowOriginsFunc = p.policyProvider.AllowedOrigins
+	}
+	p.router.Use(middlewares.CORSWithConfig(corsConfig))
 
 	// prometheus metrics
 	p.initMetrics()
@@ -143,11 +263,16 @@ func (p *proxy) initProxyHandlers() error {
 		return fmt.Errorf("getScannedMethods: %s", err)
 	}
 
-	transport, err := middlewares.NewProxyTransport(false, p.failoverTargets, scannedMethodList)
+	transport, err := middlewares.NewProxyTransport(false, p.maxAttempts, p.poolConfig, p.responseBufferLimit, p.failoverTargets, scannedMethodList)
 	if err != nil {
 		return fmt.Errorf("NewProxyTransport: %s", err)
 	}
+	p.transport = transport
 	go p.updateProxyEndpoints(transport)
+	p.initAdminHandlers(transport)
+
+	// health and readiness checks for load balancers and orchestrator
+	p.health.Register(p.router)
 
 	// proxy
 	p.router.POST("/", nil,
@@ -155,19 +280,44 @@ func (p *proxy) initProxyHandlers() error {
 		middlewares.RequestIDMiddleware(),
 		middlewares.NewLoggerMiddleware(p.statsCollector.Add),
 		middlewares.NewMetricsMiddleware(),
-		middlewares.NewValidatorMiddleware(),
-		middlewares.NewProxyMiddleware(transport),
+		middlewares.NewValidatorMiddleware(p.validatorConfig),
+		middlewares.NewProxyMiddleware(transport, p.getMeter),
 	)
+	// requests with api token are restricted by its policy
+	if p.policyProvider != nil {
+		p.router.POST(fmt.Sprintf("/:%s", middlewares.ApiTokenParam), nil,
+			middlewares.RequestDurationMiddleware(),
+			middlewares.RequestIDMiddleware(),
+			middlewares.NewLoggerMiddleware(p.statsCollector.Add),
+			middlewares.NewMetricsMiddleware(),
+			middlewares.NewPolicyMiddleware(p.policyProvider),
+			middlewares.NewValidatorMiddleware(p.validatorConfig),
+			middlewares.NewProxyMiddleware(transport, p.getMeter),
+		)
+	}
 
 	return nil
 }
 
 func (p *proxy) Run() (err error) {
-	addr := fmt.Sprintf(":%d", p.proxyPort)
-	if len(p.certData) != 0 {
-		err = p.router.StartTLS(addr, p.certData, p.certData)
+	ln, err := p.listen(p.proxyPort)
+	if err != nil {
+		return fmt.Errorf("listen: %s", err)
+	}
+
+	if p.cert.Load() != nil {
+		// certificate is taken on each handshake, so it can be replaced on reload
+		p.router.TLSServer.TLSConfig = &tls.Config{
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return p.cert.Load().(*tls.Certificate), nil
+			},
+			NextProtos: []string{"h2"},
+		}
+		p.router.TLSListener = tls.NewListener(ln, p.router.TLSServer.TLSConfig)
+		err = p.router.StartServer(p.router.TLSServer)
 	} else {
-		err = p.router.Start(addr)
+		p.router.Listener = ln
+		err = p.router.StartServer(p.router.Server)
 	}
 
 	if err != http.ErrServerClosed {
@@ -181,7 +331,12 @@ func (p *proxy) RunMetrics() (err error) {
 	if p.metricsPort == 0 {
 		return nil
 	}
-	err = p.metricsServer.Start(fmt.Sprintf(":%d", p.metricsPort))
+	ln, err := p.listen(p.metricsPort)
+	if err != nil {
+		return fmt.Errorf("listen: %s", err)
+	}
+	p.metricsServer.Listener = ln
+	err = p.metricsServer.StartServer(p.metricsServer.Server)
 	if err != http.ErrServerClosed {
 		return err
 	}
@@ -189,16 +344,18 @@ func (p *proxy) RunMetrics() (err error) {
 	return nil
 }
 
+// Stop drains proxy server, then stops background jobs. Stats collector does final flush after all requests are finished.
+// Metrics server is stopped last, so drain is observable
 func (p *proxy) Stop() error {
-	ctx, cancel := context.WithTimeout(p.ctx, serverShutdownTimeout)
-	defer cancel()
+	p.drain()
+	p.ctxCancel()
 
-	go p.metricsServer.Shutdown(ctx)
-	err := p.router.Shutdown(ctx)
+	ctx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+	defer cancel()
+	err := p.metricsServer.Shutdown(ctx)
 	if err != nil {
-		log.Logger.Proxy.Errorf("router.Shutdown: %s", err)
+		log.Logger.Proxy.Errorf("metricsServer.Shutdown: %s", err)
 	}
-	p.ctxCancel()
 
 	return nil
 }
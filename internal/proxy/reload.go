@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/proxy/config"
+)
+
+func loadCertificate(certFile string) (*tls.Certificate, error) {
+	certData, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read certificate (%s): %s", certFile, err)
+	}
+	// file contains both certificate and key
+	cert, err := tls.X509KeyPair(certData, certData)
+	if err != nil {
+		return nil, fmt.Errorf("fail to parse certificate (%s): %s", certFile, err)
+	}
+
+	return &cert, nil
+}
+
+// WatchConfig starts reloading config on SIGHUP and on modification of config files or certificate file.
+// loadConfig must return validated config, on error the old config is kept
+func (p *proxy) WatchConfig(configFiles []string, loadConfig func() (config.Config, error)) {
+	// added before start, so Stop can't miss the watcher
+	p.waitGroup.Add(1)
+	go func() {
+		defer p.waitGroup.Done()
+		p.watchConfig(configFiles, loadConfig)
+	}()
+}
+
+func (p *proxy) watchConfig(configFiles []string, loadConfig func() (config.Config, error)) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	// file watch is disabled with zero interval, nil channel blocks forever
+	var watchTick <-chan time.Time
+	if p.cfg.Proxy.ConfigWatchInterval > 0 {
+		ticker := time.NewTicker(p.cfg.Proxy.ConfigWatchInterval)
+		defer ticker.Stop()
+		watchTick = ticker.C
+	}
+	modTimes := filesModTime(append(configFiles, p.cfg.Proxy.CertFile)...)
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-sighup:
+			log.Logger.Proxy.Info("Received SIGHUP, reloading config")
+		case <-watchTick:
+			newModTimes := filesModTime(append(configFiles, p.cfg.Proxy.CertFile)...)
+			if reflect.DeepEqual(modTimes, newModTimes) {
+				continue
+			}
+			log.Logger.Proxy.Info("Config files changed, reloading config")
+		}
+
+		cfg, err := loadConfig()
+		if err != nil {
+			log.Logger.Proxy.Errorf("Config reload: %s, old config is kept", err)
+			continue
+		}
+		err = p.applyConfig(cfg)
+		if err != nil {
+			log.Logger.Proxy.Errorf("Config reload: %s, old config is kept", err)
+			continue
+		}
+		// taken after reload, certificate file may be changed by config
+		modTimes = filesModTime(append(configFiles, p.cfg.Proxy.CertFile)...)
+		log.Logger.Proxy.Info("Config reloaded")
+	}
+}
+
+func filesModTime(files ...string) map[string]time.Time {
+	res := make(map[string]time.Time, len(files))
+	for _, f := range files {
+		if f == "" {
+			continue
+		}
+		info, err := os.Stat(f)
+		if err != nil {
+			// file may be replaced right now, it will be checked again on the next tick
+			continue
+		}
+		res[f] = info.ModTime()
+	}
+
+	return res
+}
+
+// applyConfig applies reloadable settings: failover targets, rate limit, max attempts and tls certificate.
+// Changes of other settings are logged and require restart
+func (p *proxy) applyConfig(cfg config.Config) error {
+	old := p.cfg.Proxy
+	newProxyCfg := cfg.Proxy
+
+	var cert *tls.Certificate
+	if newProxyCfg.CertFile != "" {
+		if old.CertFile == "" {
+			return fmt.Errorf("tls can't be enabled without restart")
+		}
+
+		var err error
+		cert, err = loadCertificate(newProxyCfg.CertFile)
+		if err != nil {
+			return err
+		}
+	} else if old.CertFile != "" {
+		return fmt.Errorf("tls can't be disabled without restart")
+	}
+
+	// failover targets are replaced only if all of them are valid, so it's done before other changes
+	err := p.transport.SetFailoverTargets(newProxyCfg.FailoverEndpoints)
+	if err != nil {
+		return fmt.Errorf("SetFailoverTargets: %s", err)
+	}
+	if cert != nil {
+		p.cert.Store(cert)
+	}
+	p.transport.SetMaxAttempts(newProxyCfg.MaxAttempts)
+	if newProxyCfg.RateLimit != old.RateLimit {
+		p.rateLimiterStore.SetRateLimit(newProxyCfg.RateLimit)
+	}
+
+	merged := keepNonReloadable(p.cfg, cfg)
+	if !reflect.DeepEqual(merged, cfg) {
+		log.Logger.Proxy.Warn("Config reload: changes of non reloadable settings are applied after restart")
+	}
+	p.cfg = merged
+
+	return nil
+}
+
+// keepNonReloadable returns current config with reloadable settings taken from new config
+func keepNonReloadable(current, reloaded config.Config) config.Config {
+	res := current
+	res.Proxy.FailoverEndpoints = reloaded.Proxy.FailoverEndpoints
+	res.Proxy.CertFile = reloaded.Proxy.CertFile
+	res.Proxy.MaxAttempts = reloaded.Proxy.MaxAttempts
+	res.Proxy.RateLimit = reloaded.Proxy.RateLimit
+
+	return res
+}
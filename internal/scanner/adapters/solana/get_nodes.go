@@ -8,6 +8,7 @@ import (
 	"github.com/gagliardetto/solana-go"
 
 	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/pkg/storage/sqlite"
 	"extrnode-be/internal/scanner/models"
 )
 
@@ -120,6 +121,14 @@ func (a *SolanaAdapter) filterAndUpdateNodes(nodes []models.NodeInfo) (res []mod
 					if err != nil {
 						return res, fmt.Errorf("UpdatePeerNodePubkey: %s", err)
 					}
+					// event is matched with subscriptions of the new pubkey
+					oldPubkey := peer.NodePubkey
+					peer.NodePubkey = n.Pubkey.String()
+					a.addNodeEvent(peer.Peer, peer.Address, sqlite.NodeEvent{
+						Event:    sqlite.NodeEventPubkeyChanged,
+						OldValue: oldPubkey,
+						NewValue: peer.NodePubkey,
+					})
 				}
 
 				continue
@@ -0,0 +1,43 @@
+package solana
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/google/uuid"
+
+	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/pkg/storage/sqlite"
+)
+
+// addNodeEvent saves state change of peer to its history, so it's also sent to subscribers. Errors are logged, they don't stop the scan
+func (a *SolanaAdapter) addNodeEvent(peer sqlite.Peer, address net.IP, e sqlite.NodeEvent) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		log.Logger.Scanner.Errorf("addNodeEvent uuid.NewRandom: %s", err)
+		return
+	}
+
+	e.UUID = id.String()
+	e.PeerID = peer.ID
+	e.Endpoint = fmt.Sprintf("%s:%d", address.String(), peer.Port)
+	e.NodePubkey = peer.NodePubkey
+	e.ServerID = a.cfg.Scanner.Hostname
+	err = a.storage.AddNodeEvent(e)
+	if err != nil {
+		log.Logger.Scanner.Errorf("AddNodeEvent %s %s: %s", e.Event, e.Endpoint, err)
+	}
+}
+
+// addFlagEvent saves event of flag change if flag is changed
+func (a *SolanaAdapter) addFlagEvent(peer sqlite.PeerWithIpAndBlockchain, oldValue, newValue bool, enabledEvent, disabledEvent string) {
+	if oldValue == newValue {
+		return
+	}
+
+	event := disabledEvent
+	if newValue {
+		event = enabledEvent
+	}
+	a.addNodeEvent(peer.Peer, peer.Address, sqlite.NodeEvent{Event: event})
+}
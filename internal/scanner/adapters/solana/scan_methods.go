@@ -6,14 +6,14 @@ import (
 	"github.com/gagliardetto/solana-go"
 
 	"extrnode-be/internal/pkg/log"
-	"extrnode-be/internal/pkg/storage/clickhouse"
+	"extrnode-be/internal/pkg/stats_types"
 	"extrnode-be/internal/pkg/storage/sqlite"
 )
 
 var solanaMainNetGenesisHash = solana.MustHashFromBase58("5eykt4UsFv8P8NJdTREpY1vzqKqZKvdpKuc147dw2N9d")
 
 func (a *SolanaAdapter) updatePeerInfo(peer sqlite.PeerWithIpAndBlockchain, peerName string, isAlive, isRpc, isSSL, isMainNet, isValidator, deleteAllRpcMethods bool, version string) error {
-	a.scannerPeersCollector.Add(clickhouse.ScannerPeer{
+	a.scannerPeersCollector.Add(stats_types.ScannerPeer{
 		ServerId:      a.cfg.Scanner.Hostname,
 		Time:          a.scanStartTime,
 		Peer:          peerName,
@@ -21,13 +21,17 @@ func (a *SolanaAdapter) updatePeerInfo(peer sqlite.PeerWithIpAndBlockchain, peer
 		IsAlive:       isAlive,
 	})
 
+	// version is empty if node doesn't respond, the last known one is kept
+	if version == "" {
+		version = peer.Version
+	}
 	err := a.storage.UpdatePeerByID(peer.ID, isRpc, isAlive, isSSL, isMainNet, isValidator, version)
 	if err != nil {
 		return fmt.Errorf("UpdatePeerByID: %s", err)
 	}
 
 	if deleteAllRpcMethods {
-		err = a.storage.DeleteRpcPeerMethod(peer.ID, nil)
+		_, err = a.storage.DeleteRpcPeerMethod(peer.ID, nil)
 		if err != nil {
 			return fmt.Errorf("DeleteRpcPeerMethod: %s", err)
 		}
@@ -36,6 +40,13 @@ func (a *SolanaAdapter) updatePeerInfo(peer sqlite.PeerWithIpAndBlockchain, peer
 	if peer.IsRpc != isRpc {
 		log.Logger.Scanner.Debugf("peer updated %s:%d: isRpc %t", peer.Address, peer.Port, isRpc)
 	}
+	a.addFlagEvent(peer, peer.IsAlive, isAlive, sqlite.NodeEventUp, sqlite.NodeEventDown)
+	a.addFlagEvent(peer, peer.IsRpc, isRpc, sqlite.NodeEventRpcEnabled, sqlite.NodeEventRpcDisabled)
+	a.addFlagEvent(peer, peer.IsSSL, isSSL, sqlite.NodeEventSSLEnabled, sqlite.NodeEventSSLDisabled)
+	a.addFlagEvent(peer, peer.IsValidator, isValidator, sqlite.NodeEventValidatorEnabled, sqlite.NodeEventValidatorDisabled)
+	if peer.Version != version {
+		a.addNodeEvent(peer.Peer, peer.Address, sqlite.NodeEvent{Event: sqlite.NodeEventVersionChanged, OldValue: peer.Version, NewValue: version})
+	}
 
 	return nil
 }
@@ -80,18 +91,25 @@ func (a *SolanaAdapter) ScanMethods(peer sqlite.PeerWithIpAndBlockchain) error {
 				log.Logger.Scanner.Errorf("checkRpcMethod %s %s:%d: %s", mName, peer.Address, peer.Port, err)
 			}
 			isRpc = false
-			err = a.storage.DeleteRpcPeerMethod(peer.ID, &mID)
+			isDeleted, err := a.storage.DeleteRpcPeerMethod(peer.ID, &mID)
 			if err != nil {
 				return fmt.Errorf("DeleteRpcPeerMethod: %s", err)
 			}
+			// methods of peer which wasn't alive are checked the first time, their changes aren't events
+			if isDeleted && peer.IsAlive {
+				a.addNodeEvent(peer.Peer, peer.Address, sqlite.NodeEvent{Event: sqlite.NodeEventMethodUnsupported, Method: mName})
+			}
 		} else {
-			err = a.storage.UpsertRpcPeerMethod(peer.ID, mID, responseTime)
+			isCreated, err := a.storage.UpsertRpcPeerMethod(peer.ID, mID, responseTime)
 			if err != nil {
 				return fmt.Errorf("UpsertRpcPeerMethod: %s", err)
 			}
+			if isCreated && peer.IsAlive {
+				a.addNodeEvent(peer.Peer, peer.Address, sqlite.NodeEvent{Event: sqlite.NodeEventMethodSupported, Method: mName})
+			}
 		}
 
-		a.scannerMethodsCollector.Add(clickhouse.ScannerMethod{
+		a.scannerMethodsCollector.Add(stats_types.ScannerMethod{
 			ServerId:       a.cfg.Scanner.Hostname,
 			Time:           a.scanStartTime,
 			Peer:           peerName,
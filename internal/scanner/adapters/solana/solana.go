@@ -11,8 +11,8 @@ import (
 	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
 
 	"extrnode-be/internal/pkg/log"
-	"extrnode-be/internal/pkg/storage/clickhouse"
-	"extrnode-be/internal/pkg/storage/clickhouse/delayed_insertion"
+	"extrnode-be/internal/pkg/stats_types"
+	"extrnode-be/internal/pkg/storage/delayed_insertion"
 	"extrnode-be/internal/pkg/storage/sqlite"
 	"extrnode-be/internal/scanner/config"
 	"extrnode-be/internal/scanner/scaners/asn"
@@ -39,11 +39,11 @@ type SolanaAdapter struct {
 	baseRpcClient          *rpc.Client
 	scanStartTime          time.Time
 
-	scannerMethodsCollector *delayed_insertion.Collector[clickhouse.ScannerMethod]
-	scannerPeersCollector   *delayed_insertion.Collector[clickhouse.ScannerPeer]
+	scannerMethodsCollector *delayed_insertion.Collector[stats_types.ScannerMethod]
+	scannerPeersCollector   *delayed_insertion.Collector[stats_types.ScannerPeer]
 }
 
-func NewSolanaAdapter(ctx context.Context, cfg config.Config, storage sqlite.Storage, scannerMethodsCollector *delayed_insertion.Collector[clickhouse.ScannerMethod], scannerPeersCollector *delayed_insertion.Collector[clickhouse.ScannerPeer]) (*SolanaAdapter, error) {
+func NewSolanaAdapter(ctx context.Context, cfg config.Config, storage sqlite.Storage, scannerMethodsCollector *delayed_insertion.Collector[stats_types.ScannerMethod], scannerPeersCollector *delayed_insertion.Collector[stats_types.ScannerPeer]) (*SolanaAdapter, error) {
 	blockchain, err := storage.GetBlockchainByName(solanaBlockchain)
 	if err != nil {
 		return nil, fmt.Errorf("GetBlockchainByName: %s", err)
@@ -220,7 +220,10 @@ func (a *SolanaAdapter) CheckOutdatedNodes() error {
 			err = a.storage.UpdatePeerIsOutdated(p.ID, isOutdated)
 			if err != nil {
 				log.Logger.Scanner.Errorf("UpdatePeerIsOutdated: %s", err)
+				continue
 			}
+
+			a.addFlagEvent(p.PeerWithIpAndBlockchain, p.IsOutdated, isOutdated, sqlite.NodeEventOutdated, sqlite.NodeEventSynced)
 		}
 	}
 
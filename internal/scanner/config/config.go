@@ -10,12 +10,19 @@ type Config struct {
 	Scanner config_types.ScannerConfig
 	SL      config_types.SQLiteConfig
 	CH      config_types.ClickhouseConfig
+	Stats   config_types.StatsConfig
 }
 
 func (c Config) Validate() error {
 	if err := c.SL.Validate(); err != nil {
 		return fmt.Errorf("sqlite: %s", err)
 	}
+	if err := c.CH.Validate(); err != nil {
+		return fmt.Errorf("clickhouse: %s", err)
+	}
+	if err := c.Stats.Validate(); err != nil {
+		return fmt.Errorf("stats: %s", err)
+	}
 	if err := c.Scanner.Validate(); err != nil {
 		return fmt.Errorf("scanner: %s", err)
 	}
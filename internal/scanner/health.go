@@ -0,0 +1,79 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo-contrib/prometheus"
+	"github.com/labstack/echo/v4/middleware"
+
+	"extrnode-be/internal/pkg/metrics"
+	"extrnode-be/internal/pkg/stats_types"
+	"extrnode-be/internal/pkg/storage/delayed_insertion"
+	"extrnode-be/internal/pkg/storage/stats_sink"
+	echo2 "extrnode-be/internal/pkg/util/echo"
+)
+
+const healthShutdownTimeout = 5 * time.Second
+
+type (
+	lastScanHealthInfo struct {
+		// unix time, 0 if there was no successful scan since start
+		LastScanTime int64 `json:"last_scan_time"`
+	}
+	collectorsHealthInfo struct {
+		MethodsBacklog int `json:"methods_backlog"`
+		PeersBacklog   int `json:"peers_backlog"`
+	}
+	sinkHealthInfo struct {
+		Sink string `json:"sink"`
+	}
+)
+
+// initHealthChecks registers dependencies checks. Nil stats sink is not configured and not checked
+func (s *scanner) initHealthChecks(sink stats_sink.StatsSink, methodsCollector *delayed_insertion.Collector[stats_types.ScannerMethod], peersCollector *delayed_insertion.Collector[stats_types.ScannerPeer]) {
+	s.health.AddCheck("sqlite", true, func(ctx context.Context) (interface{}, error) {
+		return nil, s.slStorage.Ping(ctx)
+	})
+	if sink != nil {
+		s.health.AddCheck("stats_sink", false, func(ctx context.Context) (interface{}, error) {
+			return sinkHealthInfo{Sink: sink.Name()}, sink.Ping(ctx)
+		})
+	}
+	s.health.AddCheck("scan", false, func(ctx context.Context) (interface{}, error) {
+		return lastScanHealthInfo{LastScanTime: s.lastScanTime.Load()}, nil
+	})
+	s.health.AddCheck("collectors", false, func(ctx context.Context) (interface{}, error) {
+		return collectorsHealthInfo{MethodsBacklog: methodsCollector.Len(), PeersBacklog: peersCollector.Len()}, nil
+	})
+}
+
+// setupHealthServer registers health checks and collectors metrics on health server
+func (s *scanner) setupHealthServer() {
+	echo2.SetupServer(s.healthServer)
+	s.healthServer.HideBanner = true
+	s.healthServer.Use(middleware.RecoverWithConfig(middleware.RecoverConfig{
+		DisableStackAll: true,
+		LogErrorFunc:    echo2.LogPanic,
+	}))
+	s.health.Register(s.healthServer)
+
+	prom := prometheus.NewPrometheus("extrnode", nil, metrics.MetricList())
+	prom.SetMetricsPath(s.healthServer)
+}
+
+// RunHealth starts health and readiness checks server, if port is set
+func (s *scanner) RunHealth() error {
+	if s.cfg.Scanner.HealthPort == 0 {
+		return nil
+	}
+
+	err := s.healthServer.Start(fmt.Sprintf(":%d", s.cfg.Scanner.HealthPort))
+	if err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
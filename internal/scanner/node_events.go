@@ -0,0 +1,101 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/pkg/storage/sqlite"
+	"extrnode-be/internal/pkg/webhook"
+)
+
+const (
+	nodeEventsDeliveryInterval = 10 * time.Second
+	nodeEventsCleanupInterval  = time.Hour
+	nodeEventsDeliveriesBatch  = 100
+)
+
+// deliverNodeEvents sends node events to webhooks of subscribers and deletes deliveries after retention period
+func (s *scanner) deliverNodeEvents(ctx context.Context) {
+	client := webhook.NewClient(s.cfg.Scanner.WebhookTimeout)
+	var lastCleanup time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Logger.Scanner.Info("stopping node events delivery")
+			return
+
+		case <-time.After(nodeEventsDeliveryInterval):
+			if time.Since(lastCleanup) >= nodeEventsCleanupInterval {
+				count, err := s.slStorage.DeleteNodeEventDeliveries(time.Now().Add(-s.cfg.Scanner.DeliveriesRetention))
+				if err != nil {
+					log.Logger.Scanner.Errorf("DeleteNodeEventDeliveries: %s", err)
+				} else {
+					log.Logger.Scanner.Debugf("deleted node event deliveries: %d", count)
+					lastCleanup = time.Now()
+				}
+			}
+
+			err := s.sendNodeEvents(ctx, client)
+			if err != nil {
+				log.Logger.Scanner.Errorf("sendNodeEvents: %s", err)
+			}
+		}
+	}
+}
+
+// sendNodeEvents sends due deliveries until there are no more of them
+func (s *scanner) sendNodeEvents(ctx context.Context, client webhook.Client) error {
+	for ctx.Err() == nil {
+		deliveries, err := s.slStorage.GetDueNodeEventDeliveries(nodeEventsDeliveriesBatch)
+		if err != nil {
+			return err
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+
+		for _, d := range deliveries {
+			s.sendNodeEvent(ctx, client, &d)
+			err = s.slStorage.SaveNodeEventDeliveryAttempt(d)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// sendNodeEvent posts event to webhook and sets result of the attempt
+func (s *scanner) sendNodeEvent(ctx context.Context, client webhook.Client, d *sqlite.NodeEventDelivery) {
+	d.Attempts++
+	body, err := json.Marshal(d.Event)
+	if err == nil {
+		var statusCode int
+		statusCode, err = client.Post(ctx, d.WebhookURL, d.WebhookSecret, d.Event.Event, d.Event.UUID, body)
+		if statusCode != 0 {
+			d.ResponseStatus = &statusCode
+		}
+	}
+	if err == nil {
+		now := time.Now()
+		d.Status = sqlite.NodeEventDeliveryDelivered
+		d.DeliveredAt = &now
+		d.Error = nil
+		return
+	}
+
+	errMsg := err.Error()
+	if len(errMsg) > webhook.MaxErrorLen {
+		errMsg = errMsg[:webhook.MaxErrorLen]
+	}
+	d.Error = &errMsg
+	if d.Attempts >= s.cfg.Scanner.WebhookMaxAttempts {
+		d.Status = sqlite.NodeEventDeliveryFailed
+		return
+	}
+	d.NextAttemptAt = time.Now().Add(webhook.RetryDelay(d.Attempts))
+}
@@ -4,12 +4,17 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/labstack/echo/v4"
+
+	"extrnode-be/internal/pkg/health"
 	"extrnode-be/internal/pkg/log"
-	"extrnode-be/internal/pkg/storage/clickhouse"
-	"extrnode-be/internal/pkg/storage/clickhouse/delayed_insertion"
+	"extrnode-be/internal/pkg/stats_types"
+	"extrnode-be/internal/pkg/storage/delayed_insertion"
 	"extrnode-be/internal/pkg/storage/sqlite"
+	"extrnode-be/internal/pkg/storage/stats_sink"
 	"extrnode-be/internal/scanner/adapters"
 	"extrnode-be/internal/scanner/adapters/solana"
 	"extrnode-be/internal/scanner/config"
@@ -27,6 +32,12 @@ type scanner struct {
 	ctx       context.Context
 	ctxCancel context.CancelFunc
 	adapters  map[chainType]adapters.Adapter
+
+	// health server is started only if port is set
+	healthServer *echo.Echo
+	health       *health.Health
+	// unix time of last successful peer scan
+	lastScanTime atomic.Int64
 }
 
 const (
@@ -40,19 +51,19 @@ func NewScanner(cfg config.Config) (*scanner, error) {
 	if err != nil {
 		return nil, fmt.Errorf("SL storage init: %s", err)
 	}
-	chStorage, err := clickhouse.New(cfg.CH.DSN)
+	sink, err := stats_sink.New(cfg.Stats, cfg.CH, slStorage)
 	if err != nil {
-		return nil, fmt.Errorf("CH storage init: %s", err)
+		return nil, fmt.Errorf("stats sink init: %s", err)
 	}
 
-	scannerMethodsCollector := delayed_insertion.New[clickhouse.ScannerMethod](ctx, chStorage, collectorInterval)
-	scannerPeersCollector := delayed_insertion.New[clickhouse.ScannerPeer](ctx, chStorage, collectorInterval)
+	scannerMethodsCollector := delayed_insertion.New[stats_types.ScannerMethod](ctx, sink, collectorInterval, cfg.Stats)
+	scannerPeersCollector := delayed_insertion.New[stats_types.ScannerPeer](ctx, sink, collectorInterval, cfg.Stats)
 	solanaAdapter, err := solana.NewSolanaAdapter(ctx, cfg, slStorage, scannerMethodsCollector, scannerPeersCollector)
 	if err != nil {
 		return nil, fmt.Errorf("NewSolanaAdapter: %s", err)
 	}
 
-	return &scanner{
+	s := &scanner{
 		cfg:           cfg,
 		slStorage:     slStorage,
 		taskQueue:     make(chan scannerTask),
@@ -61,11 +72,29 @@ func NewScanner(cfg config.Config) (*scanner, error) {
 		ctx:           ctx,
 		ctxCancel:     cancelFunc,
 		adapters:      map[chainType]adapters.Adapter{chainTypeSolana: solanaAdapter},
-	}, nil
+		healthServer:  echo.New(),
+		health:        health.New(),
+	}
+	s.initHealthChecks(sink, scannerMethodsCollector, scannerPeersCollector)
+	if cfg.Scanner.HealthPort != 0 {
+		s.setupHealthServer()
+	}
+
+	// stop waits for final flush of collectors
+	for _, done := range []<-chan struct{}{scannerMethodsCollector.Done(), scannerPeersCollector.Done()} {
+		s.waitGroup.Add(1)
+		go func(done <-chan struct{}) {
+			defer s.waitGroup.Done()
+			<-done
+		}(done)
+	}
+
+	return s, nil
 }
 
 func (s *scanner) Run() error {
 	s.runWithWaitGroup(s.ctx, s.scheduleScans)
+	s.runWithWaitGroup(s.ctx, s.deliverNodeEvents)
 
 	for i := 0; i < s.cfg.Scanner.ThreadsNum; i++ {
 		s.runWithWaitGroup(s.ctx, s.runScanner)
@@ -138,6 +167,8 @@ func (s *scanner) runScanner(ctx context.Context) {
 			err = adapter.Scan(task.peer)
 			if err != nil {
 				log.Logger.Scanner.Errorf("Scan (%s %s:%d): %s", task.chain, task.peer.Address, task.peer.Port, err)
+			} else {
+				s.lastScanTime.Store(time.Now().Unix())
 			}
 
 		case <-time.After(time.Minute):
@@ -187,6 +218,15 @@ func (s *scanner) WaitGroup() *sync.WaitGroup {
 }
 
 func (s *scanner) Stop() (err error) {
+	s.health.SetDraining()
 	s.ctxCancel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthShutdownTimeout)
+	defer cancel()
+	err = s.healthServer.Shutdown(ctx)
+	if err != nil {
+		log.Logger.Scanner.Errorf("healthServer.Shutdown: %s", err)
+	}
+
 	return nil
 }
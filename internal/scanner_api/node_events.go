@@ -0,0 +1,339 @@
+package scanner_api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	solana "github.com/gagliardetto/solana-go"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/pkg/storage/sqlite"
+	"extrnode-be/internal/pkg/webhook"
+)
+
+const (
+	subscriptionIDParam = "id"
+	// subscriptions of the same node pubkey or endpoint
+	maxNodeSubscriptions = 10
+	maxNodeDeliveries    = 100
+	maxWebhookURLLen     = 2048
+	bearerPrefix         = "Bearer "
+	// signed timestamp of subscription request may differ from server time by this duration
+	subscriptionSignatureTTL = 5 * time.Minute
+)
+
+var nodeEvents = map[string]struct{}{
+	sqlite.NodeEventDown:              {},
+	sqlite.NodeEventUp:                {},
+	sqlite.NodeEventRpcDisabled:       {},
+	sqlite.NodeEventRpcEnabled:        {},
+	sqlite.NodeEventMethodUnsupported: {},
+	sqlite.NodeEventMethodSupported:   {},
+	sqlite.NodeEventOutdated:          {},
+	sqlite.NodeEventSynced:            {},
+	sqlite.NodeEventSSLEnabled:        {},
+	sqlite.NodeEventSSLDisabled:       {},
+	sqlite.NodeEventValidatorEnabled:  {},
+	sqlite.NodeEventValidatorDisabled: {},
+	sqlite.NodeEventVersionChanged:    {},
+	sqlite.NodeEventPubkeyChanged:     {},
+}
+
+type nodeSubscriptionRequest struct {
+	NodePubkey string `json:"node_pubkey"`
+	Endpoint   string `json:"endpoint"`
+	WebhookURL string `json:"webhook_url"`
+	// unix time and base58 signature of subscriptionMessage by node identity key
+	Timestamp int64  `json:"timestamp"`
+	Signature string `json:"signature"`
+}
+
+// nodeEventsHandler returns history of node by pubkey or endpoint, the latest events first
+func (a *scannerApi) nodeEventsHandler(ctx echo.Context) error {
+	var (
+		f   = sqlite.NodeEventsFilter{Limit: defaultLimit}
+		err error
+	)
+	f.NodePubkey, f.Endpoint, err = parseNode(ctx.QueryParam("node_pubkey"), ctx.QueryParam("endpoint"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if paramString := ctx.QueryParam("limit"); paramString != "" {
+		limit, err := strconv.Atoi(paramString)
+		if err != nil || limit > maxLimit || limit < minLimit {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit")
+		}
+		f.Limit = uint64(limit)
+	}
+	if paramString := ctx.QueryParam("event"); paramString != "" {
+		f.Events = strings.Split(paramString, ",")
+		if len(f.Events) > arrMaxLen {
+			return echo.NewHTTPError(http.StatusBadRequest, "event length")
+		}
+		for _, e := range f.Events {
+			if _, ok := nodeEvents[e]; !ok {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown event: %s", e))
+			}
+		}
+	}
+	if paramString := ctx.QueryParam("from"); paramString != "" {
+		from, err := time.Parse(time.RFC3339, paramString)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "from")
+		}
+		f.From = &from
+	}
+	if paramString := ctx.QueryParam("to"); paramString != "" {
+		to, err := time.Parse(time.RFC3339, paramString)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "to")
+		}
+		f.To = &to
+	}
+
+	events, err := a.slStorage.GetNodeEvents(f)
+	if err != nil {
+		log.Logger.ScannerApi.Errorf("nodeEventsHandler: GetNodeEvents: %s", err)
+		return err
+	}
+	if events == nil {
+		events = []sqlite.NodeEvent{}
+	}
+
+	return ctx.JSON(http.StatusOK, events)
+}
+
+// createNodeSubscriptionHandler subscribes webhook to events of node in the pool.
+// Request must be signed by identity key of node, so subscriptions can be created only by its operator.
+// Subscription is managed by its token, which is returned once
+func (a *scannerApi) createNodeSubscriptionHandler(ctx echo.Context) error {
+	var req nodeSubscriptionRequest
+	err := ctx.Bind(&req)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	nodePubkey, endpoint, err := parseNode(req.NodePubkey, req.Endpoint)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	webhookURL, err := parseWebhookURL(req.WebhookURL)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	pubkeys, isFound, err := a.slStorage.GetNodePeerPubkeys(nodePubkey, endpoint)
+	if err != nil {
+		log.Logger.ScannerApi.Errorf("createNodeSubscriptionHandler: GetNodePeerPubkeys: %s", err)
+		return err
+	}
+	if !isFound {
+		return echo.NewHTTPError(http.StatusNotFound, "node is not found")
+	}
+	err = verifySubscriptionSignature(req, nodePubkey+endpoint, webhookURL, pubkeys)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+
+	// signed request may be replayed until it expires, but it can't add more subscriptions of the same webhook
+	isSubscribed, err := a.slStorage.HasNodeSubscription(nodePubkey, endpoint, webhookURL)
+	if err != nil {
+		log.Logger.ScannerApi.Errorf("createNodeSubscriptionHandler: HasNodeSubscription: %s", err)
+		return err
+	}
+	if isSubscribed {
+		return echo.NewHTTPError(http.StatusConflict, "webhook is already subscribed to node")
+	}
+	count, err := a.slStorage.CountNodeSubscriptions(nodePubkey, endpoint)
+	if err != nil {
+		log.Logger.ScannerApi.Errorf("createNodeSubscriptionHandler: CountNodeSubscriptions: %s", err)
+		return err
+	}
+	if count >= maxNodeSubscriptions {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("subscriptions limit %d of node is reached", maxNodeSubscriptions))
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		log.Logger.ScannerApi.Errorf("createNodeSubscriptionHandler: NewSecret: %s", err)
+		return err
+	}
+	token, err := uuid.NewRandom()
+	if err != nil {
+		log.Logger.ScannerApi.Errorf("createNodeSubscriptionHandler: uuid.NewRandom: %s", err)
+		return err
+	}
+	sub, err := a.slStorage.CreateNodeSubscription(sqlite.NodeSubscription{
+		NodePubkey:    nodePubkey,
+		Endpoint:      endpoint,
+		WebhookURL:    webhookURL,
+		WebhookSecret: secret,
+		Token:         token.String(),
+	})
+	if err != nil {
+		log.Logger.ScannerApi.Errorf("createNodeSubscriptionHandler: CreateNodeSubscription: %s", err)
+		return err
+	}
+
+	return ctx.JSON(http.StatusCreated, sub)
+}
+
+func (a *scannerApi) getNodeSubscriptionHandler(ctx echo.Context) error {
+	sub, err := a.getNodeSubscription(ctx)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, sub)
+}
+
+func (a *scannerApi) deleteNodeSubscriptionHandler(ctx echo.Context) error {
+	id, token, err := subscriptionRequest(ctx)
+	if err != nil {
+		return err
+	}
+
+	isFound, err := a.slStorage.DeleteNodeSubscription(id, token)
+	if err != nil {
+		log.Logger.ScannerApi.Errorf("deleteNodeSubscriptionHandler: DeleteNodeSubscription: %s", err)
+		return err
+	}
+	if !isFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// getNodeDeliveriesHandler returns the latest webhook deliveries of subscription
+func (a *scannerApi) getNodeDeliveriesHandler(ctx echo.Context) error {
+	sub, err := a.getNodeSubscription(ctx)
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := a.slStorage.GetNodeEventDeliveries(sub.ID, maxNodeDeliveries)
+	if err != nil {
+		log.Logger.ScannerApi.Errorf("getNodeDeliveriesHandler: GetNodeEventDeliveries: %s", err)
+		return err
+	}
+	if deliveries == nil {
+		deliveries = []sqlite.NodeEventDelivery{}
+	}
+
+	return ctx.JSON(http.StatusOK, deliveries)
+}
+
+// getNodeSubscription returns subscription of id param if bearer token matches it
+func (a *scannerApi) getNodeSubscription(ctx echo.Context) (sub sqlite.NodeSubscription, err error) {
+	id, token, err := subscriptionRequest(ctx)
+	if err != nil {
+		return sub, err
+	}
+
+	sub, isFound, err := a.slStorage.GetNodeSubscription(id, token)
+	if err != nil {
+		log.Logger.ScannerApi.Errorf("GetNodeSubscription: %s", err)
+		return sub, err
+	}
+	if !isFound {
+		return sub, echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	return sub, nil
+}
+
+// subscriptionRequest returns subscription id and its token from bearer authorization
+func subscriptionRequest(ctx echo.Context) (id int64, token string, err error) {
+	id, err = strconv.ParseInt(ctx.Param(subscriptionIDParam), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, "", echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+	auth := ctx.Request().Header.Get(echo.HeaderAuthorization)
+	if !strings.HasPrefix(auth, bearerPrefix) {
+		return 0, "", echo.NewHTTPError(http.StatusUnauthorized, "missing subscription token")
+	}
+
+	return id, strings.TrimSpace(strings.TrimPrefix(auth, bearerPrefix)), nil
+}
+
+// parseNode returns pubkey or ip:port endpoint in the form saved by scanner, exactly one of them must be set
+func parseNode(nodePubkey, endpoint string) (string, string, error) {
+	nodePubkey = strings.TrimSpace(nodePubkey)
+	endpoint = strings.TrimSpace(endpoint)
+	if (nodePubkey == "") == (endpoint == "") {
+		return "", "", fmt.Errorf("one of node_pubkey and endpoint is required")
+	}
+
+	if nodePubkey != "" {
+		_, err := solana.PublicKeyFromBase58(nodePubkey)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid node_pubkey")
+		}
+
+		return nodePubkey, "", nil
+	}
+
+	host, portString, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid endpoint")
+	}
+	ip := net.ParseIP(host)
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if ip == nil || err != nil || port == 0 {
+		return "", "", fmt.Errorf("invalid endpoint")
+	}
+
+	return "", fmt.Sprintf("%s:%d", ip.String(), port), nil
+}
+
+// parseWebhookURL accepts only https urls of public hosts, resolved address is checked again by webhook client on dial
+func parseWebhookURL(webhookURL string) (string, error) {
+	webhookURL = strings.TrimSpace(webhookURL)
+	if len(webhookURL) > maxWebhookURLLen {
+		return "", fmt.Errorf("webhook_url is longer than %d", maxWebhookURLLen)
+	}
+	if err := webhook.ValidateURL(webhookURL); err != nil {
+		return "", fmt.Errorf("invalid webhook_url: %s", err)
+	}
+
+	return webhookURL, nil
+}
+
+// subscriptionMessage is signed by node identity key to subscribe webhook to node pubkey or endpoint
+func subscriptionMessage(node, webhookURL string, timestamp int64) string {
+	return fmt.Sprintf("extrnode node subscription\nnode: %s\nwebhook: %s\ntimestamp: %d", node, webhookURL, timestamp)
+}
+
+// verifySubscriptionSignature checks that request is signed recently by one of identity pubkeys of node
+func verifySubscriptionSignature(req nodeSubscriptionRequest, node, webhookURL string, pubkeys []string) error {
+	if len(pubkeys) == 0 {
+		return fmt.Errorf("identity of node is unknown")
+	}
+	signedAt := time.Unix(req.Timestamp, 0)
+	if time.Since(signedAt) > subscriptionSignatureTTL || time.Until(signedAt) > subscriptionSignatureTTL {
+		return fmt.Errorf("timestamp is expired")
+	}
+	sig, err := solana.SignatureFromBase58(strings.TrimSpace(req.Signature))
+	if err != nil {
+		return fmt.Errorf("invalid signature")
+	}
+
+	message := []byte(subscriptionMessage(node, webhookURL, req.Timestamp))
+	for _, pubkey := range pubkeys {
+		pk, err := solana.PublicKeyFromBase58(pubkey)
+		if err != nil {
+			continue
+		}
+		if sig.Verify(pk, message) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid signature")
+}
@@ -8,7 +8,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/gagliardetto/solana-go"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/patrickmn/go-cache"
@@ -17,6 +16,7 @@ import (
 	"extrnode-be/internal/scanner_api/config"
 
 	"extrnode-be/internal/pkg/config_types"
+	"extrnode-be/internal/pkg/health"
 	"extrnode-be/internal/pkg/log"
 	"extrnode-be/internal/pkg/storage/sqlite"
 )
@@ -30,10 +30,10 @@ type scannerApi struct {
 	waitGroup *sync.WaitGroup
 	ctx       context.Context
 	ctxCancel context.CancelFunc
+	health    *health.Health
 
 	supportedOutputFormats map[string]struct{}
 	blockchainIDs          map[string]int
-	apiPrivateKey          solana.PrivateKey
 }
 
 const (
@@ -61,12 +61,6 @@ func NewAPI(cfg config.Config) (*scannerApi, error) {
 		return nil, fmt.Errorf("GetBlockchainsMap: %s", err)
 	}
 
-	// TODO: get from config
-	privKey, err := solana.NewRandomPrivateKey()
-	if err != nil {
-		return nil, fmt.Errorf("NewRandomPrivateKey: %s", err)
-	}
-
 	a := &scannerApi{
 		conf:      cfg.SApi,
 		router:    echo.New(),
@@ -76,13 +70,13 @@ func NewAPI(cfg config.Config) (*scannerApi, error) {
 		waitGroup: &sync.WaitGroup{},
 		ctx:       ctx,
 		ctxCancel: cancelFunc,
+		health:    health.New(),
 		supportedOutputFormats: map[string]struct{}{
 			jsonOutputFormat:    {},
 			csvOutputFormat:     {},
 			haproxyOutputFormat: {},
 		},
 		blockchainIDs: blockchainsMap,
-		apiPrivateKey: privKey,
 	}
 
 	if cfg.SApi.CertFile != "" {
@@ -103,13 +97,24 @@ func (a *scannerApi) initApiHandlers() error {
 	echo2.InitHandlersStart(a.router)
 
 	a.router.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"*"},
+		AllowOrigins: a.conf.CorsAllowOrigins,
 		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
 	}))
 
+	// health
+	a.health.AddCheck("sqlite", true, func(ctx context.Context) (interface{}, error) {
+		return nil, a.slStorage.Ping(ctx)
+	})
+	a.health.Register(a.router)
+
 	// public
 	a.router.GET("/endpoints", a.endpointsHandler)
 	a.router.GET("/stats", a.statsHandler)
+	a.router.GET("/node_events", a.nodeEventsHandler)
+	a.router.POST("/node_subscriptions", a.createNodeSubscriptionHandler)
+	a.router.GET(fmt.Sprintf("/node_subscriptions/:%s", subscriptionIDParam), a.getNodeSubscriptionHandler)
+	a.router.DELETE(fmt.Sprintf("/node_subscriptions/:%s", subscriptionIDParam), a.deleteNodeSubscriptionHandler)
+	a.router.GET(fmt.Sprintf("/node_subscriptions/:%s/deliveries", subscriptionIDParam), a.getNodeDeliveriesHandler)
 
 	return nil
 }
@@ -129,6 +134,7 @@ func (a *scannerApi) Run() (err error) {
 }
 
 func (a *scannerApi) Stop() error {
+	a.health.SetDraining()
 	ctx, cancel := context.WithTimeout(a.ctx, serverShutdownTimeout)
 	defer cancel()
 
@@ -0,0 +1,251 @@
+package user_api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"extrnode-be/internal/pkg/alerts"
+	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/pkg/storage/postgres"
+	"extrnode-be/internal/pkg/webhook"
+)
+
+const (
+	maxAlertRules        = 20
+	maxAlertRuleNameLen  = 64
+	maxAlertDeliveries   = 100
+	alertRuleIDParam     = "id"
+	maxWebhookURLLen     = 2048
+	defaultWindowMinutes = 5
+)
+
+type alertRuleRequest struct {
+	Name          string  `json:"name"`
+	Type          string  `json:"type"`
+	Threshold     float64 `json:"threshold"`
+	WindowMinutes int     `json:"window_minutes"`
+	WebhookURL    string  `json:"webhook_url"`
+	// default is true
+	Enabled *bool `json:"enabled"`
+}
+
+func (a *userApi) getAlertRulesHandler(ctx echo.Context) error {
+	u, err := a.getVerifiedAlertsUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	rules, err := a.pgStorage.GetAlertRules(u.ID)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.GetAlertRules: %s", err)
+		return err
+	}
+	if rules == nil {
+		rules = []postgres.AlertRule{}
+	}
+
+	return ctx.JSON(http.StatusOK, rules)
+}
+
+// createAlertRuleHandler creates rule with new webhook secret if user hasn't reached rules limit
+func (a *userApi) createAlertRuleHandler(ctx echo.Context) error {
+	u, err := a.getVerifiedAlertsUser(ctx)
+	if err != nil {
+		return err
+	}
+	r, err := bindAlertRule(ctx)
+	if err != nil {
+		return err
+	}
+	r.UserID = u.ID
+
+	count, err := a.pgStorage.CountAlertRules(u.ID)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.CountAlertRules: %s", err)
+		return err
+	}
+	if count >= maxAlertRules {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("alert rules limit %d is reached", maxAlertRules))
+	}
+
+	r.WebhookSecret, err = webhook.NewSecret()
+	if err != nil {
+		log.Logger.UserApi.Errorf("webhook.NewSecret: %s", err)
+		return err
+	}
+	r, err = a.pgStorage.CreateAlertRule(r)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.CreateAlertRule: %s", err)
+		return err
+	}
+
+	return ctx.JSON(http.StatusCreated, r)
+}
+
+// putAlertRuleHandler replaces rule condition and webhook url, webhook secret is kept
+func (a *userApi) putAlertRuleHandler(ctx echo.Context) error {
+	ruleID, err := parseIDParam(ctx, alertRuleIDParam)
+	if err != nil {
+		return err
+	}
+	u, err := a.getVerifiedAlertsUser(ctx)
+	if err != nil {
+		return err
+	}
+	r, err := bindAlertRule(ctx)
+	if err != nil {
+		return err
+	}
+	r.ID = ruleID
+	r.UserID = u.ID
+
+	r, isFound, err := a.pgStorage.UpdateAlertRule(r)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.UpdateAlertRule: %s", err)
+		return err
+	}
+	if !isFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	return ctx.JSON(http.StatusOK, r)
+}
+
+func (a *userApi) deleteAlertRuleHandler(ctx echo.Context) error {
+	ruleID, err := parseIDParam(ctx, alertRuleIDParam)
+	if err != nil {
+		return err
+	}
+	u, err := a.getVerifiedAlertsUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	isFound, err := a.pgStorage.DeleteAlertRule(u.ID, ruleID)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.DeleteAlertRule: %s", err)
+		return err
+	}
+	if !isFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// getAlertDeliveriesHandler returns the latest webhook deliveries of rule
+func (a *userApi) getAlertDeliveriesHandler(ctx echo.Context) error {
+	ruleID, err := parseIDParam(ctx, alertRuleIDParam)
+	if err != nil {
+		return err
+	}
+	u, err := a.getVerifiedAlertsUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	deliveries, isFound, err := a.pgStorage.GetAlertDeliveries(u.ID, ruleID, maxAlertDeliveries)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.GetAlertDeliveries: %s", err)
+		return err
+	}
+	if !isFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if deliveries == nil {
+		deliveries = []postgres.AlertDelivery{}
+	}
+
+	return ctx.JSON(http.StatusOK, deliveries)
+}
+
+// testAlertRuleHandler queues test event of rule, it's sent on the next alerts evaluation
+func (a *userApi) testAlertRuleHandler(ctx echo.Context) error {
+	ruleID, err := parseIDParam(ctx, alertRuleIDParam)
+	if err != nil {
+		return err
+	}
+	u, err := a.getVerifiedAlertsUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	rules, err := a.pgStorage.GetAlertRules(u.ID)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.GetAlertRules: %s", err)
+		return err
+	}
+	for _, r := range rules {
+		if r.ID != ruleID {
+			continue
+		}
+
+		d, err := alerts.NewDelivery(r, alerts.EventTest, 0)
+		if err != nil {
+			log.Logger.UserApi.Errorf("alerts.NewDelivery: %s", err)
+			return err
+		}
+		d, err = a.pgStorage.CreateAlertDelivery(d)
+		if err != nil {
+			log.Logger.UserApi.Errorf("storage.CreateAlertDelivery: %s", err)
+			return err
+		}
+
+		return ctx.JSON(http.StatusCreated, d)
+	}
+
+	return echo.NewHTTPError(http.StatusNotFound)
+}
+
+// getVerifiedAlertsUser returns verified user if alerts are enabled
+func (a *userApi) getVerifiedAlertsUser(ctx echo.Context) (postgres.User, error) {
+	if a.alerts == nil {
+		return postgres.User{}, echo.NewHTTPError(http.StatusServiceUnavailable, ErrAlertsNotConfigured)
+	}
+
+	return a.getVerifiedUser(ctx)
+}
+
+// bindAlertRule returns rule from request body
+func bindAlertRule(ctx echo.Context) (r postgres.AlertRule, err error) {
+	var req alertRuleRequest
+	err = ctx.Bind(&req)
+	if err != nil {
+		return r, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return r, echo.NewHTTPError(http.StatusBadRequest, "empty name")
+	}
+	if len(req.Name) > maxAlertRuleNameLen {
+		return r, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("name is longer than %d", maxAlertRuleNameLen))
+	}
+	if len(req.WebhookURL) > maxWebhookURLLen {
+		return r, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("webhook_url is longer than %d", maxWebhookURLLen))
+	}
+	if req.Type == alerts.RuleTypeQuota {
+		// quota is checked for the current month
+		req.WindowMinutes = 0
+	} else if req.WindowMinutes == 0 {
+		req.WindowMinutes = defaultWindowMinutes
+	}
+
+	r = postgres.AlertRule{
+		Name:          req.Name,
+		Type:          req.Type,
+		Threshold:     req.Threshold,
+		WindowMinutes: req.WindowMinutes,
+		WebhookURL:    strings.TrimSpace(req.WebhookURL),
+		Enabled:       req.Enabled == nil || *req.Enabled,
+	}
+	err = alerts.ValidateRule(r)
+	if err != nil {
+		return r, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return r, nil
+}
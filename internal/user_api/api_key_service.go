@@ -0,0 +1,202 @@
+package user_api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/pkg/storage/postgres"
+)
+
+const (
+	maxActiveApiKeys = 20
+	maxApiKeyNameLen = 64
+	apiKeyIDParam    = "id"
+	// last characters of token shown to members which can't manage keys
+	maskedTokenVisibleLen = 4
+)
+
+type createApiKeyRequest struct {
+	Name      string     `json:"name"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (a *userApi) getApiKeysHandler(ctx echo.Context) error {
+	u, err := a.getVerifiedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys, err := a.getApiKeys(postgres.ApiKeyOwner{UserID: u.ID})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, keys)
+}
+
+func (a *userApi) createApiKeyHandler(ctx echo.Context) error {
+	u, err := a.getVerifiedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	key, err := a.createApiKey(ctx, postgres.ApiKeyOwner{UserID: u.ID})
+	if err != nil {
+		return err
+	}
+	a.cache.Delete(u.ProviderID)
+
+	return ctx.JSON(http.StatusCreated, key)
+}
+
+func (a *userApi) rotateApiKeyHandler(ctx echo.Context) error {
+	keyID, err := parseIDParam(ctx, apiKeyIDParam)
+	if err != nil {
+		return err
+	}
+	u, err := a.getVerifiedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	key, err := a.rotateApiKey(postgres.ApiKeyOwner{UserID: u.ID}, keyID)
+	if err != nil {
+		return err
+	}
+	a.cache.Delete(u.ProviderID)
+
+	return ctx.JSON(http.StatusOK, key)
+}
+
+func (a *userApi) revokeApiKeyHandler(ctx echo.Context) error {
+	keyID, err := parseIDParam(ctx, apiKeyIDParam)
+	if err != nil {
+		return err
+	}
+	u, err := a.getVerifiedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = a.revokeApiKey(postgres.ApiKeyOwner{UserID: u.ID}, keyID)
+	if err != nil {
+		return err
+	}
+	a.cache.Delete(u.ProviderID)
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// maskedApiKey hides token except its last characters, so key can be recognized
+type maskedApiKey struct {
+	postgres.ApiKey
+	Token string `json:"token"`
+}
+
+func newMaskedApiKey(k postgres.ApiKey) maskedApiKey {
+	token := k.Token.String()
+	return maskedApiKey{
+		ApiKey: k,
+		Token:  strings.Repeat("*", len(token)-maskedTokenVisibleLen) + token[len(token)-maskedTokenVisibleLen:],
+	}
+}
+
+func (a *userApi) getApiKeys(owner postgres.ApiKeyOwner) ([]postgres.ApiKey, error) {
+	keys, err := a.pgStorage.GetApiKeys(owner)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.GetApiKeys: %s", err)
+		return nil, err
+	}
+	if keys == nil {
+		keys = []postgres.ApiKey{}
+	}
+
+	return keys, nil
+}
+
+// createApiKey creates api key from request body if owner hasn't reached active keys limit
+func (a *userApi) createApiKey(ctx echo.Context, owner postgres.ApiKeyOwner) (key postgres.ApiKey, err error) {
+	var req createApiKeyRequest
+	err = ctx.Bind(&req)
+	if err != nil {
+		return key, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	err = validateApiKeyRequest(&req)
+	if err != nil {
+		return key, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	count, err := a.pgStorage.CountActiveApiKeys(owner)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.CountActiveApiKeys: %s", err)
+		return key, err
+	}
+	if count >= maxActiveApiKeys {
+		return key, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("active api keys limit %d is reached", maxActiveApiKeys))
+	}
+
+	key, err = a.pgStorage.CreateApiKey(owner, req.Name, req.ExpiresAt)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.CreateApiKey: %s", err)
+		return key, err
+	}
+
+	return key, nil
+}
+
+func (a *userApi) rotateApiKey(owner postgres.ApiKeyOwner, keyID int64) (key postgres.ApiKey, err error) {
+	key, isFound, err := a.pgStorage.RotateApiKey(owner, keyID)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.RotateApiKey: %s", err)
+		return key, err
+	}
+	if !isFound {
+		return key, echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	return key, nil
+}
+
+func (a *userApi) revokeApiKey(owner postgres.ApiKeyOwner, keyID int64) error {
+	_, isFound, err := a.pgStorage.RevokeApiKey(owner, keyID)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.RevokeApiKey: %s", err)
+		return err
+	}
+	if !isFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	return nil
+}
+
+// parseIDParam returns positive id from path
+func parseIDParam(ctx echo.Context, name string) (int64, error) {
+	id, err := strconv.ParseInt(ctx.Param(name), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid %s", name))
+	}
+
+	return id, nil
+}
+
+func validateApiKeyRequest(req *createApiKeyRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fmt.Errorf("empty name")
+	}
+	if len(req.Name) > maxApiKeyNameLen {
+		return fmt.Errorf("name is longer than %d", maxApiKeyNameLen)
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("expires_at is in the past")
+	}
+
+	return nil
+}
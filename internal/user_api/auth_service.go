@@ -0,0 +1,131 @@
+package user_api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"extrnode-be/internal/pkg/auth_providers"
+	"extrnode-be/internal/pkg/log"
+	echo2 "extrnode-be/internal/pkg/util/echo"
+)
+
+type (
+	credentialsRequest struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	verifyEmailRequest struct {
+		Token string `json:"token"`
+	}
+	authTokenResp struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+)
+
+// signUpHandler creates account of local auth provider
+func (a *userApi) signUpHandler(local *auth_providers.Local) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		var req credentialsRequest
+		err := ctx.Bind(&req)
+		if err != nil {
+			return ctx.JSON(http.StatusBadRequest, err.Error())
+		}
+
+		// token is returned at once, but account can't be used until email is verified by link
+		token, expiresAt, err := local.SignUp(strings.TrimSpace(req.Email), req.Password)
+		if err != nil {
+			switch {
+			case errors.Is(err, auth_providers.ErrInvalidEmail), errors.Is(err, auth_providers.ErrInvalidPassword):
+				return ctx.JSON(http.StatusBadRequest, err.Error())
+			case errors.Is(err, auth_providers.ErrEmailUsed):
+				return ctx.JSON(http.StatusConflict, err.Error())
+			case errors.Is(err, auth_providers.ErrSignUpDisabled):
+				return ctx.JSON(http.StatusForbidden, err.Error())
+			}
+			log.Logger.UserApi.Errorf("local.SignUp: %s", err)
+			return err
+		}
+
+		return ctx.JSON(http.StatusCreated, authTokenResp{Token: token, ExpiresAt: expiresAt})
+	}
+}
+
+// signInHandler returns token of local auth provider
+func (a *userApi) signInHandler(local *auth_providers.Local) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		var req credentialsRequest
+		err := ctx.Bind(&req)
+		if err != nil {
+			return ctx.JSON(http.StatusBadRequest, err.Error())
+		}
+
+		token, expiresAt, err := local.SignIn(strings.TrimSpace(req.Email), req.Password)
+		if err != nil {
+			if errors.Is(err, auth_providers.ErrInvalidCredentials) {
+				return ctx.JSON(http.StatusUnauthorized, err.Error())
+			}
+			log.Logger.UserApi.Errorf("local.SignIn: %s", err)
+			return err
+		}
+
+		return ctx.JSON(http.StatusOK, authTokenResp{Token: token, ExpiresAt: expiresAt})
+	}
+}
+
+// verifyEmailHandler verifies email by token of link and returns new token of local auth provider
+func (a *userApi) verifyEmailHandler(local *auth_providers.Local) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		var req verifyEmailRequest
+		err := ctx.Bind(&req)
+		if err != nil {
+			return ctx.JSON(http.StatusBadRequest, err.Error())
+		}
+
+		token, expiresAt, err := local.VerifyEmail(req.Token)
+		if err != nil {
+			if errors.Is(err, auth_providers.ErrTokenInvalid) || errors.Is(err, auth_providers.ErrTokenExpired) {
+				return ctx.JSON(http.StatusBadRequest, err.Error())
+			}
+			log.Logger.UserApi.Errorf("local.VerifyEmail: %s", err)
+			return err
+		}
+
+		return ctx.JSON(http.StatusOK, authTokenResp{Token: token, ExpiresAt: expiresAt})
+	}
+}
+
+// sendVerificationHandler sends verification link to email of local account again
+func (a *userApi) sendVerificationHandler(local *auth_providers.Local) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		cc := ctx.(*echo2.CustomContext)
+		user := cc.GetUser()
+		if user == nil {
+			log.Logger.UserApi.Errorf("sendVerificationHandler: fail to get user from context")
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+
+		err := local.SendVerification(user.UID)
+		if err != nil {
+			switch {
+			case errors.Is(err, auth_providers.ErrTokenInvalid):
+				// wallet session of another provider user
+				return ctx.JSON(http.StatusBadRequest, err.Error())
+			case errors.Is(err, auth_providers.ErrEmailVerified):
+				return ctx.JSON(http.StatusConflict, err.Error())
+			case errors.Is(err, auth_providers.ErrVerificationSent):
+				return ctx.JSON(http.StatusTooManyRequests, err.Error())
+			case errors.Is(err, auth_providers.ErrVerificationOff):
+				return ctx.JSON(http.StatusServiceUnavailable, err.Error())
+			}
+			log.Logger.UserApi.Errorf("local.SendVerification: %s", err)
+			return err
+		}
+
+		return ctx.NoContent(http.StatusNoContent)
+	}
+}
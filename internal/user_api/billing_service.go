@@ -0,0 +1,187 @@
+package user_api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gocarina/gocsv"
+	"github.com/labstack/echo/v4"
+
+	"extrnode-be/internal/pkg/billing"
+	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/pkg/storage/postgres"
+)
+
+type creditsResp struct {
+	DefaultCredits uint64            `json:"default_credits"`
+	Methods        map[string]uint64 `json:"methods"`
+}
+
+// getCreditsHandler returns credits charged for rpc methods, they are read from the same storage as by proxy
+func (a *userApi) getCreditsHandler(ctx echo.Context) error {
+	meter, err := billing.LoadMeter(a.pgStorage)
+	if err != nil {
+		log.Logger.UserApi.Errorf("billing.LoadMeter: %s", err)
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, creditsResp{
+		DefaultCredits: meter.DefaultCredits(),
+		Methods:        meter.Methods(),
+	})
+}
+
+func (a *userApi) getBillingUsageHandler(ctx echo.Context) error {
+	usage, err := a.userBillingUsage(ctx)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, usage)
+}
+
+func (a *userApi) getInvoiceHandler(ctx echo.Context) error {
+	usage, err := a.userBillingUsage(ctx)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, usage.Invoice())
+}
+
+func (a *userApi) getInvoiceCSVHandler(ctx echo.Context) error {
+	usage, err := a.userBillingUsage(ctx)
+	if err != nil {
+		return err
+	}
+
+	return invoiceCSVResp(ctx, usage.Invoice())
+}
+
+func (a *userApi) getOrganizationBillingUsageHandler(ctx echo.Context) error {
+	usage, err := a.organizationBillingUsage(ctx, postgres.OrgRoleViewer)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, usage)
+}
+
+func (a *userApi) getOrganizationInvoiceHandler(ctx echo.Context) error {
+	usage, err := a.organizationBillingUsage(ctx, postgres.OrgRoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, usage.Invoice())
+}
+
+func (a *userApi) getOrganizationInvoiceCSVHandler(ctx echo.Context) error {
+	usage, err := a.organizationBillingUsage(ctx, postgres.OrgRoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	return invoiceCSVResp(ctx, usage.Invoice())
+}
+
+func (a *userApi) userBillingUsage(ctx echo.Context) (usage billing.Usage, err error) {
+	month, err := a.billingMonth(ctx)
+	if err != nil {
+		return usage, err
+	}
+	u, err := a.getVerifiedUser(ctx)
+	if err != nil {
+		return usage, err
+	}
+
+	return a.billingUsage(postgres.ApiKeyOwner{UserID: u.ID}, month)
+}
+
+func (a *userApi) organizationBillingUsage(ctx echo.Context, minRole string) (usage billing.Usage, err error) {
+	month, err := a.billingMonth(ctx)
+	if err != nil {
+		return usage, err
+	}
+	_, orgID, _, err := a.organizationRequest(ctx, minRole)
+	if err != nil {
+		return usage, err
+	}
+
+	return a.billingUsage(postgres.ApiKeyOwner{OrgID: orgID}, month)
+}
+
+// billingUsage returns monthly usage of all keys of owner, including revoked ones
+func (a *userApi) billingUsage(owner postgres.ApiKeyOwner, month time.Time) (usage billing.Usage, err error) {
+	plan, isFound, err := a.pgStorage.GetPlan(owner)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.GetPlan: %s", err)
+		return usage, err
+	}
+	if !isFound {
+		return usage, echo.NewHTTPError(http.StatusNotFound, ErrNoBillingPlan)
+	}
+
+	keys, err := a.pgStorage.GetApiKeys(owner)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.GetApiKeys: %s", err)
+		return usage, err
+	}
+	apiTokens := make([]string, 0, len(keys))
+	for _, k := range keys {
+		apiTokens = append(apiTokens, k.Token.String())
+	}
+
+	from, to := billing.MonthRange(month)
+	keysUsage, err := a.chStorage.GetKeysUsage(apiTokens, from, to)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.GetKeysUsage: %s", err)
+		return usage, err
+	}
+	byToken := make(map[string]billing.KeyUsage, len(keysUsage))
+	for _, u := range keysUsage {
+		byToken[u.UserUUID] = billing.KeyUsage{TotalReq: u.TotalReq, Credits: u.Credits}
+	}
+
+	// keys are listed in order of creation
+	var res []billing.KeyUsage
+	for _, k := range keys {
+		u, ok := byToken[k.Token.String()]
+		if !ok {
+			continue
+		}
+		u.ApiKeyID, u.ApiKeyName = k.ID, k.Name
+		res = append(res, u)
+	}
+
+	return billing.NewUsage(month, plan, res), nil
+}
+
+// billingMonth returns month from query params if usage analytics is configured. Empty month is the current one
+func (a *userApi) billingMonth(ctx echo.Context) (month time.Time, err error) {
+	if a.chStorage == nil {
+		return month, echo.NewHTTPError(http.StatusServiceUnavailable, ErrUsageNotConfigured)
+	}
+
+	monthParam := ctx.QueryParam("month")
+	if monthParam == "" {
+		now := time.Now().UTC()
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+	}
+	month, err = time.Parse(billing.MonthLayout, monthParam)
+	if err != nil {
+		return month, echo.NewHTTPError(http.StatusBadRequest, "invalid month")
+	}
+
+	return month, nil
+}
+
+// invoiceCSVResp writes line items of invoice as csv file
+func invoiceCSVResp(ctx echo.Context, inv billing.Invoice) error {
+	ctx.Response().Header().Set(echo.HeaderContentType, mimeTextCSV)
+	ctx.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=\"invoice_%s.csv\"", inv.Month))
+	ctx.Response().WriteHeader(http.StatusOK)
+
+	return gocsv.Marshal(inv.Lines, ctx.Response())
+}
@@ -9,6 +9,8 @@ import (
 type Config struct {
 	UApi config_types.UserApiConfig
 	PG   config_types.PostgresConfig
+	// optional, usage analytics is disabled without it
+	CH config_types.ClickhouseConfig
 }
 
 func (c Config) Validate() error {
@@ -18,6 +20,9 @@ func (c Config) Validate() error {
 	if err := c.PG.Validate(); err != nil {
 		return fmt.Errorf("postgres: %s", err)
 	}
+	if err := c.CH.Validate(); err != nil {
+		return fmt.Errorf("clickhouse: %s", err)
+	}
 
 	return nil
 }
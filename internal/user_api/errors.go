@@ -2,4 +2,10 @@ package user_api
 
 var (
 	ErrNeedEmailVerification = "need email verification"
+	ErrUsageNotConfigured    = "usage analytics is not configured"
+	ErrNoActiveApiKeys       = "no active api keys"
+	ErrOrganizationForbidden = "not enough permissions in organization"
+	ErrNoBillingPlan         = "billing plan is not set"
+	ErrAlertsNotConfigured   = "alerts are not configured"
+	ErrOriginWallet          = "wallet used to create account can't be unlinked"
 )
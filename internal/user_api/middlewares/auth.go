@@ -1,27 +1,22 @@
 package middlewares
 
 import (
-	"context"
-	"fmt"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
-	firebase "firebase.google.com/go/v4"
-	"firebase.google.com/go/v4/auth"
 	"github.com/labstack/echo/v4"
 	"github.com/patrickmn/go-cache"
-	"google.golang.org/api/option"
 
-	"extrnode-be/internal/pkg/config_types"
+	"extrnode-be/internal/pkg/auth_providers"
 	"extrnode-be/internal/pkg/log"
 	echo2 "extrnode-be/internal/pkg/util/echo"
 )
 
 type AuthMiddleware struct {
-	ctx          context.Context
-	authProvider *auth.Client
-	cache        *cache.Cache
+	provider auth_providers.Provider
+	cache    *cache.Cache
 }
 
 const (
@@ -40,57 +35,48 @@ var (
 	ErrAuthUnknown      = echo.NewHTTPError(http.StatusUnauthorized, "Auth unknown error")
 )
 
-func NewAuthMiddleware(ctx context.Context, conf config_types.UserApiConfig) (a AuthMiddleware, err error) {
-	opt := option.WithCredentialsFile(conf.FirebaseFilePath)
-	app, err := firebase.NewApp(context.Background(), nil, opt)
-	if err != nil {
-		return a, fmt.Errorf("NewApp: %s", err)
-	}
-
-	authProvider, err := app.Auth(context.Background())
-	if err != nil {
-		return a, fmt.Errorf("Auth: %s", err)
-	}
-
+func NewAuthMiddleware(provider auth_providers.Provider) AuthMiddleware {
 	return AuthMiddleware{
-		ctx:          ctx,
-		authProvider: authProvider,
-		cache:        cache.New(cacheTTL, cacheCleanup),
-	}, nil
+		provider: provider,
+		cache:    cache.New(cacheTTL, cacheCleanup),
+	}
 }
 
-func (a *AuthMiddleware) getTokenInfo(authToken string) (tokenInfo *auth.Token, err error) {
+func (a *AuthMiddleware) getUser(c echo.Context, authToken string) (*auth_providers.User, error) {
 	// try get from cache
-	if cachedToken, ok := a.cache.Get(authToken); ok {
-		if tokenInfo, ok = cachedToken.(*auth.Token); ok {
-			return tokenInfo, nil
+	if cachedUser, ok := a.cache.Get(authToken); ok {
+		if user, ok := cachedUser.(*auth_providers.User); ok {
+			return user, nil
 		}
 	}
 
-	tokenInfo, err = a.authProvider.VerifyIDTokenAndCheckRevoked(a.ctx, authToken)
+	user, expiresAt, err := a.provider.VerifyToken(c.Request().Context(), authToken)
 	if err != nil {
 		switch {
-		case auth.IsIDTokenExpired(err):
-			return tokenInfo, ErrTokenIsExpired
-		case auth.IsIDTokenRevoked(err):
-			return tokenInfo, ErrTokenRevoked
+		case errors.Is(err, auth_providers.ErrTokenExpired):
+			return nil, ErrTokenIsExpired
+		case errors.Is(err, auth_providers.ErrTokenRevoked):
+			return nil, ErrTokenRevoked
+		case errors.Is(err, auth_providers.ErrTokenInvalid):
+			return nil, ErrTokenInvalid
+		case errors.Is(err, auth_providers.ErrUserNotFound):
+			return nil, ErrUserNotFound
 		}
 
-		log.Logger.UserApi.Errorf("getTokenInfo: VerifyIDTokenAndCheckRevoked: %s", err)
-		return tokenInfo, ErrAuthUnknown
-	}
-	if tokenInfo == nil {
-		return tokenInfo, ErrTokenInvalid
+		log.Logger.UserApi.Errorf("getUser: %s.VerifyToken: %s", a.provider.Name(), err)
+		return nil, ErrAuthUnknown
 	}
 
 	// use ttl not greater than tokenCacheDefaultTTL
-	ttl := time.Duration(tokenInfo.Expires-time.Now().Unix()) * time.Second
+	ttl := time.Until(expiresAt)
 	if ttl > tokenCacheDefaultTTL {
 		ttl = tokenCacheDefaultTTL
 	}
-	a.cache.Set(authToken, tokenInfo, ttl)
+	if ttl > 0 {
+		a.cache.Set(authToken, user, ttl)
+	}
 
-	return tokenInfo, nil
+	return user, nil
 }
 
 func (a *AuthMiddleware) getAuthToken(c echo.Context) (res string, err error) {
@@ -111,16 +97,11 @@ func (a *AuthMiddleware) LoadUser(next echo.HandlerFunc) echo.HandlerFunc {
 		if err != nil {
 			return err
 		}
-		tokenInfo, err := a.getTokenInfo(authToken)
+		user, err := a.getUser(c, authToken)
 		if err != nil {
 			return err
 		}
 
-		user, err := a.authProvider.GetUser(a.ctx, tokenInfo.UID)
-		if err != nil {
-			return ErrUserNotFound
-		}
-
 		c.(*echo2.CustomContext).SetUser(user)
 
 		return next(c)
@@ -0,0 +1,448 @@
+package user_api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/pkg/storage/postgres"
+)
+
+const (
+	orgIDParam        = "org_id"
+	memberIDParam     = "user_id"
+	invitationIDParam = "id"
+
+	maxOrganizationNameLen = 64
+	invitationTTL          = 7 * 24 * time.Hour
+)
+
+// members with higher rank have all permissions of lower ones
+var orgRoleRanks = map[string]int{
+	postgres.OrgRoleViewer: 1,
+	postgres.OrgRoleAdmin:  2,
+	postgres.OrgRoleOwner:  3,
+}
+
+type (
+	createOrganizationRequest struct {
+		Name string `json:"name"`
+	}
+	memberRoleRequest struct {
+		Role string `json:"role"`
+	}
+	invitationRequest struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+)
+
+func (a *userApi) getOrganizationsHandler(ctx echo.Context) error {
+	u, err := a.getVerifiedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	orgs, err := a.pgStorage.GetUserOrganizations(u.ID)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.GetUserOrganizations: %s", err)
+		return err
+	}
+	if orgs == nil {
+		orgs = []postgres.Organization{}
+	}
+
+	return ctx.JSON(http.StatusOK, orgs)
+}
+
+func (a *userApi) createOrganizationHandler(ctx echo.Context) error {
+	u, err := a.getVerifiedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	var req createOrganizationRequest
+	err = ctx.Bind(&req)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, err.Error())
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxOrganizationNameLen {
+		return ctx.JSON(http.StatusBadRequest, fmt.Sprintf("name must be 1-%d characters", maxOrganizationNameLen))
+	}
+
+	org, err := a.pgStorage.CreateOrganization(u.ID, req.Name)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.CreateOrganization: %s", err)
+		return err
+	}
+
+	return ctx.JSON(http.StatusCreated, org)
+}
+
+func (a *userApi) getOrganizationMembersHandler(ctx echo.Context) error {
+	_, orgID, _, err := a.organizationRequest(ctx, postgres.OrgRoleViewer)
+	if err != nil {
+		return err
+	}
+
+	members, err := a.pgStorage.GetOrganizationMembers(orgID)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.GetOrganizationMembers: %s", err)
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, members)
+}
+
+// putOrganizationMemberHandler changes role of member. Only owners may change roles of owners and grant owner role
+func (a *userApi) putOrganizationMemberHandler(ctx echo.Context) error {
+	_, orgID, role, err := a.organizationRequest(ctx, postgres.OrgRoleAdmin)
+	if err != nil {
+		return err
+	}
+	memberID, err := parseIDParam(ctx, memberIDParam)
+	if err != nil {
+		return err
+	}
+
+	var req memberRoleRequest
+	err = ctx.Bind(&req)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, err.Error())
+	}
+	if _, ok := orgRoleRanks[req.Role]; !ok {
+		return ctx.JSON(http.StatusBadRequest, fmt.Sprintf("unknown role: %s", req.Role))
+	}
+
+	memberRole, err := a.getMemberRole(orgID, memberID)
+	if err != nil {
+		return err
+	}
+	if role != postgres.OrgRoleOwner && (memberRole == postgres.OrgRoleOwner || req.Role == postgres.OrgRoleOwner) {
+		return echo.NewHTTPError(http.StatusForbidden, ErrOrganizationForbidden)
+	}
+
+	isFound, err := a.pgStorage.UpdateOrganizationMemberRole(orgID, memberID, req.Role)
+	if err != nil {
+		return memberChangeError("storage.UpdateOrganizationMemberRole", err)
+	}
+	if !isFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// deleteOrganizationMemberHandler removes member. Any member may leave, only owners may remove owners
+func (a *userApi) deleteOrganizationMemberHandler(ctx echo.Context) error {
+	u, orgID, role, err := a.organizationRequest(ctx, postgres.OrgRoleViewer)
+	if err != nil {
+		return err
+	}
+	memberID, err := parseIDParam(ctx, memberIDParam)
+	if err != nil {
+		return err
+	}
+
+	if memberID != u.ID {
+		if orgRoleRanks[role] < orgRoleRanks[postgres.OrgRoleAdmin] {
+			return echo.NewHTTPError(http.StatusForbidden, ErrOrganizationForbidden)
+		}
+		memberRole, err := a.getMemberRole(orgID, memberID)
+		if err != nil {
+			return err
+		}
+		if memberRole == postgres.OrgRoleOwner && role != postgres.OrgRoleOwner {
+			return echo.NewHTTPError(http.StatusForbidden, ErrOrganizationForbidden)
+		}
+	}
+
+	isFound, err := a.pgStorage.DeleteOrganizationMember(orgID, memberID)
+	if err != nil {
+		return memberChangeError("storage.DeleteOrganizationMember", err)
+	}
+	if !isFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func (a *userApi) getOrganizationInvitationsHandler(ctx echo.Context) error {
+	_, orgID, _, err := a.organizationRequest(ctx, postgres.OrgRoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	invs, err := a.pgStorage.GetOrganizationInvitations(orgID)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.GetOrganizationInvitations: %s", err)
+		return err
+	}
+	if invs == nil {
+		invs = []postgres.OrganizationInvitation{}
+	}
+
+	return ctx.JSON(http.StatusOK, invs)
+}
+
+// createOrganizationInvitationHandler invites email to organization. Only owners may invite owners
+func (a *userApi) createOrganizationInvitationHandler(ctx echo.Context) error {
+	u, orgID, role, err := a.organizationRequest(ctx, postgres.OrgRoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	var req invitationRequest
+	err = ctx.Bind(&req)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, err.Error())
+	}
+	addr, err := mail.ParseAddress(req.Email)
+	if err != nil || addr.Address != strings.TrimSpace(req.Email) {
+		return ctx.JSON(http.StatusBadRequest, "invalid email")
+	}
+	if _, ok := orgRoleRanks[req.Role]; !ok {
+		return ctx.JSON(http.StatusBadRequest, fmt.Sprintf("unknown role: %s", req.Role))
+	}
+	if req.Role == postgres.OrgRoleOwner && role != postgres.OrgRoleOwner {
+		return echo.NewHTTPError(http.StatusForbidden, ErrOrganizationForbidden)
+	}
+
+	inv, err := a.pgStorage.CreateOrganizationInvitation(orgID, u.ID, addr.Address, req.Role, time.Now().Add(invitationTTL))
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.CreateOrganizationInvitation: %s", err)
+		return err
+	}
+
+	return ctx.JSON(http.StatusCreated, inv)
+}
+
+func (a *userApi) deleteOrganizationInvitationHandler(ctx echo.Context) error {
+	_, orgID, _, err := a.organizationRequest(ctx, postgres.OrgRoleAdmin)
+	if err != nil {
+		return err
+	}
+	invID, err := parseIDParam(ctx, invitationIDParam)
+	if err != nil {
+		return err
+	}
+
+	isFound, err := a.pgStorage.DeleteOrganizationInvitation(orgID, invID)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.DeleteOrganizationInvitation: %s", err)
+		return err
+	}
+	if !isFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// getInvitationsHandler returns invitations sent to verified email of user
+func (a *userApi) getInvitationsHandler(ctx echo.Context) error {
+	u, err := a.getEmailVerifiedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	invs, err := a.pgStorage.GetInvitationsByEmail(u.Email)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.GetInvitationsByEmail: %s", err)
+		return err
+	}
+	if invs == nil {
+		invs = []postgres.OrganizationInvitation{}
+	}
+
+	return ctx.JSON(http.StatusOK, invs)
+}
+
+func (a *userApi) acceptInvitationHandler(ctx echo.Context) error {
+	invID, err := parseIDParam(ctx, invitationIDParam)
+	if err != nil {
+		return err
+	}
+	u, err := a.getEmailVerifiedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	org, isFound, err := a.pgStorage.AcceptOrganizationInvitation(invID, u.ID, u.Email)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.AcceptOrganizationInvitation: %s", err)
+		return err
+	}
+	if !isFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	return ctx.JSON(http.StatusOK, org)
+}
+
+func (a *userApi) getOrganizationApiKeysHandler(ctx echo.Context) error {
+	_, orgID, role, err := a.organizationRequest(ctx, postgres.OrgRoleViewer)
+	if err != nil {
+		return err
+	}
+
+	keys, err := a.getApiKeys(postgres.ApiKeyOwner{OrgID: orgID})
+	if err != nil {
+		return err
+	}
+	if orgRoleRanks[role] >= orgRoleRanks[postgres.OrgRoleAdmin] {
+		return ctx.JSON(http.StatusOK, keys)
+	}
+
+	// members which can't manage keys see their usage, but not tokens
+	masked := make([]maskedApiKey, 0, len(keys))
+	for _, k := range keys {
+		masked = append(masked, newMaskedApiKey(k))
+	}
+
+	return ctx.JSON(http.StatusOK, masked)
+}
+
+func (a *userApi) createOrganizationApiKeyHandler(ctx echo.Context) error {
+	_, orgID, _, err := a.organizationRequest(ctx, postgres.OrgRoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	key, err := a.createApiKey(ctx, postgres.ApiKeyOwner{OrgID: orgID})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusCreated, key)
+}
+
+func (a *userApi) rotateOrganizationApiKeyHandler(ctx echo.Context) error {
+	_, orgID, _, err := a.organizationRequest(ctx, postgres.OrgRoleAdmin)
+	if err != nil {
+		return err
+	}
+	keyID, err := parseIDParam(ctx, apiKeyIDParam)
+	if err != nil {
+		return err
+	}
+
+	key, err := a.rotateApiKey(postgres.ApiKeyOwner{OrgID: orgID}, keyID)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, key)
+}
+
+func (a *userApi) revokeOrganizationApiKeyHandler(ctx echo.Context) error {
+	_, orgID, _, err := a.organizationRequest(ctx, postgres.OrgRoleAdmin)
+	if err != nil {
+		return err
+	}
+	keyID, err := parseIDParam(ctx, apiKeyIDParam)
+	if err != nil {
+		return err
+	}
+
+	err = a.revokeApiKey(postgres.ApiKeyOwner{OrgID: orgID}, keyID)
+	if err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func (a *userApi) getOrganizationUsageHandler(ctx echo.Context) error {
+	apiTokens, from, to, err := a.organizationUsageRequest(ctx)
+	if err != nil {
+		return err
+	}
+
+	return a.usageResp(ctx, apiTokens, from, to)
+}
+
+func (a *userApi) getOrganizationUsageCSVHandler(ctx echo.Context) error {
+	apiTokens, from, to, err := a.organizationUsageRequest(ctx)
+	if err != nil {
+		return err
+	}
+
+	return a.usageCSVResp(ctx, apiTokens, from, to)
+}
+
+// organizationUsageRequest returns api tokens of organization and dates range from query params
+func (a *userApi) organizationUsageRequest(ctx echo.Context) (apiTokens []string, from, to time.Time, err error) {
+	from, to, err = a.usageRange(ctx)
+	if err != nil {
+		return nil, from, to, err
+	}
+
+	_, orgID, _, err := a.organizationRequest(ctx, postgres.OrgRoleViewer)
+	if err != nil {
+		return nil, from, to, err
+	}
+
+	apiTokens, err = a.usageApiTokens(postgres.ApiKeyOwner{OrgID: orgID})
+
+	return apiTokens, from, to, err
+}
+
+// organizationRequest returns verified user, organization id from path and role of user in it.
+// Organization is not found for non-members, so its existence is not disclosed
+func (a *userApi) organizationRequest(ctx echo.Context, minRole string) (u postgres.User, orgID int64, role string, err error) {
+	orgID, err = parseIDParam(ctx, orgIDParam)
+	if err != nil {
+		return u, 0, "", err
+	}
+
+	u, err = a.getVerifiedUser(ctx)
+	if err != nil {
+		return u, 0, "", err
+	}
+
+	role, isFound, err := a.pgStorage.GetOrganizationRole(orgID, u.ID)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.GetOrganizationRole: %s", err)
+		return u, 0, "", err
+	}
+	if !isFound {
+		return u, 0, "", echo.NewHTTPError(http.StatusNotFound)
+	}
+	if orgRoleRanks[role] < orgRoleRanks[minRole] {
+		return u, 0, "", echo.NewHTTPError(http.StatusForbidden, ErrOrganizationForbidden)
+	}
+
+	return u, orgID, role, nil
+}
+
+// getMemberRole returns role of organization member or not found error
+func (a *userApi) getMemberRole(orgID, userID int64) (string, error) {
+	role, isFound, err := a.pgStorage.GetOrganizationRole(orgID, userID)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.GetOrganizationRole: %s", err)
+		return "", err
+	}
+	if !isFound {
+		return "", echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	return role, nil
+}
+
+func memberChangeError(caller string, err error) error {
+	if errors.Is(err, postgres.ErrLastOrganizationOwner) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	log.Logger.UserApi.Errorf("%s: %s", caller, err)
+
+	return err
+}
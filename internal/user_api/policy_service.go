@@ -0,0 +1,337 @@
+package user_api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/labstack/echo/v4"
+
+	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/pkg/storage/postgres"
+	echo2 "extrnode-be/internal/pkg/util/echo"
+	solana2 "extrnode-be/internal/pkg/util/solana"
+)
+
+// query param selecting api key of policy, default policy of owner is used without it
+const policyKeyIDParam = "key_id"
+
+// getPolicyHandler returns policy of key_id param or default policy of user keys. Key without own policy gets the default one
+func (a *userApi) getPolicyHandler(ctx echo.Context) error {
+	u, err := a.getVerifiedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	return a.getOwnerPolicy(ctx, postgres.ApiKeyOwner{UserID: u.ID})
+}
+
+// putPolicyHandler replaces policy of key_id param or default policy of user keys
+func (a *userApi) putPolicyHandler(ctx echo.Context) error {
+	u, err := a.getVerifiedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	return a.putOwnerPolicy(ctx, postgres.ApiKeyOwner{UserID: u.ID})
+}
+
+// deletePolicyHandler deletes own policy of key_id param, so the key gets default policy of user
+func (a *userApi) deletePolicyHandler(ctx echo.Context) error {
+	u, err := a.getVerifiedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	return a.deleteOwnerKeyPolicy(ctx, postgres.ApiKeyOwner{UserID: u.ID})
+}
+
+// getOrganizationPolicyHandler returns policy of key_id param or default policy of organization keys
+func (a *userApi) getOrganizationPolicyHandler(ctx echo.Context) error {
+	_, orgID, _, err := a.organizationRequest(ctx, postgres.OrgRoleViewer)
+	if err != nil {
+		return err
+	}
+
+	return a.getOwnerPolicy(ctx, postgres.ApiKeyOwner{OrgID: orgID})
+}
+
+// putOrganizationPolicyHandler replaces policy of key_id param or default policy of organization keys
+func (a *userApi) putOrganizationPolicyHandler(ctx echo.Context) error {
+	_, orgID, _, err := a.organizationRequest(ctx, postgres.OrgRoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	return a.putOwnerPolicy(ctx, postgres.ApiKeyOwner{OrgID: orgID})
+}
+
+// deleteOrganizationPolicyHandler deletes own policy of key_id param, so the key gets default policy of organization
+func (a *userApi) deleteOrganizationPolicyHandler(ctx echo.Context) error {
+	_, orgID, _, err := a.organizationRequest(ctx, postgres.OrgRoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	return a.deleteOwnerKeyPolicy(ctx, postgres.ApiKeyOwner{OrgID: orgID})
+}
+
+func (a *userApi) getOwnerPolicy(ctx echo.Context, owner postgres.ApiKeyOwner) error {
+	keyID, err := a.policyKeyID(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	if keyID != 0 {
+		policy, isFound, err := a.pgStorage.GetPolicyByKeyID(keyID)
+		if err != nil {
+			log.Logger.UserApi.Errorf("storage.GetPolicyByKeyID: %s", err)
+			return err
+		}
+		if isFound {
+			return ctx.JSON(http.StatusOK, policy)
+		}
+	}
+
+	policy, err := a.pgStorage.GetPolicyByOwner(owner)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.GetPolicyByOwner: %s", err)
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, policy)
+}
+
+func (a *userApi) putOwnerPolicy(ctx echo.Context, owner postgres.ApiKeyOwner) error {
+	keyID, err := a.policyKeyID(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	var policy postgres.Policy
+	err = ctx.Bind(&policy)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, err.Error())
+	}
+	err = validatePolicy(policy)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	// owner is taken from request params only
+	policy.UserID, policy.OrgID, policy.KeyID = 0, 0, keyID
+	if keyID == 0 {
+		policy.UserID, policy.OrgID = owner.UserID, owner.OrgID
+	}
+	err = a.pgStorage.UpsertPolicy(policy)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.UpsertPolicy: %s", err)
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, policy)
+}
+
+func (a *userApi) deleteOwnerKeyPolicy(ctx echo.Context, owner postgres.ApiKeyOwner) error {
+	keyID, err := a.policyKeyID(ctx, owner)
+	if err != nil {
+		return err
+	}
+	if keyID == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "key_id is required")
+	}
+
+	isFound, err := a.pgStorage.DeleteKeyPolicy(keyID)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.DeleteKeyPolicy: %s", err)
+		return err
+	}
+	if !isFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// policyKeyID returns key_id query param, the key must belong to owner. Zero is returned without param
+func (a *userApi) policyKeyID(ctx echo.Context, owner postgres.ApiKeyOwner) (int64, error) {
+	param := ctx.QueryParam(policyKeyIDParam)
+	if param == "" {
+		return 0, nil
+	}
+	keyID, err := strconv.ParseInt(param, 10, 64)
+	if err != nil || keyID <= 0 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid %s", policyKeyIDParam))
+	}
+
+	_, isFound, err := a.pgStorage.GetApiKey(owner, keyID)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.GetApiKey: %s", err)
+		return 0, err
+	}
+	if !isFound {
+		return 0, echo.NewHTTPError(http.StatusNotFound, "api key is not found")
+	}
+
+	return keyID, nil
+}
+
+// getVerifiedUser returns db user for authenticated user from context
+func (a *userApi) getVerifiedUser(ctx echo.Context) (u postgres.User, err error) {
+	cc := ctx.(*echo2.CustomContext)
+	user := cc.GetUser()
+	if user == nil {
+		log.Logger.UserApi.Errorf("getVerifiedUser: fail to get user from context")
+		return u, echo.NewHTTPError(http.StatusInternalServerError)
+	}
+
+	if !user.EmailVerified && !user.IdentityVerified {
+		return u, echo.NewHTTPError(http.StatusBadRequest, ErrNeedEmailVerification)
+	}
+
+	u, err = a.pgStorage.GetOrCreateUser(user.UID, user.Email)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.GetOrCreateUser: %s", err)
+		return u, err
+	}
+
+	return u, nil
+}
+
+// getEmailVerifiedUser returns user whose email is verified by auth provider, e.g. to match invitations by email
+func (a *userApi) getEmailVerifiedUser(ctx echo.Context) (u postgres.User, err error) {
+	u, err = a.getVerifiedUser(ctx)
+	if err != nil {
+		return u, err
+	}
+	if !ctx.(*echo2.CustomContext).GetUser().EmailVerified {
+		return u, echo.NewHTTPError(http.StatusBadRequest, ErrNeedEmailVerification)
+	}
+
+	return u, nil
+}
+
+func validatePolicy(policy postgres.Policy) error {
+	for _, m := range append(policy.AllowedMethods, policy.DeniedMethods...) {
+		if _, ok := solana2.FullMethodList[m]; !ok {
+			return fmt.Errorf("unknown method: %s", m)
+		}
+	}
+	for _, id := range policy.AllowedProgramIDs {
+		_, err := solana.PublicKeyFromBase58(id)
+		if err != nil {
+			return fmt.Errorf("invalid program id: %s", id)
+		}
+	}
+	for _, e := range policy.DeniedEncodings {
+		if _, ok := solana2.EncodingList[e]; !ok {
+			return fmt.Errorf("unknown encoding: %s", e)
+		}
+	}
+
+	return nil
+}
+
+func (a *userApi) getAllowedOriginsHandler(ctx echo.Context) error {
+	u, err := a.getVerifiedUser(ctx)
+	if err != nil {
+		return err
+	}
+	if u.AllowedOrigins == nil {
+		u.AllowedOrigins = []string{}
+	}
+
+	return ctx.JSON(http.StatusOK, u.AllowedOrigins)
+}
+
+func (a *userApi) putAllowedOriginsHandler(ctx echo.Context) error {
+	u, err := a.getVerifiedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	var origins []string
+	err = ctx.Bind(&origins)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, err.Error())
+	}
+	err = validateAllowedOrigins(origins)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	err = a.pgStorage.UpdateUserAllowedOrigins(u.ID, origins)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.UpdateUserAllowedOrigins: %s", err)
+		return err
+	}
+	if origins == nil {
+		origins = []string{}
+	}
+
+	return ctx.JSON(http.StatusOK, origins)
+}
+
+func (a *userApi) getOrganizationAllowedOriginsHandler(ctx echo.Context) error {
+	_, orgID, _, err := a.organizationRequest(ctx, postgres.OrgRoleViewer)
+	if err != nil {
+		return err
+	}
+
+	origins, err := a.pgStorage.GetOrganizationAllowedOrigins(orgID)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.GetOrganizationAllowedOrigins: %s", err)
+		return err
+	}
+	if origins == nil {
+		origins = []string{}
+	}
+
+	return ctx.JSON(http.StatusOK, origins)
+}
+
+// putOrganizationAllowedOriginsHandler sets origins of organization keys, browsers can't use them with empty list
+func (a *userApi) putOrganizationAllowedOriginsHandler(ctx echo.Context) error {
+	_, orgID, _, err := a.organizationRequest(ctx, postgres.OrgRoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	var origins []string
+	err = ctx.Bind(&origins)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, err.Error())
+	}
+	err = validateAllowedOrigins(origins)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	err = a.pgStorage.UpdateOrganizationAllowedOrigins(orgID, origins)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.UpdateOrganizationAllowedOrigins: %s", err)
+		return err
+	}
+	if origins == nil {
+		origins = []string{}
+	}
+
+	return ctx.JSON(http.StatusOK, origins)
+}
+
+// origin must contain scheme and host, wildcards are allowed: https://*.example.com
+func validateAllowedOrigins(origins []string) error {
+	for _, o := range origins {
+		if o == "*" {
+			continue
+		}
+		scheme, host, found := strings.Cut(o, "://")
+		if !found || scheme == "" || host == "" || strings.ContainsAny(host, "/ ") {
+			return fmt.Errorf("invalid origin: %s", o)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,269 @@
+package user_api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gocarina/gocsv"
+	"github.com/labstack/echo/v4"
+
+	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/pkg/storage/clickhouse"
+	"extrnode-be/internal/pkg/storage/postgres"
+)
+
+const (
+	dateLayout = "2006-01-02"
+	// default range is the last days including today
+	defaultUsageRangeDays = 30
+	maxUsageRangeDays     = 366
+
+	mimeTextCSV = "text/csv"
+)
+
+type (
+	usageCounters struct {
+		TotalReq   uint64 `json:"total_req"`
+		SuccessReq uint64 `json:"success_req"`
+		HttpErr    uint64 `json:"http_err"`
+		RpcErr     uint64 `json:"rpc_err"`
+		Credits    uint64 `json:"credits"`
+		// share of requests which are not successful
+		ErrorRate float64 `json:"error_rate"`
+	}
+	latency struct {
+		P50 float64 `json:"p50"`
+		P90 float64 `json:"p90"`
+		P99 float64 `json:"p99"`
+	}
+	methodUsage struct {
+		RpcMethod string `json:"rpc_method"`
+		usageCounters
+		// nil if raw stats of the range are expired
+		Latency *latency `json:"latency"`
+	}
+	dayUsage struct {
+		Day string `json:"day"`
+		usageCounters
+	}
+	usageResp struct {
+		From    string        `json:"from"`
+		To      string        `json:"to"`
+		Total   usageCounters `json:"total"`
+		Latency *latency      `json:"latency"`
+		Methods []methodUsage `json:"methods"`
+		Days    []dayUsage    `json:"days"`
+	}
+	usageCSVRow struct {
+		Day        string  `csv:"day"`
+		RpcMethod  string  `csv:"rpc_method"`
+		TotalReq   uint64  `csv:"total_req"`
+		SuccessReq uint64  `csv:"success_req"`
+		HttpErr    uint64  `csv:"http_err"`
+		RpcErr     uint64  `csv:"rpc_err"`
+		Credits    uint64  `csv:"credits"`
+		ErrorRate  float64 `csv:"error_rate"`
+	}
+)
+
+func (a *userApi) getUsageHandler(ctx echo.Context) error {
+	apiTokens, from, to, err := a.usageRequest(ctx)
+	if err != nil {
+		return err
+	}
+
+	return a.usageResp(ctx, apiTokens, from, to)
+}
+
+// getUsageCSVHandler exports usage by days and methods
+func (a *userApi) getUsageCSVHandler(ctx echo.Context) error {
+	apiTokens, from, to, err := a.usageRequest(ctx)
+	if err != nil {
+		return err
+	}
+
+	return a.usageCSVResp(ctx, apiTokens, from, to)
+}
+
+// usageResp writes usage of api tokens
+func (a *userApi) usageResp(ctx echo.Context, apiTokens []string, from, to time.Time) error {
+	usage, err := a.chStorage.GetUserUsage(apiTokens, from, to)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.GetUserUsage: %s", err)
+		return err
+	}
+	total, methodsLatency, err := a.chStorage.GetUserLatency(apiTokens, from, to)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.GetUserLatency: %s", err)
+		return err
+	}
+
+	res := usageResp{
+		From:    from.Format(dateLayout),
+		To:      to.Format(dateLayout),
+		Methods: []methodUsage{},
+		Days:    []dayUsage{},
+	}
+	if total != nil {
+		res.Latency = &latency{P50: total.P50, P90: total.P90, P99: total.P99}
+	}
+
+	// indexes of methods and days in response
+	methods := make(map[string]int)
+	days := make(map[string]int)
+	for _, u := range usage {
+		res.Total.add(u)
+
+		i, ok := methods[u.RpcMethod]
+		if !ok {
+			i = len(res.Methods)
+			methods[u.RpcMethod] = i
+			res.Methods = append(res.Methods, methodUsage{RpcMethod: u.RpcMethod})
+		}
+		res.Methods[i].add(u)
+
+		day := u.Day.Format(dateLayout)
+		i, ok = days[day]
+		if !ok {
+			i = len(res.Days)
+			days[day] = i
+			res.Days = append(res.Days, dayUsage{Day: day})
+		}
+		res.Days[i].add(u)
+	}
+	for i := range res.Methods {
+		res.Methods[i].setErrorRate()
+	}
+	for _, l := range methodsLatency {
+		if i, ok := methods[l.RpcMethod]; ok {
+			res.Methods[i].Latency = &latency{P50: l.P50, P90: l.P90, P99: l.P99}
+		}
+	}
+	for i := range res.Days {
+		res.Days[i].setErrorRate()
+	}
+	res.Total.setErrorRate()
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// usageCSVResp writes usage of api tokens by days and methods as csv file
+func (a *userApi) usageCSVResp(ctx echo.Context, apiTokens []string, from, to time.Time) error {
+	usage, err := a.chStorage.GetUserUsage(apiTokens, from, to)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.GetUserUsage: %s", err)
+		return err
+	}
+
+	rows := make([]usageCSVRow, 0, len(usage))
+	for _, u := range usage {
+		var c usageCounters
+		c.add(u)
+		c.setErrorRate()
+		rows = append(rows, usageCSVRow{
+			Day:        u.Day.Format(dateLayout),
+			RpcMethod:  u.RpcMethod,
+			TotalReq:   c.TotalReq,
+			SuccessReq: c.SuccessReq,
+			HttpErr:    c.HttpErr,
+			RpcErr:     c.RpcErr,
+			Credits:    c.Credits,
+			ErrorRate:  c.ErrorRate,
+		})
+	}
+
+	ctx.Response().Header().Set(echo.HeaderContentType, mimeTextCSV)
+	ctx.Response().Header().Set(echo.HeaderContentDisposition,
+		fmt.Sprintf("attachment; filename=\"usage_%s_%s.csv\"", from.Format(dateLayout), to.Format(dateLayout)))
+	ctx.Response().WriteHeader(http.StatusOK)
+
+	return gocsv.Marshal(rows, ctx.Response())
+}
+
+// usageRequest returns api tokens of verified user and dates range from query params
+func (a *userApi) usageRequest(ctx echo.Context) (apiTokens []string, from, to time.Time, err error) {
+	from, to, err = a.usageRange(ctx)
+	if err != nil {
+		return nil, from, to, err
+	}
+
+	u, err := a.getVerifiedUser(ctx)
+	if err != nil {
+		return nil, from, to, err
+	}
+
+	apiTokens, err = a.usageApiTokens(postgres.ApiKeyOwner{UserID: u.ID})
+
+	return apiTokens, from, to, err
+}
+
+// usageRange returns dates range from query params if usage analytics is configured
+func (a *userApi) usageRange(ctx echo.Context) (from, to time.Time, err error) {
+	if a.chStorage == nil {
+		return from, to, echo.NewHTTPError(http.StatusServiceUnavailable, ErrUsageNotConfigured)
+	}
+
+	from, to, err = parseUsageRange(ctx.QueryParam("from"), ctx.QueryParam("to"))
+	if err != nil {
+		return from, to, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return from, to, nil
+}
+
+// usageApiTokens returns tokens of all keys of owner. Usage of revoked keys is included, because it's still usage of the owner
+func (a *userApi) usageApiTokens(owner postgres.ApiKeyOwner) (apiTokens []string, err error) {
+	keys, err := a.pgStorage.GetApiKeys(owner)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.GetApiKeys: %s", err)
+		return nil, err
+	}
+	for _, k := range keys {
+		apiTokens = append(apiTokens, k.Token.String())
+	}
+
+	return apiTokens, nil
+}
+
+// parseUsageRange parses inclusive range of dates. Empty to is today, empty from is the default range before to
+func parseUsageRange(fromParam, toParam string) (from, to time.Time, err error) {
+	to = time.Now().UTC().Truncate(24 * time.Hour)
+	if toParam != "" {
+		to, err = time.Parse(dateLayout, toParam)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid to")
+		}
+	}
+	from = to.AddDate(0, 0, -(defaultUsageRangeDays - 1))
+	if fromParam != "" {
+		from, err = time.Parse(dateLayout, fromParam)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from")
+		}
+	}
+
+	if from.After(to) {
+		return from, to, fmt.Errorf("from is after to")
+	}
+	if to.Sub(from) >= maxUsageRangeDays*24*time.Hour {
+		return from, to, fmt.Errorf("range is longer than %d days", maxUsageRangeDays)
+	}
+
+	return from, to, nil
+}
+
+func (c *usageCounters) add(u clickhouse.UserUsage) {
+	c.TotalReq += u.TotalReq
+	c.SuccessReq += u.SuccessReq
+	c.HttpErr += u.HttpErr
+	c.RpcErr += u.RpcErr
+	c.Credits += u.Credits
+}
+
+func (c *usageCounters) setErrorRate() {
+	if c.TotalReq == 0 {
+		return
+	}
+	c.ErrorRate = float64(c.TotalReq-c.SuccessReq) / float64(c.TotalReq)
+}
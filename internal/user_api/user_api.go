@@ -9,13 +9,16 @@ import (
 	"sync"
 	"time"
 
-	"github.com/gagliardetto/solana-go"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/patrickmn/go-cache"
 
+	"extrnode-be/internal/pkg/alerts"
+	"extrnode-be/internal/pkg/auth_providers"
 	"extrnode-be/internal/pkg/config_types"
+	"extrnode-be/internal/pkg/health"
 	"extrnode-be/internal/pkg/log"
+	"extrnode-be/internal/pkg/storage/clickhouse"
 	"extrnode-be/internal/pkg/storage/postgres"
 	echo2 "extrnode-be/internal/pkg/util/echo"
 	"extrnode-be/internal/user_api/config"
@@ -28,16 +31,22 @@ import (
 var swaggerDist embed.FS
 
 type userApi struct {
-	conf      config_types.UserApiConfig
-	certData  []byte
-	router    *echo.Echo
-	pgStorage postgres.Storage
+	conf         config_types.UserApiConfig
+	authProvider auth_providers.Provider
+	certData     []byte
+	router       *echo.Echo
+	pgStorage    postgres.Storage
+	// nil if clickhouse is not configured
+	chStorage *clickhouse.Storage
 	cache     *cache.Cache
 	waitGroup *sync.WaitGroup
 	ctx       context.Context
 	ctxCancel context.CancelFunc
-
-	apiPrivateKey solana.PrivateKey
+	health    *health.Health
+	// nil if api private key is not configured
+	wallet *auth_providers.Wallet
+	// nil if clickhouse is not configured or alerts are disabled
+	alerts *alerts.Service
 }
 
 const (
@@ -55,23 +64,54 @@ func NewAPI(cfg config.Config) (*userApi, error) {
 	if err != nil {
 		return nil, fmt.Errorf("PG storage init: %s", err)
 	}
+	chStorage, err := clickhouse.New(cfg.CH)
+	if err != nil {
+		return nil, fmt.Errorf("CH storage init: %s", err)
+	}
 
-	// TODO: get from config
-	privKey, err := solana.NewRandomPrivateKey()
+	authProvider, err := auth_providers.New(ctx, cfg.UApi, pgStorage)
 	if err != nil {
-		return nil, fmt.Errorf("NewRandomPrivateKey: %s", err)
+		return nil, fmt.Errorf("auth provider init: %s", err)
+	}
+
+	// sessions signed by api private key are verified before tokens of the configured provider
+	var wallet *auth_providers.Wallet
+	if cfg.UApi.ApiPrivateKey != "" {
+		wallet, err = auth_providers.NewWallet(pgStorage, cfg.UApi.ApiPrivateKey, cfg.UApi.SessionTTL)
+		if err != nil {
+			return nil, fmt.Errorf("wallet auth init: %s", err)
+		}
+		authProvider = auth_providers.Chain{wallet, authProvider}
 	}
 
 	a := &userApi{
-		conf:      cfg.UApi,
-		router:    echo.New(),
-		pgStorage: pgStorage,
-		cache:     cache.New(cacheTTL, cacheTTL),
+		conf:         cfg.UApi,
+		authProvider: authProvider,
+		router:       echo.New(),
+		pgStorage:    pgStorage,
+		chStorage:    chStorage,
+		cache:        cache.New(cacheTTL, cacheTTL),
 
-		waitGroup:     &sync.WaitGroup{},
-		ctx:           ctx,
-		ctxCancel:     cancelFunc,
-		apiPrivateKey: privKey,
+		waitGroup: &sync.WaitGroup{},
+		ctx:       ctx,
+		ctxCancel: cancelFunc,
+		health:    health.New(),
+		wallet:    wallet,
+	}
+
+	err = pgStorage.ListenRevokedApiKeys(ctx, a.dropCachedApiToken)
+	if err != nil {
+		// revoked tokens are still returned until cache ttl
+		log.Logger.UserApi.Errorf("ListenRevokedApiKeys: %s", err)
+	}
+
+	if chStorage != nil && cfg.UApi.AlertsInterval > 0 {
+		a.alerts = alerts.New(ctx, pgStorage, chStorage, cfg.UApi)
+		a.waitGroup.Add(1)
+		go func() {
+			defer a.waitGroup.Done()
+			<-a.alerts.Done()
+		}()
 	}
 
 	if cfg.UApi.CertFile != "" {
@@ -92,7 +132,7 @@ func (a *userApi) initApiHandlers() error {
 	echo2.InitHandlersStart(a.router)
 
 	a.router.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"*"},
+		AllowOrigins: a.conf.CorsAllowOrigins,
 		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
 	}))
 
@@ -100,16 +140,105 @@ func (a *userApi) initApiHandlers() error {
 	a.router.StaticFS("/swagger", echo.MustSubFS(swaggerDist, "swaggerui"))
 
 	// protected
-	aMw, err := middlewares.NewAuthMiddleware(a.ctx, a.conf)
-	if err != nil {
-		return fmt.Errorf("NewAuthMiddleware: %s", err)
+	aMw := middlewares.NewAuthMiddleware(a.authProvider)
+
+	// health
+	a.health.AddCheck("postgres", true, func(ctx context.Context) (interface{}, error) {
+		return nil, a.pgStorage.Ping(ctx)
+	})
+	if a.chStorage != nil {
+		// only usage analytics depends on clickhouse
+		a.health.AddCheck("clickhouse", false, func(ctx context.Context) (interface{}, error) {
+			return nil, a.chStorage.Ping(ctx)
+		})
+	}
+	a.health.AddCheck("auth", true, func(ctx context.Context) (interface{}, error) {
+		return map[string]string{"provider": a.authProvider.Name()}, a.authProvider.Ping(ctx)
+	})
+	a.health.Register(a.router)
+
+	local, isLocal := baseAuthProvider(a.authProvider).(*auth_providers.Local)
+	if isLocal {
+		a.router.POST("/auth/sign_up", a.signUpHandler(local))
+		a.router.POST("/auth/sign_in", a.signInHandler(local))
+		a.router.POST("/auth/verify_email", a.verifyEmailHandler(local))
 	}
+	a.router.GET("/billing/credits", a.getCreditsHandler)
+	if a.wallet != nil {
+		a.router.POST("/auth/wallet/nonce", a.walletSignInNonceHandler)
+		a.router.POST("/auth/wallet/sign_in", a.walletSignInHandler)
+	}
+
 	protectedGroup := a.router.Group("", aMw.LoadUser)
+	if isLocal {
+		protectedGroup.POST("/auth/verify_email/send", a.sendVerificationHandler(local))
+	}
 	protectedGroup.GET("/api_token", a.apiTokenHandler)
+	protectedGroup.GET("/api_keys", a.getApiKeysHandler)
+	protectedGroup.POST("/api_keys", a.createApiKeyHandler)
+	protectedGroup.POST(fmt.Sprintf("/api_keys/:%s/rotate", apiKeyIDParam), a.rotateApiKeyHandler)
+	protectedGroup.DELETE(fmt.Sprintf("/api_keys/:%s", apiKeyIDParam), a.revokeApiKeyHandler)
+	protectedGroup.GET("/policy", a.getPolicyHandler)
+	protectedGroup.PUT("/policy", a.putPolicyHandler)
+	protectedGroup.DELETE("/policy", a.deletePolicyHandler)
+	protectedGroup.GET("/allowed_origins", a.getAllowedOriginsHandler)
+	protectedGroup.PUT("/allowed_origins", a.putAllowedOriginsHandler)
+	protectedGroup.GET("/usage", a.getUsageHandler)
+	protectedGroup.GET("/usage/csv", a.getUsageCSVHandler)
+	protectedGroup.GET("/billing/usage", a.getBillingUsageHandler)
+	protectedGroup.GET("/billing/invoice", a.getInvoiceHandler)
+	protectedGroup.GET("/billing/invoice/csv", a.getInvoiceCSVHandler)
+
+	protectedGroup.GET("/organizations", a.getOrganizationsHandler)
+	protectedGroup.POST("/organizations", a.createOrganizationHandler)
+	orgGroup := protectedGroup.Group(fmt.Sprintf("/organizations/:%s", orgIDParam))
+	orgGroup.GET("/members", a.getOrganizationMembersHandler)
+	orgGroup.PUT(fmt.Sprintf("/members/:%s", memberIDParam), a.putOrganizationMemberHandler)
+	orgGroup.DELETE(fmt.Sprintf("/members/:%s", memberIDParam), a.deleteOrganizationMemberHandler)
+	orgGroup.GET("/invitations", a.getOrganizationInvitationsHandler)
+	orgGroup.POST("/invitations", a.createOrganizationInvitationHandler)
+	orgGroup.DELETE(fmt.Sprintf("/invitations/:%s", invitationIDParam), a.deleteOrganizationInvitationHandler)
+	orgGroup.GET("/api_keys", a.getOrganizationApiKeysHandler)
+	orgGroup.POST("/api_keys", a.createOrganizationApiKeyHandler)
+	orgGroup.POST(fmt.Sprintf("/api_keys/:%s/rotate", apiKeyIDParam), a.rotateOrganizationApiKeyHandler)
+	orgGroup.DELETE(fmt.Sprintf("/api_keys/:%s", apiKeyIDParam), a.revokeOrganizationApiKeyHandler)
+	orgGroup.GET("/policy", a.getOrganizationPolicyHandler)
+	orgGroup.PUT("/policy", a.putOrganizationPolicyHandler)
+	orgGroup.DELETE("/policy", a.deleteOrganizationPolicyHandler)
+	orgGroup.GET("/allowed_origins", a.getOrganizationAllowedOriginsHandler)
+	orgGroup.PUT("/allowed_origins", a.putOrganizationAllowedOriginsHandler)
+	orgGroup.GET("/usage", a.getOrganizationUsageHandler)
+	orgGroup.GET("/usage/csv", a.getOrganizationUsageCSVHandler)
+	orgGroup.GET("/billing/usage", a.getOrganizationBillingUsageHandler)
+	orgGroup.GET("/billing/invoice", a.getOrganizationInvoiceHandler)
+	orgGroup.GET("/billing/invoice/csv", a.getOrganizationInvoiceCSVHandler)
+	if a.wallet != nil {
+		protectedGroup.GET("/wallets", a.getWalletsHandler)
+		protectedGroup.POST("/wallets/nonce", a.walletLinkNonceHandler)
+		protectedGroup.POST("/wallets", a.linkWalletHandler)
+		protectedGroup.DELETE(fmt.Sprintf("/wallets/:%s", walletPubkeyParam), a.unlinkWalletHandler)
+	}
+	protectedGroup.GET("/alerts", a.getAlertRulesHandler)
+	protectedGroup.POST("/alerts", a.createAlertRuleHandler)
+	protectedGroup.PUT(fmt.Sprintf("/alerts/:%s", alertRuleIDParam), a.putAlertRuleHandler)
+	protectedGroup.DELETE(fmt.Sprintf("/alerts/:%s", alertRuleIDParam), a.deleteAlertRuleHandler)
+	protectedGroup.GET(fmt.Sprintf("/alerts/:%s/deliveries", alertRuleIDParam), a.getAlertDeliveriesHandler)
+	protectedGroup.POST(fmt.Sprintf("/alerts/:%s/test", alertRuleIDParam), a.testAlertRuleHandler)
+	protectedGroup.GET("/invitations", a.getInvitationsHandler)
+	protectedGroup.POST(fmt.Sprintf("/invitations/:%s/accept", invitationIDParam), a.acceptInvitationHandler)
 
 	return nil
 }
 
+// baseAuthProvider returns configured provider which may be chained after wallet sessions
+func baseAuthProvider(p auth_providers.Provider) auth_providers.Provider {
+	if c, ok := p.(auth_providers.Chain); ok && len(c) != 0 {
+		return c[len(c)-1]
+	}
+
+	return p
+}
+
 func (a *userApi) Run() (err error) {
 	addr := fmt.Sprintf(":%d", a.conf.Port)
 	if len(a.certData) != 0 {
@@ -125,6 +254,7 @@ func (a *userApi) Run() (err error) {
 }
 
 func (a *userApi) Stop() error {
+	a.health.SetDraining()
 	ctx, cancel := context.WithTimeout(a.ctx, serverShutdownTimeout)
 	defer cancel()
 
@@ -21,7 +21,7 @@ func (a *userApi) apiTokenHandler(ctx echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError)
 	}
 
-	if !user.EmailVerified {
+	if !user.EmailVerified && !user.IdentityVerified {
 		return ctx.JSON(http.StatusBadRequest, ErrNeedEmailVerification)
 	}
 
@@ -30,13 +30,37 @@ func (a *userApi) apiTokenHandler(ctx echo.Context) error {
 		return ctx.JSON(http.StatusOK, cacheValue.(uuid.UUID))
 	}
 
-	t, err := a.pgStorage.GetOrCreateUser(user.UID)
+	u, err := a.pgStorage.GetOrCreateUser(user.UID, user.Email)
 	if err != nil {
 		log.Logger.UserApi.Errorf("storage.GetOrCreateUser: %s", err)
 		return err
 	}
 
-	a.cache.Set(user.UID, t.ApiToken, longTermCache)
+	// the oldest active key is returned for compatibility with single token clients
+	k, isFound, err := a.pgStorage.GetActiveApiKey(u.ID)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.GetActiveApiKey: %s", err)
+		return err
+	}
+	if !isFound {
+		return echo.NewHTTPError(http.StatusNotFound, ErrNoActiveApiKeys)
+	}
 
-	return ctx.JSON(http.StatusOK, t.ApiToken)
+	// cache is invalidated on api keys changes, expiration is handled by the shorter ttl
+	ttl := longTermCache
+	if k.ExpiresAt != nil && time.Until(*k.ExpiresAt) < ttl {
+		ttl = time.Until(*k.ExpiresAt)
+	}
+	a.cache.Set(user.UID, k.Token, ttl)
+
+	return ctx.JSON(http.StatusOK, k.Token)
+}
+
+// dropCachedApiToken removes revoked token from cache, keys may be revoked by another instance or organization admin
+func (a *userApi) dropCachedApiToken(token uuid.UUID) {
+	for key, item := range a.cache.Items() {
+		if cachedToken, ok := item.Object.(uuid.UUID); ok && cachedToken == token {
+			a.cache.Delete(key)
+		}
+	}
 }
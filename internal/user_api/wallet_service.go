@@ -0,0 +1,150 @@
+package user_api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"extrnode-be/internal/pkg/auth_providers"
+	"extrnode-be/internal/pkg/log"
+)
+
+const walletPubkeyParam = "pubkey"
+
+type (
+	walletNonceRequest struct {
+		Pubkey string `json:"pubkey"`
+	}
+	walletSignatureRequest struct {
+		Pubkey    string `json:"pubkey"`
+		Nonce     string `json:"nonce"`
+		Signature string `json:"signature"`
+	}
+)
+
+// walletSignInNonceHandler issues message which must be signed by wallet to sign in
+func (a *userApi) walletSignInNonceHandler(ctx echo.Context) error {
+	var req walletNonceRequest
+	err := ctx.Bind(&req)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	nonce, err := a.wallet.SignInNonce(strings.TrimSpace(req.Pubkey))
+	if err != nil {
+		return walletError(ctx, "wallet.SignInNonce", err)
+	}
+
+	return ctx.JSON(http.StatusCreated, nonce)
+}
+
+// walletSignInHandler returns session of user linked to wallet. User is created on the first sign in
+func (a *userApi) walletSignInHandler(ctx echo.Context) error {
+	var req walletSignatureRequest
+	err := ctx.Bind(&req)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	token, expiresAt, err := a.wallet.SignIn(strings.TrimSpace(req.Pubkey), req.Nonce, req.Signature)
+	if err != nil {
+		return walletError(ctx, "wallet.SignIn", err)
+	}
+
+	return ctx.JSON(http.StatusOK, authTokenResp{Token: token, ExpiresAt: expiresAt})
+}
+
+func (a *userApi) getWalletsHandler(ctx echo.Context) error {
+	u, err := a.getVerifiedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	wallets, err := a.pgStorage.GetUserWallets(u.ID)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.GetUserWallets: %s", err)
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, wallets)
+}
+
+// walletLinkNonceHandler issues message which must be signed by wallet to link it to user
+func (a *userApi) walletLinkNonceHandler(ctx echo.Context) error {
+	var req walletNonceRequest
+	err := ctx.Bind(&req)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, err.Error())
+	}
+	u, err := a.getVerifiedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	nonce, err := a.wallet.LinkNonce(u.ID, strings.TrimSpace(req.Pubkey))
+	if err != nil {
+		return walletError(ctx, "wallet.LinkNonce", err)
+	}
+
+	return ctx.JSON(http.StatusCreated, nonce)
+}
+
+func (a *userApi) linkWalletHandler(ctx echo.Context) error {
+	var req walletSignatureRequest
+	err := ctx.Bind(&req)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, err.Error())
+	}
+	u, err := a.getVerifiedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	wallet, err := a.wallet.Link(u.ID, strings.TrimSpace(req.Pubkey), req.Nonce, req.Signature)
+	if err != nil {
+		return walletError(ctx, "wallet.Link", err)
+	}
+
+	return ctx.JSON(http.StatusCreated, wallet)
+}
+
+func (a *userApi) unlinkWalletHandler(ctx echo.Context) error {
+	u, err := a.getVerifiedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	pubkey := ctx.Param(walletPubkeyParam)
+	// user created by wallet sign in can't sign in without it
+	if auth_providers.IsOriginWallet(u.ProviderID, pubkey) {
+		return ctx.JSON(http.StatusBadRequest, ErrOriginWallet)
+	}
+
+	isFound, err := a.pgStorage.UnlinkWallet(u.ID, pubkey)
+	if err != nil {
+		log.Logger.UserApi.Errorf("storage.UnlinkWallet: %s", err)
+		return err
+	}
+	if !isFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// walletError writes client errors of wallet auth, other errors are logged
+func walletError(ctx echo.Context, method string, err error) error {
+	switch {
+	case errors.Is(err, auth_providers.ErrInvalidPubkey):
+		return ctx.JSON(http.StatusBadRequest, err.Error())
+	case errors.Is(err, auth_providers.ErrInvalidSignature), errors.Is(err, auth_providers.ErrNonceNotFound):
+		return ctx.JSON(http.StatusUnauthorized, err.Error())
+	case errors.Is(err, auth_providers.ErrWalletLinked):
+		return ctx.JSON(http.StatusConflict, err.Error())
+	}
+	log.Logger.UserApi.Errorf("%s: %s", method, err)
+
+	return err
+}